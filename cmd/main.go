@@ -1,19 +1,48 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/SawitProRecruitment/UserService/encryption"
 	"github.com/SawitProRecruitment/UserService/generated"
 	"github.com/SawitProRecruitment/UserService/handler"
+	"github.com/SawitProRecruitment/UserService/keyring"
+	"github.com/SawitProRecruitment/UserService/notify"
+	"github.com/SawitProRecruitment/UserService/password"
+	"github.com/SawitProRecruitment/UserService/ratelimit"
 	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/sms"
+	"github.com/SawitProRecruitment/UserService/webauthn"
 
 	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func main() {
 	e := echo.New()
+	// rate limits are keyed by client IP, which must not be taken from
+	// headers the client controls unless a trusted proxy sets them
+	if os.Getenv("BEHIND_PROXY") == "true" {
+		e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	} else {
+		e.IPExtractor = echo.ExtractIPDirect()
+	}
+
+	swagger, err := generated.GetSwagger()
+	if err != nil {
+		panic(err)
+	}
 
-	var server generated.ServerInterface = newServer()
+	server := newServer()
+	e.Use(server.Authenticate(swagger))
+
+	go purgeDeletedUsers(server.Repository, durationFromEnv("ACCOUNT_PURGE_INTERVAL", time.Hour), e.Logger)
 
 	generated.RegisterHandlers(e, server)
 	e.Logger.Fatal(e.Start(":1323"))
@@ -21,11 +50,227 @@ func main() {
 
 func newServer() *handler.Server {
 	dbDsn := os.Getenv("DATABASE_URL")
-	var repo repository.RepositoryInterface = repository.NewRepository(repository.NewRepositoryOptions{
+	repo := repository.NewRepository(repository.NewRepositoryOptions{
 		Dsn: dbDsn,
 	})
+	issuer := os.Getenv("ISSUER_URL")
+	if issuer == "" {
+		issuer = "http://localhost:8080"
+	}
+
+	// accounts registered before phone verification have no verified
+	// number, so refusing them is opt-in
+	requirePhoneVerification := os.Getenv("REQUIRE_PHONE_VERIFICATION") == "true"
+
+	// a text message alone is a weaker login than a password, so it is
+	// opt-in as well
+	enableOTPLogin := os.Getenv("ENABLE_OTP_LOGIN") == "true"
+
+	lockoutPolicy := handler.DefaultLockoutPolicy
+	if maxFailures := os.Getenv("LOGIN_MAX_FAILURES"); maxFailures != "" {
+		var err error
+		lockoutPolicy.MaxFailures, err = strconv.Atoi(maxFailures)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	smsSender := newSMSSender()
+
 	opts := handler.NewServerOptions{
-		Repository: repo,
+		Repository:      repo,
+		TokenRevocation: repo,
+		KeyRing:         newKeyRing(),
+		PasswordHasher:  newPasswordHasher(),
+		SMSSender:       smsSender,
+		SecretCipher:    newSecretCipher(),
+		WebAuthn:        newRelyingParty(issuer),
+		Issuer:          issuer,
+
+		RequirePhoneVerification:   requirePhoneVerification,
+		EnableOTPLogin:             enableOTPLogin,
+		LockoutPolicy:              lockoutPolicy,
+		AnomalyPolicy:              newAnomalyPolicy(),
+		Notifier:                   notify.NewSMSNotifier(smsSender),
+		AccountDeletionGracePeriod: durationFromEnv("ACCOUNT_DELETION_GRACE_PERIOD", handler.DefaultAccountDeletionGracePeriod),
+		// one instance for now, switch to a shared store when scaling out
+		RateLimitStore: ratelimit.NewMemoryStore(ratelimit.NewMemoryStoreOptions{}),
+		RateLimits:     handler.DefaultRateLimits,
 	}
 	return handler.NewServer(opts)
 }
+
+// purgeDeletedUsers removes deleted accounts whose grace period is over,
+// every interval.
+func purgeDeletedUsers(repo repository.RepositoryInterface, interval time.Duration, logger echo.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		purged, err := repo.PurgeDeletedUsers(context.Background(), time.Now())
+		if err != nil {
+			logger.Errorf("purge deleted users: %v", err)
+			continue
+		}
+
+		if purged > 0 {
+			logger.Infof("purged %d deleted users", purged)
+		}
+	}
+}
+
+// durationFromEnv parses the duration in the environment variable key, e.g.
+// 720h, and returns fallback when it is not set.
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		panic(err)
+	}
+
+	return duration
+}
+
+// newKeyRing loads signing keys from PRIVATE_KEY and from the PEM files in
+// SIGNING_KEYS_DIR. Rotating a key only needs a new file with a future
+// Activate-At header, older keys keep verifying until their tokens expire.
+func newKeyRing() *keyring.KeyRing {
+	ring := keyring.NewKeyRing(keyring.NewKeyRingOptions{
+		MaxTokenLifetime: handler.MaxTokenLifetime(),
+	})
+
+	if privateKey := os.Getenv("PRIVATE_KEY"); privateKey != "" {
+		if err := ring.LoadPEM([]byte(privateKey)); err != nil {
+			panic(err)
+		}
+	}
+
+	if dir := os.Getenv("SIGNING_KEYS_DIR"); dir != "" {
+		if err := ring.LoadDir(dir); err != nil {
+			panic(err)
+		}
+	}
+
+	return ring
+}
+
+// newPasswordHasher hashes new passwords with PASSWORD_HASHER, argon2id by
+// default or bcrypt with BCRYPT_COST. Hashes of the other scheme are still
+// accepted and upgraded on the next login.
+func newPasswordHasher() *password.Hasher {
+	bcryptCost := bcrypt.DefaultCost
+	if cost := os.Getenv("BCRYPT_COST"); cost != "" {
+		var err error
+		bcryptCost, err = strconv.Atoi(cost)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if os.Getenv("PASSWORD_HASHER") == "bcrypt" {
+		return password.NewHasher(password.Bcrypt{Cost: bcryptCost}, password.DefaultArgon2id)
+	}
+
+	return password.NewHasher(password.DefaultArgon2id, password.Bcrypt{Cost: bcryptCost})
+}
+
+// newAnomalyPolicy compares logins with the last LOGIN_ANOMALY_LOOKBACK
+// logins, 0 turns detection off, on the parts listed in the comma separated
+// LOGIN_ANOMALY_CHECKS, network and device by default.
+// LOGIN_ANOMALY_STEP_UP=true asks flagged password logins for a texted code.
+func newAnomalyPolicy() handler.AnomalyPolicy {
+	policy := handler.DefaultAnomalyPolicy
+	if lookback := os.Getenv("LOGIN_ANOMALY_LOOKBACK"); lookback != "" {
+		var err error
+		policy.Lookback, err = strconv.Atoi(lookback)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if checks := os.Getenv("LOGIN_ANOMALY_CHECKS"); checks != "" {
+		policy.CheckNetwork, policy.CheckDevice = false, false
+		for _, check := range strings.Split(checks, ",") {
+			switch strings.TrimSpace(check) {
+			case "network":
+				policy.CheckNetwork = true
+			case "device":
+				policy.CheckDevice = true
+			default:
+				panic("LOGIN_ANOMALY_CHECKS: unknown check " + check)
+			}
+		}
+	}
+
+	policy.RequireStepUp = os.Getenv("LOGIN_ANOMALY_STEP_UP") == "true"
+	return policy
+}
+
+// newSMSSender writes text messages to SMS_LOG_FILE, or to stdout when it is
+// not set, until a real SMS gateway is configured.
+func newSMSSender() sms.SMSSender {
+	path := os.Getenv("SMS_LOG_FILE")
+	if path == "" {
+		return sms.NewLogSender(os.Stdout)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		panic(err)
+	}
+
+	return sms.NewLogSender(file)
+}
+
+// newSecretCipher encrypts authenticator app secrets with the base64 key in
+// TOTP_ENCRYPTION_KEY. Two-factor authentication cannot be enrolled without.
+func newSecretCipher() *encryption.Cipher {
+	key := os.Getenv("TOTP_ENCRYPTION_KEY")
+	if key == "" {
+		return nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		panic(err)
+	}
+
+	cipher, err := encryption.NewCipher(decoded)
+	if err != nil {
+		panic(err)
+	}
+
+	return cipher
+}
+
+// newRelyingParty scopes passkeys to the host of the issuer and accepts
+// ceremonies from the issuer origin. WEBAUTHN_RP_ID and the comma separated
+// WEBAUTHN_ORIGINS override them, e.g. when the web app is served from
+// another subdomain.
+func newRelyingParty(issuer string) *webauthn.RelyingParty {
+	issuerURL, err := url.Parse(issuer)
+	if err != nil {
+		panic(err)
+	}
+
+	rp := &webauthn.RelyingParty{
+		ID:                      issuerURL.Hostname(),
+		Name:                    "UserService",
+		Origins:                 []string{issuerURL.Scheme + "://" + issuerURL.Host},
+		RequireUserVerification: true,
+	}
+
+	if rpID := os.Getenv("WEBAUTHN_RP_ID"); rpID != "" {
+		rp.ID = rpID
+	}
+
+	if origins := os.Getenv("WEBAUTHN_ORIGINS"); origins != "" {
+		rp.Origins = strings.Split(origins, ",")
+	}
+
+	return rp
+}
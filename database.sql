@@ -15,20 +15,216 @@ CREATE TABLE "user"(
 	full_name               VARCHAR (100) NOT NULL,
   phone_number            VARCHAR (13) UNIQUE NOT NULL,
   "password"              VARCHAR (255) NOT NULL,
+  phone_verified_at       timestamptz,
+  status                  VARCHAR (20) NOT NULL DEFAULT 'active'
+                          CHECK (status IN ('active', 'deactivated', 'suspended', 'pending_deletion')),
+  deleted_at              timestamptz,
+  purge_at                timestamptz,
   created_at              timestamptz		NOT NULL DEFAULT now(),
 	updated_at              timestamptz		NOT NULL DEFAULT now(),
 	created_by              varchar(100)	NOT NULL DEFAULT 'system'::character varying,
 	updated_by              varchar(100)	NOT NULL DEFAULT 'system'::character varying
 );
 
+-- deleted users are kept until purge_at, then removed with all their rows
+CREATE INDEX idx_user_purge_at ON "user"(purge_at) WHERE purge_at IS NOT NULL;
+
 CREATE TABLE login(
 	"id"                    UUID PRIMARY KEY,
 	user_id                 UUID NOT NULL UNIQUE,
   success_counter         int NOT NULL DEFAULT 0,
   last_login              timestamptz		NOT NULL DEFAULT now(),
+  failure_counter         int NOT NULL DEFAULT 0,
+  last_failure            timestamptz,
+  locked_until            timestamptz,
   created_at              timestamptz		NOT NULL DEFAULT now(),
 	updated_at              timestamptz		NOT NULL DEFAULT now(),
 	created_by              varchar(100)	NOT NULL DEFAULT 'system'::character varying,
 	updated_by              varchar(100)	NOT NULL DEFAULT 'system'::character varying,
   CONSTRAINT fk_user_id FOREIGN KEY(user_id) REFERENCES "user"(id) ON DELETE NO ACTION
-);
\ No newline at end of file
+);
+
+-- failed logins with phone numbers that are not registered, so they are
+-- delayed and locked out the same way as the logins of a user
+CREATE TABLE unknown_login(
+  phone_number            VARCHAR (13) PRIMARY KEY,
+  failure_counter         int NOT NULL DEFAULT 0,
+  last_failure            timestamptz,
+  locked_until            timestamptz,
+  created_at              timestamptz		NOT NULL DEFAULT now(),
+	updated_at              timestamptz		NOT NULL DEFAULT now()
+);
+
+-- append-only history of login attempts of known users, the counters of
+-- login are updated in the same transaction as each event
+CREATE TABLE login_event(
+	"id"                    UUID PRIMARY KEY,
+	user_id                 UUID NOT NULL,
+  success                 BOOLEAN NOT NULL,
+  "method"                VARCHAR (20) NOT NULL,
+  failure_reason          VARCHAR (50) NOT NULL DEFAULT '',
+  ip_address              VARCHAR (45) NOT NULL DEFAULT '',
+  user_agent              TEXT NOT NULL DEFAULT '',
+  session_id              UUID,
+  ip_prefix               VARCHAR (50) NOT NULL DEFAULT '',
+  user_agent_family       VARCHAR (100) NOT NULL DEFAULT '',
+  flagged                 BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at              timestamptz		NOT NULL DEFAULT now(),
+	created_by              varchar(100)	NOT NULL DEFAULT 'system'::character varying,
+  CONSTRAINT fk_login_event_user_id FOREIGN KEY(user_id) REFERENCES "user"(id) ON DELETE NO ACTION
+);
+
+CREATE INDEX idx_login_event_user_id ON login_event(user_id, created_at DESC, id DESC);
+
+CREATE TABLE refresh_token(
+	"id"                    UUID PRIMARY KEY,
+	user_id                 UUID NOT NULL,
+  family_id               UUID NOT NULL,
+  token_hash              VARCHAR (64) UNIQUE NOT NULL,
+  scope                   VARCHAR (255) NOT NULL DEFAULT 'profile',
+  expires_at              timestamptz		NOT NULL,
+  rotated_at              timestamptz,
+  revoked_at              timestamptz,
+  created_at              timestamptz		NOT NULL DEFAULT now(),
+	updated_at              timestamptz		NOT NULL DEFAULT now(),
+	created_by              varchar(100)	NOT NULL DEFAULT 'system'::character varying,
+	updated_by              varchar(100)	NOT NULL DEFAULT 'system'::character varying,
+  CONSTRAINT fk_refresh_token_user_id FOREIGN KEY(user_id) REFERENCES "user"(id) ON DELETE NO ACTION
+);
+
+CREATE INDEX idx_refresh_token_family_id ON refresh_token(family_id);
+
+-- a login on one device, its id is the family_id of the refresh tokens
+-- issued for it
+CREATE TABLE user_session(
+	"id"                    UUID PRIMARY KEY,
+	user_id                 UUID NOT NULL,
+  device_label            VARCHAR (100) NOT NULL DEFAULT '',
+  user_agent              TEXT NOT NULL DEFAULT '',
+  ip_address              VARCHAR (45) NOT NULL DEFAULT '',
+  auth_time               timestamptz		NOT NULL DEFAULT now(),
+  last_seen_at            timestamptz		NOT NULL DEFAULT now(),
+  created_at              timestamptz		NOT NULL DEFAULT now(),
+	updated_at              timestamptz		NOT NULL DEFAULT now(),
+	created_by              varchar(100)	NOT NULL DEFAULT 'system'::character varying,
+	updated_by              varchar(100)	NOT NULL DEFAULT 'system'::character varying,
+  CONSTRAINT fk_user_session_user_id FOREIGN KEY(user_id) REFERENCES "user"(id) ON DELETE NO ACTION
+);
+
+CREATE INDEX idx_user_session_user_id ON user_session(user_id);
+
+CREATE TABLE one_time_code(
+	"id"                    UUID PRIMARY KEY,
+	user_id                 UUID NOT NULL,
+  purpose                 VARCHAR (50) NOT NULL,
+  code_hash               VARCHAR (64) NOT NULL,
+  attempts                int NOT NULL DEFAULT 0,
+  expires_at              timestamptz		NOT NULL,
+  consumed_at             timestamptz,
+  created_at              timestamptz		NOT NULL DEFAULT now(),
+	updated_at              timestamptz		NOT NULL DEFAULT now(),
+	created_by              varchar(100)	NOT NULL DEFAULT 'system'::character varying,
+	updated_by              varchar(100)	NOT NULL DEFAULT 'system'::character varying,
+  CONSTRAINT fk_one_time_code_user_id FOREIGN KEY(user_id) REFERENCES "user"(id) ON DELETE NO ACTION
+);
+
+CREATE INDEX idx_one_time_code_user_id_purpose ON one_time_code(user_id, purpose);
+
+CREATE TABLE totp_credential(
+	user_id                 UUID PRIMARY KEY,
+  secret_encrypted        TEXT NOT NULL,
+  confirmed_at            timestamptz,
+  last_used_step          bigint NOT NULL DEFAULT 0,
+  created_at              timestamptz		NOT NULL DEFAULT now(),
+	updated_at              timestamptz		NOT NULL DEFAULT now(),
+	created_by              varchar(100)	NOT NULL DEFAULT 'system'::character varying,
+	updated_by              varchar(100)	NOT NULL DEFAULT 'system'::character varying,
+  CONSTRAINT fk_totp_credential_user_id FOREIGN KEY(user_id) REFERENCES "user"(id) ON DELETE NO ACTION
+);
+
+CREATE TABLE webauthn_credential(
+	"id"                    VARCHAR (1400) PRIMARY KEY,
+	user_id                 UUID NOT NULL,
+  "name"                  VARCHAR (100) NOT NULL,
+  public_key              BYTEA NOT NULL,
+  sign_count              bigint NOT NULL DEFAULT 0,
+  aaguid                  UUID NOT NULL,
+  attestation_format      VARCHAR (20) NOT NULL,
+  last_used_at            timestamptz,
+  created_at              timestamptz		NOT NULL DEFAULT now(),
+	updated_at              timestamptz		NOT NULL DEFAULT now(),
+	created_by              varchar(100)	NOT NULL DEFAULT 'system'::character varying,
+	updated_by              varchar(100)	NOT NULL DEFAULT 'system'::character varying,
+  CONSTRAINT fk_webauthn_credential_user_id FOREIGN KEY(user_id) REFERENCES "user"(id) ON DELETE NO ACTION
+);
+
+CREATE INDEX idx_webauthn_credential_user_id ON webauthn_credential(user_id);
+
+CREATE TABLE recovery_code(
+	"id"                    UUID PRIMARY KEY,
+	user_id                 UUID NOT NULL,
+  code_hash               VARCHAR (64) NOT NULL,
+  used_at                 timestamptz,
+  created_at              timestamptz		NOT NULL DEFAULT now(),
+	updated_at              timestamptz		NOT NULL DEFAULT now(),
+	created_by              varchar(100)	NOT NULL DEFAULT 'system'::character varying,
+	updated_by              varchar(100)	NOT NULL DEFAULT 'system'::character varying,
+  CONSTRAINT fk_recovery_code_user_id FOREIGN KEY(user_id) REFERENCES "user"(id) ON DELETE NO ACTION
+);
+
+CREATE UNIQUE INDEX idx_recovery_code_user_id_code_hash ON recovery_code(user_id, code_hash);
+
+CREATE TABLE audit_event(
+	"id"                    UUID PRIMARY KEY,
+	user_id                 UUID NOT NULL,
+  "action"                VARCHAR (50) NOT NULL,
+  detail                  VARCHAR (255) NOT NULL DEFAULT '',
+  ip_address              VARCHAR (45) NOT NULL DEFAULT '',
+  user_agent              TEXT NOT NULL DEFAULT '',
+  created_at              timestamptz		NOT NULL DEFAULT now(),
+	created_by              varchar(100)	NOT NULL DEFAULT 'system'::character varying,
+  CONSTRAINT fk_audit_event_user_id FOREIGN KEY(user_id) REFERENCES "user"(id) ON DELETE NO ACTION
+);
+
+CREATE INDEX idx_audit_event_user_id ON audit_event(user_id, created_at);
+
+CREATE TABLE revoked_token(
+	"id"                    UUID PRIMARY KEY,
+  expires_at              timestamptz		NOT NULL,
+  created_at              timestamptz		NOT NULL DEFAULT now(),
+	created_by              varchar(100)	NOT NULL DEFAULT 'system'::character varying
+);
+
+CREATE INDEX idx_revoked_token_expires_at ON revoked_token(expires_at);
+
+CREATE TABLE client(
+	"id"                    VARCHAR (100) PRIMARY KEY,
+	"name"                  VARCHAR (100) NOT NULL,
+  secret_hash             VARCHAR (255) NOT NULL,
+  redirect_uris           TEXT[] NOT NULL DEFAULT '{}',
+  scopes                  TEXT[] NOT NULL DEFAULT '{}',
+  created_at              timestamptz		NOT NULL DEFAULT now(),
+	updated_at              timestamptz		NOT NULL DEFAULT now(),
+	created_by              varchar(100)	NOT NULL DEFAULT 'system'::character varying,
+	updated_by              varchar(100)	NOT NULL DEFAULT 'system'::character varying
+);
+
+CREATE TABLE authorization_code(
+	code_hash               VARCHAR (64) PRIMARY KEY,
+	client_id               VARCHAR (100) NOT NULL,
+	user_id                 UUID NOT NULL,
+  redirect_uri            TEXT NOT NULL,
+  scope                   VARCHAR (255) NOT NULL,
+  nonce                   VARCHAR (255) NOT NULL DEFAULT '',
+  code_challenge          VARCHAR (128) NOT NULL,
+  code_challenge_method   VARCHAR (10) NOT NULL,
+  auth_time               timestamptz		NOT NULL,
+  expires_at              timestamptz		NOT NULL,
+  consumed_at             timestamptz,
+  created_at              timestamptz		NOT NULL DEFAULT now(),
+	updated_at              timestamptz		NOT NULL DEFAULT now(),
+	created_by              varchar(100)	NOT NULL DEFAULT 'system'::character varying,
+	updated_by              varchar(100)	NOT NULL DEFAULT 'system'::character varying,
+  CONSTRAINT fk_authorization_code_client_id FOREIGN KEY(client_id) REFERENCES client(id) ON DELETE CASCADE,
+  CONSTRAINT fk_authorization_code_user_id FOREIGN KEY(user_id) REFERENCES "user"(id) ON DELETE NO ACTION
+);
@@ -0,0 +1,79 @@
+// This file contains the encryption of secrets stored in the database, so a
+// leaked dump alone does not reveal them.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+)
+
+var ErrInvalidCiphertext = errors.New("ciphertext is not valid")
+
+// Cipher encrypts with AES-GCM. Ciphertexts are the base64 of the nonce
+// followed by the sealed data.
+type Cipher struct {
+	aead cipher.AEAD
+	// macKey is derived from the key, so that no MAC can be used to
+	// attack the encryption key.
+	macKey []byte
+}
+
+// NewCipher takes a 16, 24 or 32 bytes key.
+func NewCipher(key []byte) (*Cipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	derive := hmac.New(sha256.New, key)
+	derive.Write([]byte("mac"))
+
+	return &Cipher{
+		aead:   aead,
+		macKey: derive.Sum(nil),
+	}, nil
+}
+
+func (c *Cipher) Encrypt(plaintext []byte) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := c.aead.Seal(nonce, nonce, plaintext, nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (c *Cipher) Decrypt(ciphertext string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(sealed) < c.aead.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+
+	nonce, sealed := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+
+	return plaintext, nil
+}
+
+// MAC returns the hex HMAC-SHA256 of data, for secrets that are looked up by
+// their hash, which must not be guessable from a leaked dump either.
+func (c *Cipher) MAC(data []byte) string {
+	mac := hmac.New(sha256.New, c.macKey)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,52 @@
+package encryption
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCipher(t *testing.T) {
+	cipher, err := NewCipher(bytes.Repeat([]byte{1}, 32))
+	assert.Nil(t, err, "error should be nil")
+
+	ciphertext, err := cipher.Encrypt([]byte("secret"))
+	assert.Nil(t, err, "error should be nil")
+
+	t.Run("round trip", func(t *testing.T) {
+		plaintext, err := cipher.Decrypt(ciphertext)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, []byte("secret"), plaintext)
+	})
+
+	t.Run("nonce is random", func(t *testing.T) {
+		other, _ := cipher.Encrypt([]byte("secret"))
+		assert.NotEqual(t, ciphertext, other)
+	})
+
+	t.Run("other key", func(t *testing.T) {
+		otherCipher, _ := NewCipher(bytes.Repeat([]byte{2}, 32))
+		_, err := otherCipher.Decrypt(ciphertext)
+		assert.ErrorIs(t, err, ErrInvalidCiphertext)
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		_, err := cipher.Decrypt("c2hvcnQ=")
+		assert.ErrorIs(t, err, ErrInvalidCiphertext)
+	})
+
+	t.Run("mac", func(t *testing.T) {
+		otherCipher, _ := NewCipher(bytes.Repeat([]byte{2}, 32))
+
+		assert.Equal(t, cipher.MAC([]byte("secret")), cipher.MAC([]byte("secret")))
+		assert.Len(t, cipher.MAC([]byte("secret")), 64)
+		assert.NotEqual(t, cipher.MAC([]byte("secret")), cipher.MAC([]byte("other")))
+		assert.NotEqual(t, cipher.MAC([]byte("secret")), otherCipher.MAC([]byte("secret")))
+	})
+
+	t.Run("invalid key size", func(t *testing.T) {
+		_, err := NewCipher([]byte("short"))
+		assert.NotNil(t, err)
+	})
+}
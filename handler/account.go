@@ -0,0 +1,362 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/helper"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// DefaultAccountDeletionGracePeriod is how long a deleted account is
+	// kept before it is purged, unless configured otherwise.
+	DefaultAccountDeletionGracePeriod = 30 * 24 * time.Hour
+
+	auditAccountDeleted     = "account_deleted"
+	auditAccountDeactivated = "account_deactivated"
+	auditAccountReactivated = "account_reactivated"
+	auditAccountSuspended   = "account_suspended"
+	auditAccountUnsuspended = "account_unsuspended"
+)
+
+var (
+	errAccountDeactivated     = errors.New("Account is deactivated, reactivate it with a one-time code")
+	errAccountSuspended       = errors.New("Account is suspended, contact support")
+	errAccountPendingDeletion = errors.New("Account is scheduled for deletion, reactivate it with a one-time code to keep it")
+	errAccountStatusConflict  = errors.New("Account status does not allow this change")
+)
+
+// DeleteProfile deletes the account of the current user after checking the
+// password again. The account is gone right away but only purged with all
+// its data after the grace period.
+func (s *Server) DeleteProfile(ctx echo.Context) error {
+	var (
+		successResp generated.DeleteProfileResponse
+	)
+
+	claims, ok := ClaimsFromContext(ctx.Request().Context())
+	if !ok {
+		return sendErrorResponse(ctx, http.StatusForbidden, errors.New("User is not authorized"))
+	}
+
+	request := &generated.DeleteProfileRequest{}
+	err := json.NewDecoder(ctx.Request().Body).Decode(&request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	err = validateLoginPassword(request.Password)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	user, err := s.getActiveUserByID(ctx.Request().Context(), claims.UserID)
+	if err != nil {
+		return sendUserLookupError(ctx, err)
+	}
+
+	confirmed, err := s.confirmPassword(ctx, user, []byte(request.Password))
+	if !confirmed {
+		return err
+	}
+
+	purgeAt := time.Now().Add(s.AccountDeletionGracePeriod)
+	err = s.Repository.DeleteUser(ctx.Request().Context(), user.ID, purgeAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sendErrorResponse(ctx, http.StatusConflict, errAccountStatusConflict)
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	err = s.recordAuditEvent(ctx, user.ID, auditAccountDeleted, "")
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	// sign out everywhere, including the session making the request
+	err = s.revokeOtherSessions(ctx.Request().Context(), user.ID, "")
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	successResp.Result = "delete profile success"
+	successResp.PurgeAt = purgeAt
+	return ctx.JSON(http.StatusOK, successResp)
+}
+
+// ExportProfile returns everything stored about the current user as a JSON
+// file to download.
+func (s *Server) ExportProfile(ctx echo.Context) error {
+	claims, ok := ClaimsFromContext(ctx.Request().Context())
+	if !ok {
+		return sendErrorResponse(ctx, http.StatusForbidden, errors.New("User is not authorized"))
+	}
+
+	export, err := s.Repository.ExportUser(ctx.Request().Context(), claims.UserID)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	export.ExportedAt = time.Now().UTC()
+	ctx.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="user-%s.json"`, claims.UserID))
+	return ctx.JSON(http.StatusOK, export)
+}
+
+// DeactivateProfile deactivates the account of the current user after
+// checking the password again. It signs out every session and refuses
+// logins until the user reactivates it.
+func (s *Server) DeactivateProfile(ctx echo.Context) error {
+	var (
+		successResp generated.DeactivateProfileResponse
+	)
+
+	claims, ok := ClaimsFromContext(ctx.Request().Context())
+	if !ok {
+		return sendErrorResponse(ctx, http.StatusForbidden, errors.New("User is not authorized"))
+	}
+
+	request := &generated.DeactivateProfileRequest{}
+	err := json.NewDecoder(ctx.Request().Body).Decode(&request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	err = validateLoginPassword(request.Password)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	user, err := s.getActiveUserByID(ctx.Request().Context(), claims.UserID)
+	if err != nil {
+		return sendUserLookupError(ctx, err)
+	}
+
+	confirmed, err := s.confirmPassword(ctx, user, []byte(request.Password))
+	if !confirmed {
+		return err
+	}
+
+	err = s.Repository.UpdateUserStatus(ctx.Request().Context(), user.ID,
+		[]string{repository.UserStatusActive}, repository.UserStatusDeactivated, user.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sendErrorResponse(ctx, http.StatusConflict, errAccountStatusConflict)
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	err = s.recordAuditEvent(ctx, user.ID, auditAccountDeactivated, "")
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	err = s.revokeOtherSessions(ctx.Request().Context(), user.ID, "")
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	successResp.Result = "deactivate profile success"
+	return ctx.JSON(http.StatusOK, successResp)
+}
+
+// RequestReactivation texts a code to reactivate an account that was
+// deactivated or is pending deletion. The response does not tell whether
+// one was sent.
+func (s *Server) RequestReactivation(ctx echo.Context) error {
+	var (
+		successResp generated.RequestReactivationResponse
+	)
+
+	request := &generated.RequestReactivationRequest{}
+	err := json.NewDecoder(ctx.Request().Body).Decode(&request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	err = validateLoginPhoneNumber(request.PhoneNumber)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	allowed, retryAfter, err := s.checkRateLimit(ctx, "reactivate", request.PhoneNumber)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if !allowed {
+		return sendRateLimitResponse(ctx, retryAfter)
+	}
+
+	successResp.Result = "a reactivation code is sent if the account can be reactivated"
+
+	user, err := s.Repository.GetUser(ctx.Request().Context(), request.PhoneNumber)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ctx.JSON(http.StatusOK, successResp)
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if !reactivatable(user) {
+		return ctx.JSON(http.StatusOK, successResp)
+	}
+
+	err = s.sendOneTimeCode(ctx.Request().Context(), user, oneTimeCodeReactivation,
+		"%s is your code to reactivate your account. Do not share it with anyone.")
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	return ctx.JSON(http.StatusOK, successResp)
+}
+
+// VerifyReactivation reactivates an account with the code sent by
+// RequestReactivation. A pending deletion is cancelled.
+func (s *Server) VerifyReactivation(ctx echo.Context) error {
+	var (
+		successResp generated.VerifyReactivationResponse
+	)
+
+	request := &generated.VerifyReactivationRequest{}
+	err := json.NewDecoder(ctx.Request().Body).Decode(&request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	err = validateVerifyReactivation(request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	allowed, retryAfter, err := s.checkRateLimit(ctx, "reactivate", request.PhoneNumber)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if !allowed {
+		return sendRateLimitResponse(ctx, retryAfter)
+	}
+
+	user, err := s.Repository.GetUser(ctx.Request().Context(), request.PhoneNumber)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sendErrorResponse(ctx, http.StatusBadRequest, repository.ErrOneTimeCodeInvalid)
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if !reactivatable(user) {
+		return sendErrorResponse(ctx, http.StatusBadRequest, repository.ErrOneTimeCodeInvalid)
+	}
+
+	err = s.verifyOneTimeCode(ctx.Request().Context(), user.ID, oneTimeCodeReactivation, request.Code)
+	if err != nil {
+		if errors.Is(err, repository.ErrOneTimeCodeInvalid) {
+			return sendErrorResponse(ctx, http.StatusBadRequest, err)
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	err = s.Repository.UpdateUserStatus(ctx.Request().Context(), user.ID,
+		[]string{repository.UserStatusDeactivated, repository.UserStatusPendingDeletion}, repository.UserStatusActive, user.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sendErrorResponse(ctx, http.StatusConflict, errAccountStatusConflict)
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	err = s.recordAuditEvent(ctx, user.ID, auditAccountReactivated, "")
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	successResp.Result = "reactivate account success"
+	return ctx.JSON(http.StatusOK, successResp)
+}
+
+// reactivatable reports whether the user may reactivate the account.
+func reactivatable(user *repository.User) bool {
+	return user.Status == repository.UserStatusDeactivated || user.Status == repository.UserStatusPendingDeletion
+}
+
+// accountStatusError returns the error telling apart the status of an
+// account that is not active, nil for an active one.
+func accountStatusError(user *repository.User) error {
+	switch user.Status {
+	case repository.UserStatusDeactivated:
+		return errAccountDeactivated
+	case repository.UserStatusSuspended:
+		return errAccountSuspended
+	case repository.UserStatusPendingDeletion:
+		return errAccountPendingDeletion
+	}
+
+	return nil
+}
+
+// getActiveUser returns the user with phoneNumber for a request made on its
+// behalf without logging in. Accounts that are not active are reported as
+// sql.ErrNoRows like unknown phone numbers, so the response can't tell them
+// apart.
+func (s *Server) getActiveUser(ctx context.Context, phoneNumber string) (*repository.User, error) {
+	user, err := s.Repository.GetUser(ctx, phoneNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	if accountStatusError(user) != nil {
+		return nil, sql.ErrNoRows
+	}
+
+	return user, nil
+}
+
+// getActiveUserByID returns the user a request acts for, or the error of its
+// status when the account is not active.
+func (s *Server) getActiveUserByID(ctx context.Context, userID string) (*repository.User, error) {
+	user, err := s.Repository.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if statusErr := accountStatusError(user); statusErr != nil {
+		return nil, statusErr
+	}
+
+	return user, nil
+}
+
+// sendUserLookupError answers a failed getActiveUserByID. Accounts that are
+// not active are refused with their status.
+func sendUserLookupError(ctx echo.Context, err error) error {
+	switch err {
+	case errAccountDeactivated, errAccountSuspended, errAccountPendingDeletion:
+		return sendErrorResponse(ctx, http.StatusForbidden, err)
+	}
+
+	return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+}
+
+func validateVerifyReactivation(request *generated.VerifyReactivationRequest) error {
+	errStrs := []string{}
+
+	if err := validateLoginPhoneNumber(request.PhoneNumber); err != nil {
+		errStrs = append(errStrs, err.Error())
+	}
+
+	if request.Code == "" {
+		errStrs = append(errStrs, "code: can't be empty")
+	}
+
+	return helper.ErrStringsToErr(errStrs)
+}
@@ -0,0 +1,401 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/sms"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteProfile(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository:                 mockRepository,
+		TokenRevocation:            repository.NewMemoryTokenRevocation(),
+		PasswordHasher:             newTestPasswordHasher(),
+		AccountDeletionGracePeriod: DefaultAccountDeletionGracePeriod,
+	}
+
+	hashedPassword, _ := srv.PasswordHasher.Hash([]byte("AAAAAAAAA1a^1"))
+	mockUser := &repository.User{ID: "user-id", Password: hashedPassword}
+
+	newContext := func(payload string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodDelete, "/profile", bytes.NewBufferString(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		c := e.NewContext(req, rec)
+		return withClaims(c, &Claims{UserID: "user-id", SessionID: testSessionID}), rec
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		c, rec := newContext(`{"password": "AAAAAAAAA1a^1"}`)
+
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().DeleteUser(gomock.Any(), "user-id", gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ string, purgeAt time.Time) error {
+				assert.WithinDuration(t, time.Now().Add(DefaultAccountDeletionGracePeriod), purgeAt, time.Second)
+				return nil
+			}).Times(1)
+		mockRepository.EXPECT().StoreAuditEvent(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, data *repository.AuditEvent) error {
+				assert.Equal(t, auditAccountDeleted, data.Action)
+				return nil
+			}).Times(1)
+		mockRepository.EXPECT().RevokeOtherRefreshTokenFamilies(gomock.Any(), "user-id", "").
+			Return([]string{testSessionID, testOtherSessionID}, nil).Times(1)
+
+		err := srv.DeleteProfile(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		resp := generated.DeleteProfileResponse{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.WithinDuration(t, time.Now().Add(DefaultAccountDeletionGracePeriod), resp.PurgeAt, time.Second)
+
+		// every session is signed out, the current one included
+		for _, sessionID := range []string{testSessionID, testOtherSessionID} {
+			revoked, _ := srv.TokenRevocation.IsTokenRevoked(context.Background(), sessionID)
+			assert.True(t, revoked)
+		}
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		c, rec := newContext(`{"password": "AAAAAAAAA1a^2"}`)
+
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().RecordLoginFailure(gomock.Any(), isLoginEvent("user-id", loginMethodPassword, loginFailureInvalidPassword), nil).
+			Return(nil).Times(1)
+
+		err := srv.DeleteProfile(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("locked out", func(t *testing.T) {
+		srv.LockoutPolicy = DefaultLockoutPolicy
+		defer func() { srv.LockoutPolicy = LockoutPolicy{} }()
+		c, rec := newContext(`{"password": "AAAAAAAAA1a^1"}`)
+
+		lockedUntil := time.Now().Add(10 * time.Minute)
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().GetLoginAttempts(gomock.Any(), "user-id").
+			Return(&repository.LoginAttempts{FailureCounter: 5, LockedUntil: &lockedUntil}, nil).Times(1)
+		mockRepository.EXPECT().StoreLoginEvent(gomock.Any(), isLoginEvent("user-id", loginMethodPassword, loginFailureLockedOut)).
+			Return(nil).Times(1)
+
+		// even the right password is refused
+		err := srv.DeleteProfile(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusLocked, rec.Code)
+	})
+
+	t.Run("wrong password counts towards the lockout", func(t *testing.T) {
+		srv.LockoutPolicy = DefaultLockoutPolicy
+		defer func() { srv.LockoutPolicy = LockoutPolicy{} }()
+		c, rec := newContext(`{"password": "AAAAAAAAA1a^2"}`)
+
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().GetLoginAttempts(gomock.Any(), "user-id").Return(&repository.LoginAttempts{}, nil).Times(1)
+		mockRepository.EXPECT().RecordLoginFailure(gomock.Any(), isLoginEvent("user-id", loginMethodPassword, loginFailureInvalidPassword), gomock.Not(nil)).
+			Return(nil).Times(1)
+
+		err := srv.DeleteProfile(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("not active", func(t *testing.T) {
+		c, rec := newContext(`{"password": "AAAAAAAAA1a^1"}`)
+
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().DeleteUser(gomock.Any(), "user-id", gomock.Any()).Return(sql.ErrNoRows).Times(1)
+
+		err := srv.DeleteProfile(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("delete error", func(t *testing.T) {
+		c, rec := newContext(`{"password": "AAAAAAAAA1a^1"}`)
+
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().DeleteUser(gomock.Any(), "user-id", gomock.Any()).Return(errors.New("error")).Times(1)
+
+		err := srv.DeleteProfile(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+
+	t.Run("password missing", func(t *testing.T) {
+		c, rec := newContext(`{}`)
+
+		err := srv.DeleteProfile(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("no claims", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/profile", bytes.NewBufferString(`{"password": "AAAAAAAAA1a^1"}`))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+
+		err := srv.DeleteProfile(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
+
+func TestExportProfile(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository: mockRepository,
+	}
+
+	newContext := func() (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodGet, "/profile/export", nil)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		c := e.NewContext(req, rec)
+		return withClaims(c, &Claims{UserID: "user-id"}), rec
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		c, rec := newContext()
+
+		mockRepository.EXPECT().ExportUser(gomock.Any(), "user-id").Return(&repository.UserExport{
+			Profile:      &repository.ProfileExport{ID: "user-id", FullName: "sadam", PhoneNumber: "+622342342322"},
+			LoginEvents:  []*repository.LoginEvent{{ID: "event-id", UserID: "user-id", Success: true, Method: loginMethodPassword}},
+			Sessions:     []*repository.Session{},
+			UnknownLogin: &repository.UnknownLoginExport{PhoneNumber: "+622342342322", FailureCounter: 3},
+		}, nil).Times(1)
+
+		err := srv.ExportProfile(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `attachment; filename="user-user-id.json"`, rec.Header().Get(echo.HeaderContentDisposition))
+
+		resp := generated.ExportProfileResponse{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Equal(t, "sadam", resp.Profile["full_name"])
+		assert.Len(t, resp.LoginEvents, 1)
+		assert.Nil(t, resp.Login)
+		assert.Equal(t, float64(3), (*resp.UnknownLogin)["failure_counter"])
+		assert.WithinDuration(t, time.Now(), resp.ExportedAt, time.Second)
+		assert.NotContains(t, rec.Body.String(), `"password":`)
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		c, rec := newContext()
+
+		mockRepository.EXPECT().ExportUser(gomock.Any(), "user-id").Return(nil, errors.New("error")).Times(1)
+
+		err := srv.ExportProfile(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
+
+func TestDeactivateProfile(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository:      mockRepository,
+		TokenRevocation: repository.NewMemoryTokenRevocation(),
+		PasswordHasher:  newTestPasswordHasher(),
+	}
+
+	hashedPassword, _ := srv.PasswordHasher.Hash([]byte("AAAAAAAAA1a^1"))
+	mockUser := &repository.User{ID: "user-id", Password: hashedPassword}
+
+	newContext := func(payload string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/profile/deactivate", bytes.NewBufferString(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		c := e.NewContext(req, rec)
+		return withClaims(c, &Claims{UserID: "user-id", SessionID: testSessionID}), rec
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		c, rec := newContext(`{"password": "AAAAAAAAA1a^1"}`)
+
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().UpdateUserStatus(gomock.Any(), "user-id",
+			[]string{repository.UserStatusActive}, repository.UserStatusDeactivated, "user-id").Return(nil).Times(1)
+		mockRepository.EXPECT().StoreAuditEvent(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, data *repository.AuditEvent) error {
+				assert.Equal(t, auditAccountDeactivated, data.Action)
+				return nil
+			}).Times(1)
+		mockRepository.EXPECT().RevokeOtherRefreshTokenFamilies(gomock.Any(), "user-id", "").
+			Return([]string{testSessionID}, nil).Times(1)
+
+		err := srv.DeactivateProfile(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		revoked, _ := srv.TokenRevocation.IsTokenRevoked(context.Background(), testSessionID)
+		assert.True(t, revoked)
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		c, rec := newContext(`{"password": "AAAAAAAAA1a^2"}`)
+
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().RecordLoginFailure(gomock.Any(), isLoginEvent("user-id", loginMethodPassword, loginFailureInvalidPassword), nil).
+			Return(nil).Times(1)
+
+		err := srv.DeactivateProfile(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("not active", func(t *testing.T) {
+		c, rec := newContext(`{"password": "AAAAAAAAA1a^1"}`)
+
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().UpdateUserStatus(gomock.Any(), "user-id", gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(sql.ErrNoRows).Times(1)
+
+		err := srv.DeactivateProfile(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("password missing", func(t *testing.T) {
+		c, rec := newContext(`{}`)
+
+		err := srv.DeactivateProfile(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestReactivation(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	var smsLog bytes.Buffer
+	srv := Server{
+		Repository: mockRepository,
+		SMSSender:  sms.NewLogSender(&smsLog),
+	}
+
+	newContext := func(path, payload string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return e.NewContext(req, rec), rec
+	}
+
+	for _, status := range []string{repository.UserStatusDeactivated, repository.UserStatusPendingDeletion} {
+		user := &repository.User{ID: "user-id", PhoneNumber: "+622342342322", Status: status}
+
+		t.Run("positive - "+status, func(t *testing.T) {
+			smsLog.Reset()
+			c, rec := newContext("/account/reactivate/request", `{"phone_number": "+622342342322"}`)
+
+			mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(user, nil).Times(1)
+			mockRepository.EXPECT().StoreOneTimeCode(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, data *repository.OneTimeCode) error {
+					assert.Equal(t, oneTimeCodeReactivation, data.Purpose)
+					return nil
+				}).Times(1)
+
+			err := srv.RequestReactivation(c)
+			assert.Nil(t, err, "error should be nil")
+			assert.Equal(t, http.StatusOK, rec.Code)
+			code := regexp.MustCompile(`message="(\d{6}) `).FindStringSubmatch(smsLog.String())[1]
+
+			c, rec = newContext("/account/reactivate/verify", `{"phone_number": "+622342342322", "code": "`+code+`"}`)
+
+			mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(user, nil).Times(1)
+			mockRepository.EXPECT().ConsumeOneTimeCode(gomock.Any(), "user-id", oneTimeCodeReactivation, hashOneTimeCode("user-id", code), MaxOneTimeCodeAttempts).
+				Return(&repository.OneTimeCode{}, nil).Times(1)
+			mockRepository.EXPECT().UpdateUserStatus(gomock.Any(), "user-id",
+				[]string{repository.UserStatusDeactivated, repository.UserStatusPendingDeletion}, repository.UserStatusActive, "user-id").
+				Return(nil).Times(1)
+			mockRepository.EXPECT().StoreAuditEvent(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, data *repository.AuditEvent) error {
+					assert.Equal(t, auditAccountReactivated, data.Action)
+					return nil
+				}).Times(1)
+
+			err = srv.VerifyReactivation(c)
+			assert.Nil(t, err, "error should be nil")
+			assert.Equal(t, http.StatusOK, rec.Code)
+		})
+	}
+
+	t.Run("request for an account that cannot be reactivated", func(t *testing.T) {
+		tests := []struct {
+			user *repository.User
+			err  error
+		}{
+			{user: &repository.User{ID: "user-id", Status: repository.UserStatusActive}, err: nil},
+			{user: &repository.User{ID: "user-id", Status: repository.UserStatusSuspended}, err: nil},
+			{user: nil, err: sql.ErrNoRows},
+		}
+
+		for _, tt := range tests {
+			smsLog.Reset()
+			c, rec := newContext("/account/reactivate/request", `{"phone_number": "+622342342322"}`)
+
+			mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(tt.user, tt.err).Times(1)
+
+			err := srv.RequestReactivation(c)
+			assert.Nil(t, err, "error should be nil")
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Empty(t, smsLog.String())
+		}
+	})
+
+	t.Run("verify for an account that cannot be reactivated", func(t *testing.T) {
+		c, rec := newContext("/account/reactivate/verify", `{"phone_number": "+622342342322", "code": "123456"}`)
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").
+			Return(&repository.User{ID: "user-id", Status: repository.UserStatusSuspended}, nil).Times(1)
+
+		err := srv.VerifyReactivation(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), repository.ErrOneTimeCodeInvalid.Error())
+	})
+
+	t.Run("wrong code", func(t *testing.T) {
+		c, rec := newContext("/account/reactivate/verify", `{"phone_number": "+622342342322", "code": "000000"}`)
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").
+			Return(&repository.User{ID: "user-id", Status: repository.UserStatusDeactivated}, nil).Times(1)
+		mockRepository.EXPECT().ConsumeOneTimeCode(gomock.Any(), "user-id", oneTimeCodeReactivation, gomock.Any(), MaxOneTimeCodeAttempts).
+			Return(nil, sql.ErrNoRows).Times(1)
+
+		err := srv.VerifyReactivation(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("payload invalid", func(t *testing.T) {
+		c, rec := newContext("/account/reactivate/verify", `{"phone_number": "+622342342322"}`)
+
+		err := srv.VerifyReactivation(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+var errUserNotFound = errors.New("User is not found")
+
+// UnlockUser lifts the login lockout of a user. It is meant for support
+// tooling, so it needs a client credentials token with the users:unlock scope.
+func (s *Server) UnlockUser(ctx echo.Context, id string) error {
+	var (
+		successResp generated.UnlockUserResponse
+	)
+
+	claims, ok := ClientClaimsFromContext(ctx.Request().Context())
+	if !ok || !hasScope(claims.Scope, ScopeUnlockUsers) {
+		return sendErrorResponse(ctx, http.StatusForbidden, errors.New("Client is not authorized"))
+	}
+
+	if _, err := uuid.Parse(id); err != nil {
+		return sendErrorResponse(ctx, http.StatusNotFound, errUserNotFound)
+	}
+
+	err := s.Repository.UnlockUser(ctx.Request().Context(), id, claims.ClientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sendErrorResponse(ctx, http.StatusNotFound, errUserNotFound)
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	successResp.Result = "unlock user success"
+	return ctx.JSON(http.StatusOK, successResp)
+}
+
+// SetUserStatus suspends a user or lifts the suspension. Only active or
+// deactivated accounts can be suspended, and lifting a suspension makes the
+// account active again. It needs a client credentials token with the
+// users:suspend scope.
+func (s *Server) SetUserStatus(ctx echo.Context, id string) error {
+	var (
+		successResp generated.SetUserStatusResponse
+	)
+
+	claims, ok := ClientClaimsFromContext(ctx.Request().Context())
+	if !ok || !hasScope(claims.Scope, ScopeSuspendUsers) {
+		return sendErrorResponse(ctx, http.StatusForbidden, errors.New("Client is not authorized"))
+	}
+
+	request := &generated.SetUserStatusRequest{}
+	err := json.NewDecoder(ctx.Request().Body).Decode(&request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	var (
+		from   []string
+		action string
+	)
+	switch request.Status {
+	case generated.Suspended:
+		from = []string{repository.UserStatusActive, repository.UserStatusDeactivated}
+		action = auditAccountSuspended
+	case generated.Active:
+		from = []string{repository.UserStatusSuspended}
+		action = auditAccountUnsuspended
+	default:
+		return sendErrorResponse(ctx, http.StatusBadRequest, errors.New("status: must be active or suspended"))
+	}
+
+	err = s.Repository.UpdateUserStatus(ctx.Request().Context(), id, from, string(request.Status), claims.ClientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sendErrorResponse(ctx, http.StatusConflict, errAccountStatusConflict)
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	err = s.recordAuditEvent(ctx, id, action, claims.ClientID)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if request.Status == generated.Suspended {
+		err = s.revokeOtherSessions(ctx.Request().Context(), id, "")
+		if err != nil {
+			return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+		}
+	}
+
+	successResp.Result = "set user status success"
+	return ctx.JSON(http.StatusOK, successResp)
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const testUserID = "3b0f7c1e-8a2d-4c5b-9e6f-1a2b3c4d5e6f"
+
+func TestUnlockUser(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository: mockRepository,
+	}
+
+	newContext := func(claims jwt.Claims) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/admin/users/"+testUserID+"/unlock", nil)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return withClaims(e.NewContext(req, rec), claims), rec
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		c, rec := newContext(&ClientClaims{ClientID: "support", Scope: "users:read users:unlock"})
+
+		mockRepository.EXPECT().UnlockUser(gomock.Any(), testUserID, "support").Return(nil).Times(1)
+
+		err := srv.UnlockUser(c, testUserID)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("client without scope", func(t *testing.T) {
+		c, rec := newContext(&ClientClaims{ClientID: "support", Scope: "users:read"})
+
+		err := srv.UnlockUser(c, testUserID)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("user token", func(t *testing.T) {
+		c, rec := newContext(&Claims{UserID: "user-id", Scope: ScopeUnlockUsers})
+
+		err := srv.UnlockUser(c, testUserID)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		c, rec := newContext(&ClientClaims{ClientID: "support", Scope: ScopeUnlockUsers})
+
+		mockRepository.EXPECT().UnlockUser(gomock.Any(), testUserID, "support").Return(sql.ErrNoRows).Times(1)
+
+		err := srv.UnlockUser(c, testUserID)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("id not a uuid", func(t *testing.T) {
+		c, rec := newContext(&ClientClaims{ClientID: "support", Scope: ScopeUnlockUsers})
+
+		err := srv.UnlockUser(c, "user-id")
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("unlock error", func(t *testing.T) {
+		c, rec := newContext(&ClientClaims{ClientID: "support", Scope: ScopeUnlockUsers})
+
+		mockRepository.EXPECT().UnlockUser(gomock.Any(), testUserID, "support").Return(errors.New("error")).Times(1)
+
+		err := srv.UnlockUser(c, testUserID)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
+
+func TestSetUserStatus(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository:      mockRepository,
+		TokenRevocation: repository.NewMemoryTokenRevocation(),
+	}
+
+	newContext := func(claims jwt.Claims, payload string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPut, "/admin/users/user-id/status", bytes.NewBufferString(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return withClaims(e.NewContext(req, rec), claims), rec
+	}
+
+	supportClaims := &ClientClaims{ClientID: "support", Scope: ScopeSuspendUsers}
+
+	t.Run("suspend", func(t *testing.T) {
+		c, rec := newContext(supportClaims, `{"status": "suspended"}`)
+
+		mockRepository.EXPECT().UpdateUserStatus(gomock.Any(), "user-id",
+			[]string{repository.UserStatusActive, repository.UserStatusDeactivated}, repository.UserStatusSuspended, "support").
+			Return(nil).Times(1)
+		mockRepository.EXPECT().StoreAuditEvent(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, data *repository.AuditEvent) error {
+				assert.Equal(t, auditAccountSuspended, data.Action)
+				assert.Equal(t, "support", data.Detail)
+				return nil
+			}).Times(1)
+		mockRepository.EXPECT().RevokeOtherRefreshTokenFamilies(gomock.Any(), "user-id", "").
+			Return([]string{testSessionID}, nil).Times(1)
+
+		err := srv.SetUserStatus(c, "user-id")
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		revoked, _ := srv.TokenRevocation.IsTokenRevoked(context.Background(), testSessionID)
+		assert.True(t, revoked)
+	})
+
+	t.Run("lift suspension", func(t *testing.T) {
+		c, rec := newContext(supportClaims, `{"status": "active"}`)
+
+		mockRepository.EXPECT().UpdateUserStatus(gomock.Any(), "user-id",
+			[]string{repository.UserStatusSuspended}, repository.UserStatusActive, "support").
+			Return(nil).Times(1)
+		mockRepository.EXPECT().StoreAuditEvent(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		err := srv.SetUserStatus(c, "user-id")
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("status not allowed", func(t *testing.T) {
+		c, rec := newContext(supportClaims, `{"status": "pending_deletion"}`)
+
+		err := srv.SetUserStatus(c, "user-id")
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("transition not allowed", func(t *testing.T) {
+		c, rec := newContext(supportClaims, `{"status": "active"}`)
+
+		mockRepository.EXPECT().UpdateUserStatus(gomock.Any(), "user-id", gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(sql.ErrNoRows).Times(1)
+
+		err := srv.SetUserStatus(c, "user-id")
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("client without scope", func(t *testing.T) {
+		c, rec := newContext(&ClientClaims{ClientID: "support", Scope: ScopeUnlockUsers}, `{"status": "suspended"}`)
+
+		err := srv.SetUserStatus(c, "user-id")
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/notify"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	unfamiliarNetwork = "new_network"
+	unfamiliarDevice  = "new_device"
+)
+
+// AnomalyPolicy flags successful logins whose fingerprint, the network of
+// the client IP and the family of its user agent, matches none of the last
+// Lookback successful logins of the user. The first login of a user is
+// never flagged. The zero policy neither records fingerprints nor flags
+// logins.
+type AnomalyPolicy struct {
+	Lookback int
+	// IPv4PrefixLength and IPv6PrefixLength are the leading bits of an
+	// address that make up its network.
+	IPv4PrefixLength int
+	IPv6PrefixLength int
+	// CheckNetwork and CheckDevice select the parts of the fingerprint a
+	// login is flagged for.
+	CheckNetwork bool
+	CheckDevice  bool
+	// RequireStepUp asks password logins that would be flagged for a code
+	// texted to the user's phone before they complete. Users with an
+	// authenticator app are asked for it anyway.
+	RequireStepUp bool
+}
+
+// DefaultAnomalyPolicy is used unless configured otherwise.
+var DefaultAnomalyPolicy = AnomalyPolicy{
+	Lookback:         20,
+	IPv4PrefixLength: 24,
+	IPv6PrefixLength: 48,
+	CheckNetwork:     true,
+	CheckDevice:      true,
+}
+
+func (p AnomalyPolicy) enabled() bool {
+	return p.Lookback > 0
+}
+
+// fingerprint returns the fingerprint of the client making the request.
+func (p AnomalyPolicy) fingerprint(ctx echo.Context) repository.LoginFingerprint {
+	return repository.LoginFingerprint{
+		IPPrefix:        p.ipPrefix(ctx.RealIP()),
+		UserAgentFamily: deviceLabel(ctx.Request().UserAgent()),
+	}
+}
+
+// ipPrefix returns the network of ip in CIDR notation, empty if ip is not
+// an address.
+func (p AnomalyPolicy) ipPrefix(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+
+	addr = addr.Unmap()
+	bits := p.IPv6PrefixLength
+	if addr.Is4() {
+		bits = p.IPv4PrefixLength
+	}
+
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+
+	return prefix.String()
+}
+
+// unfamiliarLoginReasons compares fingerprint with the recent logins of the
+// user and returns why it is unfamiliar, nothing if it is not.
+func (s *Server) unfamiliarLoginReasons(ctx context.Context, userID string, fingerprint repository.LoginFingerprint) ([]string, error) {
+	if !s.AnomalyPolicy.enabled() {
+		return nil, nil
+	}
+
+	previous, err := s.Repository.ListLoginFingerprints(ctx, userID, s.AnomalyPolicy.Lookback)
+	if err != nil {
+		return nil, err
+	}
+
+	// logins recorded before fingerprinting was enabled tell nothing
+	known, knownNetwork, knownDevice := false, false, false
+	for _, login := range previous {
+		if login.IPPrefix == "" && login.UserAgentFamily == "" {
+			continue
+		}
+
+		known = true
+		knownNetwork = knownNetwork || login.IPPrefix == fingerprint.IPPrefix
+		knownDevice = knownDevice || login.UserAgentFamily == fingerprint.UserAgentFamily
+	}
+
+	if !known {
+		return nil, nil
+	}
+
+	var reasons []string
+	if s.AnomalyPolicy.CheckNetwork && !knownNetwork {
+		reasons = append(reasons, unfamiliarNetwork)
+	}
+
+	if s.AnomalyPolicy.CheckDevice && !knownDevice {
+		reasons = append(reasons, unfamiliarDevice)
+	}
+
+	return reasons, nil
+}
+
+// requireStepUp answers a password login from an unfamiliar fingerprint with
+// an MFA challenge completed by a code texted to the user.
+func (s *Server) requireStepUp(ctx echo.Context, user *repository.User) error {
+	err := s.sendOneTimeCode(ctx.Request().Context(), user, oneTimeCodeStepUp,
+		"Your code to confirm a login from a new device is %s. Do not share it with anyone.")
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	mfaToken, err := s.createMFAChallenge(user, mfaMethodSMS)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	return ctx.JSON(http.StatusAccepted, generated.MFAChallengeResponse{
+		UserId:    user.ID,
+		MfaToken:  mfaToken,
+		MfaMethod: mfaMethodSMS,
+	})
+}
+
+// notifyUnfamiliarLogin tells the user about a flagged login. The login does
+// not depend on it.
+func (s *Server) notifyUnfamiliarLogin(ctx echo.Context, user *repository.User, event *repository.LoginEvent, reasons []string) {
+	if s.Notifier == nil {
+		return
+	}
+
+	err := s.Notifier.NotifyUnfamiliarLogin(ctx.Request().Context(), &notify.UnfamiliarLogin{
+		UserID:      user.ID,
+		PhoneNumber: user.PhoneNumber,
+		DeviceLabel: event.UserAgentFamily,
+		IPAddress:   event.IPAddress,
+		Time:        time.Now(),
+		Reasons:     reasons,
+	})
+	if err != nil {
+		ctx.Logger().Warnf("notify user %s of unfamiliar login: %v", user.ID, err)
+	}
+}
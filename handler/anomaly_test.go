@@ -0,0 +1,253 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/notify"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/sms"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAndroidUserAgent = "Mozilla/5.0 (Linux; Android 13; SM-A536E) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36"
+
+func TestAnomalyPolicyIPPrefix(t *testing.T) {
+	policy := DefaultAnomalyPolicy
+
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{ip: "203.0.113.7", want: "203.0.113.0/24"},
+		{ip: "::ffff:203.0.113.7", want: "203.0.113.0/24"},
+		{ip: "2001:db8:1234:5678::1", want: "2001:db8:1234::/48"},
+		{ip: "", want: ""},
+		{ip: "not-an-ip", want: ""},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, policy.ipPrefix(tt.ip), "ip: %s", tt.ip)
+	}
+}
+
+func TestLoginAnomaly(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	var smsLog, notifyLog bytes.Buffer
+	srv := Server{
+		Repository:      mockRepository,
+		TokenRevocation: repository.NewMemoryTokenRevocation(),
+		KeyRing:         newTestKeyRing(t),
+		PasswordHasher:  newTestPasswordHasher(),
+		SMSSender:       sms.NewLogSender(&smsLog),
+		SecretCipher:    newTestSecretCipher(t),
+		AnomalyPolicy:   DefaultAnomalyPolicy,
+		Notifier:        notify.NewLogNotifier(&notifyLog),
+	}
+
+	hashedPassword, _ := srv.PasswordHasher.Hash([]byte("AAAAAAAAA1a^1"))
+	mockUser := &repository.User{ID: "user-id", PhoneNumber: "+622342342322", Password: hashedPassword}
+	knownFingerprint := &repository.LoginFingerprint{IPPrefix: "203.0.113.0/24", UserAgentFamily: "Chrome on Android"}
+
+	newContext := func(path, payload string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("User-Agent", testAndroidUserAgent)
+		req.RemoteAddr = "198.51.100.9:1234"
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		e.IPExtractor = echo.ExtractIPDirect()
+		return e.NewContext(req, rec), rec
+	}
+
+	loginPayload := `{"phone_number": "+622342342322", "password": "AAAAAAAAA1a^1"}`
+
+	expectLogin := func(fingerprints []*repository.LoginFingerprint, flagged bool) {
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().GetTOTPCredential(gomock.Any(), "user-id").Return(nil, sql.ErrNoRows).Times(1)
+		mockRepository.EXPECT().StoreSession(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().StoreRefreshToken(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().ListLoginFingerprints(gomock.Any(), "user-id", DefaultAnomalyPolicy.Lookback).
+			Return(fingerprints, nil).Times(1)
+		mockRepository.EXPECT().RecordLoginSuccess(gomock.Any(), isLoginEvent("user-id", loginMethodPassword, "")).
+			DoAndReturn(func(_ context.Context, data *repository.LoginEvent) error {
+				assert.Equal(t, "198.51.100.0/24", data.IPPrefix)
+				assert.Equal(t, "Chrome on Android", data.UserAgentFamily)
+				assert.Equal(t, flagged, data.Flagged)
+				return nil
+			}).Times(1)
+	}
+
+	t.Run("familiar", func(t *testing.T) {
+		notifyLog.Reset()
+		c, rec := newContext("/login", loginPayload)
+
+		expectLogin([]*repository.LoginFingerprint{
+			knownFingerprint,
+			{IPPrefix: "198.51.100.0/24", UserAgentFamily: "Firefox on Windows"},
+		}, false)
+
+		err := srv.Login(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, notifyLog.String())
+	})
+
+	t.Run("first login", func(t *testing.T) {
+		notifyLog.Reset()
+		c, rec := newContext("/login", loginPayload)
+
+		// logins from before fingerprinting do not count as history
+		expectLogin([]*repository.LoginFingerprint{{}}, false)
+
+		err := srv.Login(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, notifyLog.String())
+	})
+
+	t.Run("unfamiliar network", func(t *testing.T) {
+		notifyLog.Reset()
+		c, rec := newContext("/login", loginPayload)
+
+		expectLogin([]*repository.LoginFingerprint{knownFingerprint}, true)
+
+		err := srv.Login(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, notifyLog.String(), `user=user-id device="Chrome on Android" ip=198.51.100.9 reasons=new_network`)
+	})
+
+	t.Run("unchecked part of the fingerprint", func(t *testing.T) {
+		notifyLog.Reset()
+		srv.AnomalyPolicy.CheckNetwork = false
+		defer func() { srv.AnomalyPolicy = DefaultAnomalyPolicy }()
+		c, rec := newContext("/login", loginPayload)
+
+		expectLogin([]*repository.LoginFingerprint{knownFingerprint}, false)
+
+		err := srv.Login(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, notifyLog.String())
+	})
+
+	t.Run("step-up", func(t *testing.T) {
+		smsLog.Reset()
+		notifyLog.Reset()
+		srv.AnomalyPolicy.RequireStepUp = true
+		defer func() { srv.AnomalyPolicy = DefaultAnomalyPolicy }()
+		c, rec := newContext("/login", loginPayload)
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().GetTOTPCredential(gomock.Any(), "user-id").Return(nil, sql.ErrNoRows).Times(1)
+		mockRepository.EXPECT().ListLoginFingerprints(gomock.Any(), "user-id", DefaultAnomalyPolicy.Lookback).
+			Return([]*repository.LoginFingerprint{knownFingerprint}, nil).Times(1)
+		mockRepository.EXPECT().StoreOneTimeCode(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, data *repository.OneTimeCode) error {
+				assert.Equal(t, oneTimeCodeStepUp, data.Purpose)
+				return nil
+			}).Times(1)
+
+		err := srv.Login(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+
+		challenge := generated.MFAChallengeResponse{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &challenge)
+		assert.Equal(t, mfaMethodSMS, challenge.MfaMethod)
+		code := regexp.MustCompile(`new device is (\d{6})\.`).FindStringSubmatch(smsLog.String())[1]
+
+		// a wrong recovery code fails like a wrong texted code
+		c, rec = newContext("/login/mfa", `{"mfa_token": "`+challenge.MfaToken+`", "recovery_code": "abcd-efgh"}`)
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().UseRecoveryCode(gomock.Any(), "user-id", gomock.Any()).Return(false, nil).Times(1)
+		mockRepository.EXPECT().RecordLoginFailure(gomock.Any(), isLoginEvent("user-id", loginMethodRecoveryCode, loginFailureInvalidCode), nil).
+			Return(nil).Times(1)
+
+		err = srv.LoginMFA(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+
+		c, rec = newContext("/login/mfa", `{"mfa_token": "`+challenge.MfaToken+`", "code": "`+code+`"}`)
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().ConsumeOneTimeCode(gomock.Any(), "user-id", oneTimeCodeStepUp, hashOneTimeCode("user-id", code), MaxOneTimeCodeAttempts).
+			Return(&repository.OneTimeCode{}, nil).Times(1)
+		mockRepository.EXPECT().StoreSession(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().StoreRefreshToken(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().ListLoginFingerprints(gomock.Any(), "user-id", DefaultAnomalyPolicy.Lookback).
+			Return([]*repository.LoginFingerprint{knownFingerprint}, nil).Times(1)
+		mockRepository.EXPECT().RecordLoginSuccess(gomock.Any(), isLoginEvent("user-id", loginMethodOTP, "")).
+			DoAndReturn(func(_ context.Context, data *repository.LoginEvent) error {
+				assert.True(t, data.Flagged)
+				return nil
+			}).Times(1)
+
+		err = srv.LoginMFA(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, notifyLog.String(), "reasons=new_network")
+	})
+
+	t.Run("step-up with recovery code", func(t *testing.T) {
+		mfaToken, _ := srv.createMFAChallenge(mockUser, mfaMethodSMS)
+		c, rec := newContext("/login/mfa", `{"mfa_token": "`+mfaToken+`", "recovery_code": "3f9kx-q2m7a"}`)
+
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().UseRecoveryCode(gomock.Any(), "user-id", gomock.Any()).Return(true, nil).Times(1)
+		mockRepository.EXPECT().StoreAuditEvent(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, data *repository.AuditEvent) error {
+				assert.Equal(t, auditRecoveryCodeUsed, data.Action)
+				return nil
+			}).Times(1)
+		mockRepository.EXPECT().StoreSession(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().StoreRefreshToken(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().ListLoginFingerprints(gomock.Any(), "user-id", DefaultAnomalyPolicy.Lookback).
+			Return([]*repository.LoginFingerprint{knownFingerprint}, nil).Times(1)
+		mockRepository.EXPECT().RecordLoginSuccess(gomock.Any(), isLoginEvent("user-id", loginMethodRecoveryCode, "")).Return(nil).Times(1)
+
+		err := srv.LoginMFA(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("step-up wrong code", func(t *testing.T) {
+		mfaToken, _ := srv.createMFAChallenge(mockUser, mfaMethodSMS)
+		c, rec := newContext("/login/mfa", `{"mfa_token": "`+mfaToken+`", "code": "000000"}`)
+
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().ConsumeOneTimeCode(gomock.Any(), "user-id", oneTimeCodeStepUp, gomock.Any(), MaxOneTimeCodeAttempts).
+			Return(nil, sql.ErrNoRows).Times(1)
+		mockRepository.EXPECT().RecordLoginFailure(gomock.Any(), isLoginEvent("user-id", loginMethodOTP, loginFailureInvalidCode), nil).
+			Return(nil).Times(1)
+
+		err := srv.LoginMFA(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("no step-up for familiar logins", func(t *testing.T) {
+		srv.AnomalyPolicy.RequireStepUp = true
+		defer func() { srv.AnomalyPolicy = DefaultAnomalyPolicy }()
+		c, rec := newContext("/login", loginPayload)
+
+		knownNetwork := []*repository.LoginFingerprint{{IPPrefix: "198.51.100.0/24", UserAgentFamily: "Chrome on Android"}}
+		mockRepository.EXPECT().ListLoginFingerprints(gomock.Any(), "user-id", DefaultAnomalyPolicy.Lookback).
+			Return(knownNetwork, nil).Times(1)
+		expectLogin(knownNetwork, false)
+
+		err := srv.Login(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// AuthorizeSessionDuration is how long a browser stays signed in at
+	// /authorize, unless its session is revoked earlier.
+	AuthorizeSessionDuration = 24 * time.Hour
+
+	authorizeSessionCookie   = "authorize_session"
+	authorizeSessionAudience = "authorize_session"
+)
+
+//go:embed login_page.html
+var loginPageSource string
+
+var loginPageTemplate = template.Must(template.New("login").Parse(loginPageSource))
+
+// authorizeSessionClaims are the claims of the session cookie signing a
+// browser in at /authorize. Its audience keeps it from being accepted as an
+// access token.
+type authorizeSessionClaims struct {
+	SessionID string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// loginPage are the URLs the login page calls, its script logs in through
+// the JSON API and returns to ReturnTo once the session cookie is set.
+type loginPage struct {
+	LoginURL    string
+	LoginMFAURL string
+	SessionURL  string
+	ReturnTo    string
+}
+
+// StartAuthorizeSession sets the session cookie of /authorize for the
+// session of the bearer token, handing a login made by the login page over
+// to the authorization endpoint. Tokens issued to OAuth clients are refused
+// so that a client can't sign itself in as the user.
+func (s *Server) StartAuthorizeSession(ctx echo.Context) error {
+	var (
+		successResp generated.AuthorizeSessionResponse
+	)
+
+	claims, ok := ClaimsFromContext(ctx.Request().Context())
+	if !ok || !isUserLogin(claims) {
+		return sendErrorResponse(ctx, http.StatusForbidden, errors.New("User is not authorized"))
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(AuthorizeSessionDuration)
+	token, err := s.signToken(&authorizeSessionClaims{
+		SessionID: claims.SessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Issuer:    s.Issuer,
+			Subject:   claims.UserID,
+			Audience:  jwt.ClaimStrings{authorizeSessionAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	})
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	ctx.SetCookie(&http.Cookie{
+		Name:     authorizeSessionCookie,
+		Value:    token,
+		Path:     s.authorizePath(),
+		Expires:  expiresAt,
+		Secure:   strings.HasPrefix(s.Issuer, "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	successResp.Result = "start authorize session success"
+	return ctx.JSON(http.StatusOK, successResp)
+}
+
+// authorizeSession returns the session of the user asking /authorize for a
+// code: the one of the bearer token when the request has an Authorization
+// header, as apps embedding the flow send, or else the one of the session
+// cookie. It returns nil when the browser is not signed in or its session
+// has been signed out since, or the HTTP status and error to respond with.
+// The token has to be one the user got by logging in, as for
+// StartAuthorizeSession.
+func (s *Server) authorizeSession(ctx echo.Context) (*repository.Session, int, error) {
+	var sessionID, userID string
+	if ctx.Request().Header.Get(echo.HeaderAuthorization) != "" {
+		tokenClaims, httpCode, err := s.authenticate(ctx)
+		if err != nil {
+			return nil, httpCode, err
+		}
+
+		claims, ok := tokenClaims.(*Claims)
+		if !ok || !isUserLogin(claims) {
+			return nil, http.StatusForbidden, errors.New("User is not authorized")
+		}
+		sessionID, userID = claims.SessionID, claims.UserID
+	} else {
+		cookie, err := ctx.Cookie(authorizeSessionCookie)
+		if err != nil {
+			return nil, http.StatusOK, nil
+		}
+
+		claims, err := s.verifyAuthorizeSession(ctx.Request().Context(), cookie.Value)
+		if err != nil {
+			if errors.Is(err, errTokenRevocationUnavailable) {
+				return nil, http.StatusInternalServerError, err
+			}
+			// an expired or revoked session means logging in again
+			return nil, http.StatusOK, nil
+		}
+		sessionID, userID = claims.SessionID, claims.Subject
+	}
+
+	if sessionID == "" {
+		return nil, http.StatusOK, nil
+	}
+
+	session, err := s.Repository.GetSession(ctx.Request().Context(), sessionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, http.StatusOK, nil
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if session.UserID != userID || session.SignedOut {
+		return nil, http.StatusOK, nil
+	}
+
+	return session, http.StatusOK, nil
+}
+
+// isUserLogin reports whether the access token was issued to the user by
+// logging in, rather than to an OAuth client acting for the user.
+func isUserLogin(claims *Claims) bool {
+	return claims.Scope == UserTokenScope && claims.SessionID != ""
+}
+
+// verifyAuthorizeSession checks signature, expiry and audience of a session
+// cookie, and that neither it nor its session has been revoked.
+func (s *Server) verifyAuthorizeSession(ctx context.Context, tknStr string) (*authorizeSessionClaims, error) {
+	claims := &authorizeSessionClaims{}
+
+	tkn, err := ParseWithClaims(tknStr, claims, s.verificationKey, jwt.WithValidMethods(AllowedSigningAlgorithms))
+	if err != nil {
+		return nil, err
+	}
+
+	if !tkn.Valid || !claims.VerifyAudience(authorizeSessionAudience, true) || claims.Subject == "" || claims.SessionID == "" {
+		return nil, errors.New("User is not authorized")
+	}
+
+	revoked, err := s.isRevoked(ctx, claims.ID, claims.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errTokenRevocationUnavailable, err)
+	}
+
+	if revoked {
+		return nil, errors.New("User is not authorized")
+	}
+
+	return claims, nil
+}
+
+// renderLoginPage responds with the login page, which comes back to the
+// authorization request once the user logged in. prompt and max_age are
+// left out of it as the login that just happened satisfies them.
+func (s *Server) renderLoginPage(ctx echo.Context) error {
+	query := ctx.Request().URL.Query()
+	query.Del("prompt")
+	query.Del("max_age")
+
+	returnTo := url.URL{Path: s.authorizePath(), RawQuery: query.Encode()}
+	page := &bytes.Buffer{}
+	err := loginPageTemplate.Execute(page, loginPage{
+		LoginURL:    s.Issuer + "/login",
+		LoginMFAURL: s.Issuer + "/login/mfa",
+		SessionURL:  s.Issuer + "/authorize/session",
+		ReturnTo:    returnTo.String(),
+	})
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	header := ctx.Response().Header()
+	header.Set(echo.HeaderCacheControl, "no-store")
+	header.Set(echo.HeaderXFrameOptions, "DENY")
+	header.Set(echo.HeaderContentSecurityPolicy, "frame-ancestors 'none'")
+	return ctx.HTMLBlob(http.StatusOK, page.Bytes())
+}
+
+// authorizePath is the path of /authorize as seen by the browser, below the
+// path of the issuer when the service runs behind a path prefix.
+func (s *Server) authorizePath() string {
+	issuer, err := url.Parse(s.Issuer)
+	if err != nil {
+		return "/authorize"
+	}
+
+	return strings.TrimSuffix(issuer.Path, "/") + "/authorize"
+}
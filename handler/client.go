@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/labstack/echo/v4"
+)
+
+var errClientUnauthorized = errors.New("Client authentication failed")
+
+// authenticateClient checks the credentials of a registered client sent with
+// HTTP Basic (client_secret_basic) or in the form body (client_secret_post).
+func (s *Server) authenticateClient(ctx echo.Context) (*repository.Client, error) {
+	clientID, clientSecret, ok := ctx.Request().BasicAuth()
+	if ok {
+		// RFC 6749 section 2.3.1, credentials are form encoded before Basic
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID = ctx.FormValue("client_id")
+		clientSecret = ctx.FormValue("client_secret")
+	}
+
+	if clientID == "" || clientSecret == "" {
+		return nil, errClientUnauthorized
+	}
+
+	client, err := s.Repository.GetClient(ctx.Request().Context(), clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errClientUnauthorized
+		}
+		return nil, err
+	}
+
+	err = CompareHashAndPassword([]byte(client.SecretHash), []byte(clientSecret))
+	if err != nil {
+		return nil, errClientUnauthorized
+	}
+
+	return client, nil
+}
+
+func sendClientUnauthorized(ctx echo.Context) error {
+	ctx.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="user-service"`)
+	return sendErrorResponse(ctx, http.StatusUnauthorized, errClientUnauthorized)
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	tokenTypeAccessToken  = "access_token"
+	tokenTypeRefreshToken = "refresh_token"
+)
+
+// IntrospectToken tells a registered client whether a token issued by this
+// service is active and who it belongs to, as defined by RFC 7662.
+func (s *Server) IntrospectToken(ctx echo.Context) error {
+	_, err := s.authenticateClient(ctx)
+	if err != nil {
+		if errors.Is(err, errClientUnauthorized) {
+			return sendClientUnauthorized(ctx)
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	tokenString := ctx.FormValue("token")
+	if tokenString == "" {
+		return sendErrorResponse(ctx, http.StatusBadRequest, errors.New("token: can't be empty"))
+	}
+
+	// the hint only decides the lookup order, both types are always tried
+	lookups := []func(context.Context, string) (*generated.IntrospectionResponse, error){
+		s.introspectAccessToken,
+		s.introspectRefreshToken,
+	}
+	if ctx.FormValue("token_type_hint") == tokenTypeRefreshToken {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+
+	for _, lookup := range lookups {
+		resp, err := lookup(ctx.Request().Context(), tokenString)
+		if err != nil {
+			return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+		}
+
+		if resp.Active {
+			return ctx.JSON(http.StatusOK, resp)
+		}
+	}
+
+	return ctx.JSON(http.StatusOK, generated.IntrospectionResponse{Active: false})
+}
+
+// introspectAccessToken only returns an error when the token state cannot be
+// determined, an invalid token is simply reported inactive.
+func (s *Server) introspectAccessToken(ctx context.Context, tokenString string) (*generated.IntrospectionResponse, error) {
+	claims, err := s.verifyAccessToken(ctx, tokenString)
+	if err != nil {
+		if errors.Is(err, errTokenRevocationUnavailable) {
+			return nil, err
+		}
+		return &generated.IntrospectionResponse{Active: false}, nil
+	}
+
+	tokenType := tokenTypeAccessToken
+	resp := &generated.IntrospectionResponse{
+		Active:    true,
+		TokenType: &tokenType,
+	}
+
+	var registered jwt.RegisteredClaims
+	switch claims := claims.(type) {
+	case *Claims:
+		resp.Sub = &claims.UserID
+		resp.Username = &claims.PhoneNumber
+		resp.Scope = &claims.Scope
+		registered = claims.RegisteredClaims
+	case *ClientClaims:
+		resp.Sub = &claims.ClientID
+		resp.ClientId = &claims.ClientID
+		resp.Scope = &claims.Scope
+		registered = claims.RegisteredClaims
+	}
+
+	resp.Jti = &registered.ID
+
+	if registered.ExpiresAt != nil {
+		exp := registered.ExpiresAt.Unix()
+		resp.Exp = &exp
+	}
+
+	if registered.IssuedAt != nil {
+		iat := registered.IssuedAt.Unix()
+		resp.Iat = &iat
+	}
+
+	return resp, nil
+}
+
+func (s *Server) introspectRefreshToken(ctx context.Context, tokenString string) (*generated.IntrospectionResponse, error) {
+	token, err := s.Repository.GetRefreshToken(ctx, hashRefreshToken(tokenString))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &generated.IntrospectionResponse{Active: false}, nil
+		}
+		return nil, err
+	}
+
+	if token.RevokedAt != nil || token.RotatedAt != nil || time.Now().After(token.ExpiresAt) {
+		return &generated.IntrospectionResponse{Active: false}, nil
+	}
+
+	tokenType := tokenTypeRefreshToken
+	exp := token.ExpiresAt.Unix()
+
+	return &generated.IntrospectionResponse{
+		Active:    true,
+		Sub:       &token.UserID,
+		Scope:     &token.Scope,
+		Exp:       &exp,
+		TokenType: &tokenType,
+	}, nil
+}
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestIntrospectToken(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository:      mockRepository,
+		TokenRevocation: repository.NewMemoryTokenRevocation(),
+		KeyRing:         newTestKeyRing(t),
+	}
+
+	secretHash, _ := bcrypt.GenerateFromPassword([]byte("client-secret"), bcrypt.MinCost)
+	mockClient := &repository.Client{
+		ID:         "gateway",
+		Name:       "API Gateway",
+		SecretHash: string(secretHash),
+	}
+
+	newContext := func(form url.Values, clientSecret string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/oauth/introspect", strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		req.SetBasicAuth("gateway", clientSecret)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return e.NewContext(req, rec), rec
+	}
+
+	decode := func(rec *httptest.ResponseRecorder) generated.IntrospectionResponse {
+		var resp generated.IntrospectionResponse
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp
+	}
+
+	accessToken, _ := srv.createJWTToken(&repository.User{ID: "user-id", PhoneNumber: "+622342342322"}, "session-id", UserTokenScope)
+
+	t.Run("active access token", func(t *testing.T) {
+		c, rec := newContext(url.Values{"token": {accessToken}}, "client-secret")
+
+		mockRepository.EXPECT().GetClient(gomock.Any(), "gateway").Return(mockClient, nil).Times(1)
+
+		err := srv.IntrospectToken(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		resp := decode(rec)
+		assert.True(t, resp.Active)
+		assert.Equal(t, "user-id", *resp.Sub)
+		assert.Equal(t, UserTokenScope, *resp.Scope)
+		// the token was issued to the user, not to the client asking
+		assert.Nil(t, resp.ClientId)
+		assert.NotNil(t, resp.Exp)
+	})
+
+	t.Run("active client credentials token", func(t *testing.T) {
+		clientToken, _ := srv.createClientToken(&repository.Client{ID: "billing"}, "users:read")
+		c, rec := newContext(url.Values{"token": {clientToken}}, "client-secret")
+
+		mockRepository.EXPECT().GetClient(gomock.Any(), "gateway").Return(mockClient, nil).Times(1)
+
+		err := srv.IntrospectToken(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		resp := decode(rec)
+		assert.True(t, resp.Active)
+		assert.Equal(t, "billing", *resp.ClientId)
+		assert.Equal(t, "users:read", *resp.Scope)
+	})
+
+	t.Run("active refresh token", func(t *testing.T) {
+		c, rec := newContext(url.Values{"token": {"refresh"}, "token_type_hint": {"refresh_token"}}, "client-secret")
+
+		mockRepository.EXPECT().GetClient(gomock.Any(), gomock.Any()).Return(mockClient, nil).Times(1)
+		mockRepository.EXPECT().GetRefreshToken(gomock.Any(), hashRefreshToken("refresh")).Return(&repository.RefreshToken{
+			UserID:    "user-id",
+			ExpiresAt: time.Now().Add(time.Hour),
+		}, nil).Times(1)
+
+		err := srv.IntrospectToken(c)
+		assert.Nil(t, err, "error should be nil")
+
+		resp := decode(rec)
+		assert.True(t, resp.Active)
+		assert.Equal(t, tokenTypeRefreshToken, *resp.TokenType)
+	})
+
+	t.Run("unknown token is inactive", func(t *testing.T) {
+		c, rec := newContext(url.Values{"token": {"unknown"}}, "client-secret")
+
+		mockRepository.EXPECT().GetClient(gomock.Any(), gomock.Any()).Return(mockClient, nil).Times(1)
+		mockRepository.EXPECT().GetRefreshToken(gomock.Any(), gomock.Any()).Return(nil, sql.ErrNoRows).Times(1)
+
+		err := srv.IntrospectToken(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"active": false}`, rec.Body.String())
+	})
+
+	t.Run("refresh token lookup error", func(t *testing.T) {
+		c, rec := newContext(url.Values{"token": {"unknown"}}, "client-secret")
+
+		mockRepository.EXPECT().GetClient(gomock.Any(), gomock.Any()).Return(mockClient, nil).Times(1)
+		mockRepository.EXPECT().GetRefreshToken(gomock.Any(), gomock.Any()).Return(nil, errors.New("error")).Times(1)
+
+		err := srv.IntrospectToken(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+
+	t.Run("wrong client secret", func(t *testing.T) {
+		c, rec := newContext(url.Values{"token": {accessToken}}, "wrong")
+
+		mockRepository.EXPECT().GetClient(gomock.Any(), gomock.Any()).Return(mockClient, nil).Times(1)
+
+		err := srv.IntrospectToken(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.NotEmpty(t, rec.Header().Get(echo.HeaderWWWAuthenticate))
+	})
+
+	t.Run("unknown client", func(t *testing.T) {
+		c, rec := newContext(url.Values{"token": {accessToken}}, "client-secret")
+
+		mockRepository.EXPECT().GetClient(gomock.Any(), gomock.Any()).Return(nil, sql.ErrNoRows).Times(1)
+
+		err := srv.IntrospectToken(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("token missing", func(t *testing.T) {
+		c, rec := newContext(url.Values{}, "client-secret")
+
+		mockRepository.EXPECT().GetClient(gomock.Any(), gomock.Any()).Return(mockClient, nil).Times(1)
+
+		err := srv.IntrospectToken(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
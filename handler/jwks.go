@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/keyring"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+)
+
+// GetJWKS publishes the public part of every key in the key ring so other
+// services can verify our tokens without holding the private key.
+func (s *Server) GetJWKS(ctx echo.Context) error {
+	var (
+		successResp generated.JSONWebKeySet
+	)
+
+	successResp.Keys = []generated.JSONWebKey{}
+	for _, key := range s.KeyRing.VerificationKeys() {
+		jwk, err := publicJWK(key)
+		if err != nil {
+			return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+		}
+		successResp.Keys = append(successResp.Keys, jwk)
+	}
+
+	return ctx.JSON(http.StatusOK, successResp)
+}
+
+// verificationKey is the jwt.Keyfunc used by ParseWithClaims callers. It picks
+// the public key matching the token's kid header and refuses tokens whose alg
+// is not the one of that key, so a key can never be used with another
+// algorithm (e.g. an RSA public key as HMAC secret).
+func (s *Server) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid")
+	}
+
+	key, err := s.KeyRing.VerificationKey(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+
+	return key.PublicKey, nil
+}
+
+func publicJWK(key *keyring.Key) (generated.JSONWebKey, error) {
+	members, err := keyring.JWK(key.PublicKey)
+	if err != nil {
+		return generated.JSONWebKey{}, err
+	}
+
+	optional := func(name string) *string {
+		value, ok := members[name]
+		if !ok {
+			return nil
+		}
+		return &value
+	}
+
+	jwk := generated.JSONWebKey{
+		Kty: members["kty"],
+		Use: "sig",
+		Alg: key.Algorithm,
+		Kid: key.ID,
+		N:   optional("n"),
+		E:   optional("e"),
+		Crv: optional("crv"),
+		X:   optional("x"),
+		Y:   optional("y"),
+	}
+
+	return jwk, nil
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/keyring"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestKeyRing(t *testing.T) *keyring.KeyRing {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ring := keyring.NewKeyRing(keyring.NewKeyRingOptions{
+		MaxTokenLifetime: AccessTokenDuration,
+	})
+	if _, err := ring.Add(privateKey, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	return ring
+}
+
+func TestGetJWKS(t *testing.T) {
+	srv := Server{
+		KeyRing: newTestKeyRing(t),
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		c := e.NewContext(req, rec)
+
+		err := srv.GetJWKS(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var resp generated.JSONWebKeySet
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Len(t, resp.Keys, 1)
+
+		key, _ := srv.KeyRing.SigningKey()
+		assert.Equal(t, key.ID, resp.Keys[0].Kid)
+		assert.Equal(t, "RS256", resp.Keys[0].Alg)
+	})
+}
+
+func TestVerificationKey(t *testing.T) {
+	srv := Server{
+		KeyRing: newTestKeyRing(t),
+	}
+
+	tokenString, err := srv.createJWTToken(&repository.User{ID: "user-id"}, "session-id", UserTokenScope)
+	assert.Nil(t, err, "error should be nil")
+
+	t.Run("token kid selects key", func(t *testing.T) {
+		claims := &Claims{}
+		tkn, err := jwt.ParseWithClaims(tokenString, claims, srv.verificationKey)
+		assert.Nil(t, err, "error should be nil")
+		assert.True(t, tkn.Valid)
+		assert.Equal(t, "user-id", claims.UserID)
+	})
+
+	t.Run("unknown kid", func(t *testing.T) {
+		_, err := srv.verificationKey(&jwt.Token{Header: map[string]interface{}{"kid": "unknown"}})
+		assert.NotNil(t, err, "error should not be nil")
+	})
+
+	t.Run("alg confusion is rejected", func(t *testing.T) {
+		key, _ := srv.KeyRing.SigningKey()
+		forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{UserID: "attacker"})
+		forged.Header["kid"] = key.ID
+		forgedString, _ := forged.SignedString([]byte("secret"))
+
+		_, err := jwt.ParseWithClaims(forgedString, &Claims{}, srv.verificationKey, jwt.WithValidMethods(AllowedSigningAlgorithms))
+		assert.NotNil(t, err, "error should not be nil")
+
+		// even without the allow-list the key's own algorithm is enforced
+		_, err = srv.verificationKey(forged)
+		assert.NotNil(t, err, "error should not be nil")
+	})
+
+	t.Run("missing kid", func(t *testing.T) {
+		_, err := srv.verificationKey(&jwt.Token{Header: map[string]interface{}{}})
+		assert.NotNil(t, err, "error should not be nil")
+	})
+}
+
+func TestSigningAlgorithms(t *testing.T) {
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	_, ed, _ := ed25519.GenerateKey(rand.Reader)
+
+	for _, signer := range []crypto.Signer{p256, p384, ed} {
+		ring := keyring.NewKeyRing(keyring.NewKeyRingOptions{})
+		key, err := ring.Add(signer, time.Time{})
+		assert.Nil(t, err, "error should be nil")
+
+		srv := Server{
+			KeyRing: ring,
+		}
+
+		t.Run(key.Algorithm, func(t *testing.T) {
+			tokenString, err := srv.createJWTToken(&repository.User{ID: "user-id"}, "session-id", UserTokenScope)
+			assert.Nil(t, err, "error should be nil")
+
+			tkn, err := jwt.ParseWithClaims(tokenString, &Claims{}, srv.verificationKey, jwt.WithValidMethods(AllowedSigningAlgorithms))
+			assert.Nil(t, err, "error should be nil")
+			assert.Equal(t, key.Algorithm, tkn.Method.Alg())
+
+			jwk, err := publicJWK(key)
+			assert.Nil(t, err, "error should be nil")
+			assert.NotNil(t, jwk.Crv)
+			assert.NotNil(t, jwk.X)
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/labstack/echo/v4"
+)
+
+// LockoutPolicy slows down password guessing per user. Every failed login
+// delays the next attempt, Delay after the first failure and doubling with
+// each one. From MaxFailures on the account is locked out for
+// LockoutDuration, doubling with each further failure up to
+// MaxLockoutDuration. A successful login or an admin unlock resets it.
+type LockoutPolicy struct {
+	MaxFailures        int
+	Delay              time.Duration
+	LockoutDuration    time.Duration
+	MaxLockoutDuration time.Duration
+}
+
+// DefaultLockoutPolicy is used unless configured otherwise.
+var DefaultLockoutPolicy = LockoutPolicy{
+	MaxFailures:        5,
+	Delay:              time.Second,
+	LockoutDuration:    15 * time.Minute,
+	MaxLockoutDuration: 24 * time.Hour,
+}
+
+// enabled is false for the zero policy, which does not limit logins.
+func (p LockoutPolicy) enabled() bool {
+	return p.MaxFailures > 0
+}
+
+func (p LockoutPolicy) lockedOut(failures int) bool {
+	return failures >= p.MaxFailures
+}
+
+// backoff returns how long logins are refused after the given number of
+// consecutive failures.
+func (p LockoutPolicy) backoff(failures int) time.Duration {
+	if failures < 1 {
+		return 0
+	}
+
+	base, exponent, max := p.Delay, failures-1, p.LockoutDuration
+	if p.lockedOut(failures) {
+		base, exponent, max = p.LockoutDuration, failures-p.MaxFailures, p.MaxLockoutDuration
+	}
+
+	backoff := float64(base) * math.Pow(2, float64(exponent))
+	if backoff > float64(max) {
+		return max
+	}
+
+	return time.Duration(backoff)
+}
+
+// checkLockout returns the status, 423 or 429, and the time to wait when
+// the user may not attempt to log in yet. The status is 0 otherwise.
+func (s *Server) checkLockout(ctx context.Context, userID string) (int, time.Duration, error) {
+	if !s.LockoutPolicy.enabled() {
+		return 0, 0, nil
+	}
+
+	attempts, err := s.Repository.GetLoginAttempts(ctx, userID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	code, retryAfter := s.LockoutPolicy.status(attempts)
+	return code, retryAfter, nil
+}
+
+// checkUnknownLockout is checkLockout for a phone number that is not
+// registered, so its logins are refused the same way as those of a user.
+func (s *Server) checkUnknownLockout(ctx context.Context, phoneNumber string) (int, time.Duration, error) {
+	if !s.LockoutPolicy.enabled() {
+		return 0, 0, nil
+	}
+
+	attempts, err := s.Repository.GetUnknownLoginAttempts(ctx, phoneNumber)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	code, retryAfter := s.LockoutPolicy.status(attempts)
+	return code, retryAfter, nil
+}
+
+// status returns the status, 423 or 429, and the time to wait when attempts
+// do not allow a login yet. The status is 0 otherwise.
+func (p LockoutPolicy) status(attempts *repository.LoginAttempts) (int, time.Duration) {
+	if attempts.LockedUntil == nil || !time.Now().Before(*attempts.LockedUntil) {
+		return 0, 0
+	}
+
+	retryAfter := time.Until(*attempts.LockedUntil)
+	if p.lockedOut(attempts.FailureCounter) {
+		return http.StatusLocked, retryAfter
+	}
+
+	return http.StatusTooManyRequests, retryAfter
+}
+
+// recordLoginFailure adds the failed attempt to the login history of the
+// user and counts it towards the lockout.
+func (s *Server) recordLoginFailure(ctx echo.Context, userID, method, reason string) error {
+	event := newLoginEvent(ctx, userID, method)
+	event.FailureReason = reason
+
+	var backoff func(failures int) time.Duration
+	if s.LockoutPolicy.enabled() {
+		backoff = s.LockoutPolicy.backoff
+	}
+
+	return s.Repository.RecordLoginFailure(ctx.Request().Context(), event, backoff)
+}
+
+// confirmPassword checks the password of a signed in user before a change
+// of the account. It is rate limited and counts towards the lockout like a
+// login, so that a stolen token does not allow guessing the password. It
+// reports false once it has responded.
+func (s *Server) confirmPassword(ctx echo.Context, user *repository.User, password []byte) (bool, error) {
+	allowed, retryAfter, err := s.checkRateLimit(ctx, "login", user.PhoneNumber)
+	if err != nil {
+		return false, sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if !allowed {
+		return false, sendRateLimitResponse(ctx, retryAfter)
+	}
+
+	lockoutCode, lockoutRetryAfter, err := s.checkLockout(ctx.Request().Context(), user.ID)
+	if err != nil {
+		return false, sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if lockoutCode != 0 {
+		return false, s.rejectLockedOutLogin(ctx, user.ID, loginMethodPassword, lockoutCode, lockoutRetryAfter)
+	}
+
+	err = s.PasswordHasher.Compare(user.Password, password)
+	if err != nil {
+		err = s.recordLoginFailure(ctx, user.ID, loginMethodPassword, loginFailureInvalidPassword)
+		if err != nil {
+			return false, sendErrorResponse(ctx, http.StatusInternalServerError, err)
+		}
+		return false, sendErrorResponse(ctx, http.StatusForbidden, errPasswordInvalid)
+	}
+
+	return true, nil
+}
+
+// rejectUnknownLogin refuses a password login with a phone number that is
+// not registered. It answers like a wrong password of a user, in response,
+// in lockout and in time spent hashing.
+func (s *Server) rejectUnknownLogin(ctx echo.Context, phoneNumber string, password []byte) error {
+	lockoutCode, lockoutRetryAfter, err := s.checkUnknownLockout(ctx.Request().Context(), phoneNumber)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if lockoutCode != 0 {
+		return sendLockoutResponse(ctx, lockoutCode, lockoutRetryAfter)
+	}
+
+	s.PasswordHasher.CompareDummy(password)
+
+	var backoff func(failures int) time.Duration
+	if s.LockoutPolicy.enabled() {
+		backoff = s.LockoutPolicy.backoff
+	}
+
+	err = s.Repository.RecordUnknownLoginFailure(ctx.Request().Context(), phoneNumber, backoff)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	return sendErrorResponse(ctx, http.StatusForbidden, errInvalidCredentials)
+}
+
+// rejectLockedOutLogin refuses a login attempt of a locked out user. The
+// attempt shows in the login history but does not extend the lockout.
+func (s *Server) rejectLockedOutLogin(ctx echo.Context, userID, method string, httpCode int, retryAfter time.Duration) error {
+	event := newLoginEvent(ctx, userID, method)
+	event.FailureReason = loginFailureLockedOut
+
+	err := s.Repository.StoreLoginEvent(ctx.Request().Context(), event)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	return sendLockoutResponse(ctx, httpCode, retryAfter)
+}
+
+func sendLockoutResponse(ctx echo.Context, httpCode int, retryAfter time.Duration) error {
+	message := "Too many failed logins"
+	if httpCode == http.StatusLocked {
+		message = "Account is locked"
+	}
+
+	return sendRetryAfterResponse(ctx, httpCode, message, retryAfter)
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockoutPolicyBackoff(t *testing.T) {
+	policy := DefaultLockoutPolicy
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: 0},
+		{failures: 1, want: time.Second},
+		{failures: 4, want: 8 * time.Second},
+		{failures: 5, want: 15 * time.Minute},
+		{failures: 6, want: 30 * time.Minute},
+		{failures: 20, want: 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, policy.backoff(tt.failures), "failures: %d", tt.failures)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository:     mockRepository,
+		KeyRing:        newTestKeyRing(t),
+		PasswordHasher: newTestPasswordHasher(),
+		LockoutPolicy:  DefaultLockoutPolicy,
+	}
+
+	hashedPassword, _ := srv.PasswordHasher.Hash([]byte("AAAAAAAAA1a^1"))
+	mockUser := &repository.User{ID: "user-id", Password: hashedPassword}
+
+	newContext := func(password string) (echo.Context, *httptest.ResponseRecorder) {
+		payload := `{"phone_number": "+622342342322", "password": "` + password + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return e.NewContext(req, rec), rec
+	}
+
+	t.Run("locked out", func(t *testing.T) {
+		c, rec := newContext("AAAAAAAAA1a^1")
+
+		lockedUntil := time.Now().Add(10 * time.Minute)
+		mockRepository.EXPECT().GetUser(gomock.Any(), gomock.Any()).Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().GetLoginAttempts(gomock.Any(), "user-id").
+			Return(&repository.LoginAttempts{FailureCounter: 5, LockedUntil: &lockedUntil}, nil).Times(1)
+		mockRepository.EXPECT().StoreLoginEvent(gomock.Any(), isLoginEvent("user-id", loginMethodPassword, loginFailureLockedOut)).Return(nil).Times(1)
+
+		err := srv.Login(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusLocked, rec.Code)
+		assert.Equal(t, "600", rec.Header().Get(echo.HeaderRetryAfter))
+		assert.Contains(t, rec.Body.String(), `"retry_after":600`)
+	})
+
+	t.Run("delayed", func(t *testing.T) {
+		c, rec := newContext("AAAAAAAAA1a^1")
+
+		lockedUntil := time.Now().Add(2 * time.Second)
+		mockRepository.EXPECT().GetUser(gomock.Any(), gomock.Any()).Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().GetLoginAttempts(gomock.Any(), "user-id").
+			Return(&repository.LoginAttempts{FailureCounter: 2, LockedUntil: &lockedUntil}, nil).Times(1)
+		mockRepository.EXPECT().StoreLoginEvent(gomock.Any(), isLoginEvent("user-id", loginMethodPassword, loginFailureLockedOut)).Return(nil).Times(1)
+
+		err := srv.Login(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "2", rec.Header().Get(echo.HeaderRetryAfter))
+	})
+
+	t.Run("failure locks out", func(t *testing.T) {
+		c, rec := newContext("AAAAAAAAA1a^2")
+
+		expiredLock := time.Now().Add(-time.Second)
+		attempts := &repository.LoginAttempts{FailureCounter: 4, LockedUntil: &expiredLock}
+		mockRepository.EXPECT().GetUser(gomock.Any(), gomock.Any()).Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().GetLoginAttempts(gomock.Any(), "user-id").Return(attempts, nil).Times(1)
+		mockRepository.EXPECT().RecordLoginFailure(gomock.Any(), isLoginEvent("user-id", loginMethodPassword, loginFailureInvalidPassword), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ *repository.LoginEvent, backoff func(failures int) time.Duration) error {
+				// the repository passes the count including this failure
+				assert.Equal(t, 15*time.Minute, backoff(attempts.FailureCounter+1))
+				return nil
+			}).Times(1)
+
+		err := srv.Login(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("record failure error", func(t *testing.T) {
+		c, rec := newContext("AAAAAAAAA1a^2")
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), gomock.Any()).Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().GetLoginAttempts(gomock.Any(), "user-id").Return(&repository.LoginAttempts{}, nil).Times(1)
+		mockRepository.EXPECT().RecordLoginFailure(gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
+
+		err := srv.Login(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+
+	t.Run("get login attempts error", func(t *testing.T) {
+		c, rec := newContext("AAAAAAAAA1a^1")
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), gomock.Any()).Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().GetLoginAttempts(gomock.Any(), "user-id").Return(nil, errors.New("error")).Times(1)
+
+		err := srv.Login(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
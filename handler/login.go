@@ -1,10 +1,9 @@
 package handler
 
 import (
-	"crypto/rsa"
-	"crypto/x509"
+	"context"
+	"database/sql"
 	"encoding/json"
-	"encoding/pem"
 	"errors"
 	"fmt"
 	"net/http"
@@ -16,14 +15,17 @@ import (
 	"github.com/SawitProRecruitment/UserService/helper"
 	"github.com/SawitProRecruitment/UserService/repository"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
-func (s *Server) Login(ctx echo.Context) error {
-	var (
-		successResp generated.LoginResponse
-	)
+var (
+	errInvalidCredentials    = errors.New("Phone number or password is not valid")
+	errPasswordInvalid       = errors.New("Password is not valid")
+	errSingleUseTokenInvalid = errors.New("Token is not valid")
+)
 
+func (s *Server) Login(ctx echo.Context) error {
 	request := &generated.LoginRequest{}
 	err := json.NewDecoder(ctx.Request().Body).Decode(&request)
 	if err != nil {
@@ -35,55 +37,199 @@ func (s *Server) Login(ctx echo.Context) error {
 		return sendErrorResponse(ctx, http.StatusBadRequest, err)
 	}
 
+	allowed, retryAfter, err := s.checkRateLimit(ctx, "login", request.PhoneNumber)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if !allowed {
+		return sendRateLimitResponse(ctx, retryAfter)
+	}
+
 	// get user by phone_number
 	user, err := s.Repository.GetUser(ctx.Request().Context(), request.PhoneNumber)
 	if err != nil {
-		return sendErrorResponse(ctx, http.StatusNotFound, errors.New("User is not exist"))
+		if errors.Is(err, sql.ErrNoRows) {
+			return s.rejectUnknownLogin(ctx, request.PhoneNumber, []byte(request.Password))
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	lockoutCode, lockoutRetryAfter, err := s.checkLockout(ctx.Request().Context(), user.ID)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if lockoutCode != 0 {
+		return s.rejectLockedOutLogin(ctx, user.ID, loginMethodPassword, lockoutCode, lockoutRetryAfter)
+	}
+
+	err = s.PasswordHasher.Compare(user.Password, []byte(request.Password))
+	if err != nil {
+		err = s.recordLoginFailure(ctx, user.ID, loginMethodPassword, loginFailureInvalidPassword)
+		if err != nil {
+			return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+		}
+		return sendErrorResponse(ctx, http.StatusForbidden, errInvalidCredentials)
+	}
+
+	// the status of an account that is not active is only told once the
+	// password is right
+	if statusErr := accountStatusError(user); statusErr != nil {
+		return sendErrorResponse(ctx, http.StatusForbidden, statusErr)
+	}
+
+	if s.RequirePhoneVerification && user.PhoneVerifiedAt == nil {
+		return sendErrorResponse(ctx, http.StatusForbidden, errPhoneNotVerified)
+	}
+
+	// upgrade hashes made with an outdated scheme or parameters, the login
+	// itself does not depend on it
+	if s.PasswordHasher.NeedsRehash(user.Password) {
+		err = s.rehashPassword(ctx.Request().Context(), user.ID, []byte(request.Password))
+		if err != nil {
+			ctx.Logger().Warnf("rehash password of user %s: %v", user.ID, err)
+		}
+	}
+
+	return s.continueLogin(ctx, user, loginMethodPassword)
+}
+
+// continueLogin completes the login of a user whose first factor, method, is
+// verified, unless the user has an authenticator app or a password login
+// needs a step-up. These users finish the login at /login/mfa.
+func (s *Server) continueLogin(ctx echo.Context, user *repository.User, method string) error {
+	mfaRequired, err := s.hasConfirmedTOTP(ctx.Request().Context(), user.ID)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if mfaRequired {
+		mfaToken, err := s.createMFAChallenge(user, mfaMethodTOTP)
+		if err != nil {
+			return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+		}
+
+		return ctx.JSON(http.StatusAccepted, generated.MFAChallengeResponse{
+			UserId:    user.ID,
+			MfaToken:  mfaToken,
+			MfaMethod: mfaMethodTOTP,
+		})
+	}
+
+	// a code texted for the login already proves the phone is at hand
+	if method == loginMethodPassword && s.AnomalyPolicy.RequireStepUp {
+		reasons, err := s.unfamiliarLoginReasons(ctx.Request().Context(), user.ID, s.AnomalyPolicy.fingerprint(ctx))
+		if err != nil {
+			return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+		}
+
+		if len(reasons) > 0 {
+			return s.requireStepUp(ctx, user)
+		}
+	}
+
+	return s.completeLogin(ctx, user, method)
+}
+
+// completeLogin starts a new session for a user authenticated with method
+// and responds with its tokens.
+func (s *Server) completeLogin(ctx echo.Context, user *repository.User, method string) error {
+	var (
+		successResp generated.LoginResponse
+	)
+
+	sessionID, err := s.startSession(ctx, user.ID, deviceLabel(ctx.Request().UserAgent()), time.Now())
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
 	}
 
-	hashedPassword := []byte(user.Password)
-	err = CompareHashAndPassword(hashedPassword, []byte(request.Password))
+	// create refresh token, starting a new token family for this login
+	refreshToken, err := s.issueRefreshToken(ctx.Request().Context(), user.ID, sessionID, UserTokenScope)
 	if err != nil {
-		return sendErrorResponse(ctx, http.StatusForbidden, errors.New("Password is not valid"))
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
 	}
 
 	// create JWT token
-	token, err := createJWTToken(user)
+	token, err := s.createJWTToken(user, sessionID, UserTokenScope)
 	if err != nil {
 		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
 	}
 
-	// increment login counter
-	err = s.Repository.UpdateLogin(ctx.Request().Context(), user.ID)
+	event := newLoginEvent(ctx, user.ID, method)
+	event.Success = true
+	event.SessionID = sessionID
+
+	var reasons []string
+	if s.AnomalyPolicy.enabled() {
+		event.LoginFingerprint = s.AnomalyPolicy.fingerprint(ctx)
+		reasons, err = s.unfamiliarLoginReasons(ctx.Request().Context(), user.ID, event.LoginFingerprint)
+		if err != nil {
+			return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+		}
+		event.Flagged = len(reasons) > 0
+	}
+
+	err = s.Repository.RecordLoginSuccess(ctx.Request().Context(), event)
 	if err != nil {
 		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
 	}
 
+	if event.Flagged {
+		s.notifyUnfamiliarLogin(ctx, user, event, reasons)
+	}
+
 	successResp.UserId = user.ID
 	successResp.Token = token
+	successResp.RefreshToken = refreshToken
 	return ctx.JSON(http.StatusOK, successResp)
 }
 
-func createJWTToken(user *repository.User) (string, error) {
-	expirationTime := time.Now().Add(5 * time.Minute)
+func (s *Server) rehashPassword(ctx context.Context, userID string, password []byte) error {
+	hashedPwd, err := s.PasswordHasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	return s.Repository.UpdatePassword(ctx, userID, hashedPwd, "system")
+}
+
+func (s *Server) createJWTToken(user *repository.User, sessionID, scope string) (string, error) {
+	return s.signToken(s.newClaims(user, sessionID, scope))
+}
+
+// newClaims builds the access token claims of a user session.
+func (s *Server) newClaims(user *repository.User, sessionID, scope string) *Claims {
+	expirationTime := time.Now().Add(AccessTokenDuration)
 
-	claims := &Claims{
+	return &Claims{
 		UserID:      user.ID,
 		PhoneNumber: user.PhoneNumber,
 		FullName:    user.FullName,
+		SessionID:   sessionID,
+		Scope:       scope,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Issuer:    s.Issuer,
+			Subject:   user.ID,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
 	}
+}
 
-	block, _ := pem.Decode([]byte(PrivateKey))
-	parseResult, _ := x509.ParsePKCS8PrivateKey(block.Bytes)
-	key := parseResult.(*rsa.PrivateKey)
+// signToken signs claims with the active key of the key ring.
+func (s *Server) signToken(claims jwt.Claims) (string, error) {
+	key, err := s.KeyRing.SigningKey()
+	if err != nil {
+		return "", err
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token := jwt.NewWithClaims(key.SigningMethod(), claims)
+	token.Header["kid"] = key.ID
 
 	// Create the JWT string
-	tokenString, err := token.SignedString(key)
+	tokenString, err := token.SignedString(key.PrivateKey)
 	if err != nil {
 		return "", err
 	}
@@ -91,6 +237,32 @@ func createJWTToken(user *repository.User) (string, error) {
 	return tokenString, err
 }
 
+// verifySingleUseToken checks signature, expiry, audience and revocation of
+// a token handed out for one step of a multi-step flow, e.g. an MFA
+// challenge. registered are the registered claims embedded in claims. The
+// caller revokes the token once the step is completed.
+func (s *Server) verifySingleUseToken(ctx context.Context, tknStr, audience string, claims jwt.Claims, registered *jwt.RegisteredClaims) error {
+	tkn, err := ParseWithClaims(tknStr, claims, s.verificationKey, jwt.WithValidMethods(AllowedSigningAlgorithms))
+	if err != nil {
+		return err
+	}
+
+	if !tkn.Valid || !registered.VerifyAudience(audience, true) || registered.ID == "" {
+		return errSingleUseTokenInvalid
+	}
+
+	revoked, err := s.TokenRevocation.IsTokenRevoked(ctx, registered.ID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errTokenRevocationUnavailable, err)
+	}
+
+	if revoked {
+		return errSingleUseTokenInvalid
+	}
+
+	return nil
+}
+
 func validateLogin(request *generated.LoginRequest) error {
 	errStrs := []string{}
 
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	DefaultLoginHistoryLimit = 20
+	MaxLoginHistoryLimit     = 100
+
+	loginMethodPassword     = "password"
+	loginMethodOTP          = "otp"
+	loginMethodPasskey      = "passkey"
+	loginMethodTOTP         = "totp"
+	loginMethodRecoveryCode = "recovery_code"
+
+	loginFailureInvalidPassword = "invalid_password"
+	loginFailureInvalidCode     = "invalid_code"
+	loginFailureInvalidPasskey  = "invalid_passkey"
+	loginFailureLockedOut       = "locked_out"
+)
+
+var errLoginHistoryCursorInvalid = errors.New("cursor: not valid")
+
+// GetLoginHistory returns the login attempts of the user, newest first. The
+// next_cursor of a page fetches the page after it.
+func (s *Server) GetLoginHistory(ctx echo.Context, params generated.GetLoginHistoryParams) error {
+	var (
+		successResp generated.LoginHistoryResponse
+	)
+
+	claims, ok := ClaimsFromContext(ctx.Request().Context())
+	if !ok {
+		return sendErrorResponse(ctx, http.StatusForbidden, errors.New("User is not authorized"))
+	}
+
+	limit := DefaultLoginHistoryLimit
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+
+	if limit < 1 || limit > MaxLoginHistoryLimit {
+		return sendErrorResponse(ctx, http.StatusBadRequest, errors.New("limit: must be between 1 and 100"))
+	}
+
+	var after *repository.LoginEventCursor
+	if params.Cursor != nil {
+		var err error
+		after, err = decodeLoginEventCursor(*params.Cursor)
+		if err != nil {
+			return sendErrorResponse(ctx, http.StatusBadRequest, err)
+		}
+	}
+
+	// one more than asked for tells whether there is a next page
+	events, err := s.Repository.ListLoginEvents(ctx.Request().Context(), claims.UserID, after, limit+1)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if len(events) > limit {
+		events = events[:limit]
+		last := events[limit-1]
+		nextCursor := encodeLoginEventCursor(&repository.LoginEventCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+		successResp.NextCursor = &nextCursor
+	}
+
+	successResp.Events = []generated.LoginEvent{}
+	for _, event := range events {
+		item := generated.LoginEvent{
+			Id:        event.ID,
+			Success:   event.Success,
+			Method:    event.Method,
+			IpAddress: event.IPAddress,
+			UserAgent: event.UserAgent,
+			Flagged:   event.Flagged,
+			CreatedAt: event.CreatedAt,
+		}
+		if event.FailureReason != "" {
+			failureReason := event.FailureReason
+			item.FailureReason = &failureReason
+		}
+		successResp.Events = append(successResp.Events, item)
+	}
+
+	return ctx.JSON(http.StatusOK, successResp)
+}
+
+// newLoginEvent returns a failed login attempt of the user with method from
+// the client making the request.
+func newLoginEvent(ctx echo.Context, userID, method string) *repository.LoginEvent {
+	return &repository.LoginEvent{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Method:    method,
+		IPAddress: ctx.RealIP(),
+		UserAgent: ctx.Request().UserAgent(),
+	}
+}
+
+// encodeLoginEventCursor returns an opaque cursor, the creation time with
+// nanoseconds and the id of the event.
+func encodeLoginEventCursor(cursor *repository.LoginEventCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursor.CreatedAt.UTC().Format(time.RFC3339Nano) + "," + cursor.ID))
+}
+
+func decodeLoginEventCursor(cursor string) (*repository.LoginEventCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errLoginHistoryCursorInvalid
+	}
+
+	createdAt, id, ok := strings.Cut(string(decoded), ",")
+	if !ok {
+		return nil, errLoginHistoryCursorInvalid
+	}
+
+	parsed, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, errLoginHistoryCursorInvalid
+	}
+
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, errLoginHistoryCursorInvalid
+	}
+
+	return &repository.LoginEventCursor{CreatedAt: parsed, ID: id}, nil
+}
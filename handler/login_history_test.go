@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// loginEventMatcher matches the *repository.LoginEvent of an attempt, a
+// successful one when failureReason is empty.
+type loginEventMatcher struct {
+	userID        string
+	method        string
+	failureReason string
+}
+
+func isLoginEvent(userID, method, failureReason string) gomock.Matcher {
+	return loginEventMatcher{userID: userID, method: method, failureReason: failureReason}
+}
+
+func (m loginEventMatcher) Matches(x interface{}) bool {
+	event, ok := x.(*repository.LoginEvent)
+	if !ok {
+		return false
+	}
+
+	return event.ID != "" && event.UserID == m.userID && event.Method == m.method &&
+		event.FailureReason == m.failureReason && event.Success == (m.failureReason == "")
+}
+
+func (m loginEventMatcher) String() string {
+	return fmt.Sprintf("is login event of %s with method %q and failure reason %q", m.userID, m.method, m.failureReason)
+}
+
+func TestGetLoginHistory(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository: mockRepository,
+	}
+
+	newContext := func() (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodGet, "/profile/login-history", nil)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		c := e.NewContext(req, rec)
+		return withClaims(c, &Claims{UserID: "user-id"}), rec
+	}
+
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 123456000, time.UTC)
+	events := []*repository.LoginEvent{
+		{ID: "2b7e1516-28ae-4d2a-a6ab-f7158809cf4f", UserID: "user-id", Success: true, Method: loginMethodPassword, CreatedAt: createdAt},
+		{ID: "1a2b3c4d-5e6f-4a8b-9c0d-1e2f3a4b5c6d", UserID: "user-id", Method: loginMethodPassword,
+			FailureReason: loginFailureInvalidPassword, CreatedAt: createdAt.Add(-time.Minute)},
+		{ID: "0f1e2d3c-4b5a-4978-8695-a4b3c2d1e0f9", UserID: "user-id", Method: loginMethodOTP, CreatedAt: createdAt.Add(-time.Hour)},
+	}
+
+	t.Run("first page", func(t *testing.T) {
+		c, rec := newContext()
+
+		limit := 2
+		mockRepository.EXPECT().ListLoginEvents(gomock.Any(), "user-id", nil, 3).Return(events, nil).Times(1)
+
+		err := srv.GetLoginHistory(c, generated.GetLoginHistoryParams{Limit: &limit})
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		resp := generated.LoginHistoryResponse{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Len(t, resp.Events, 2)
+		assert.True(t, resp.Events[0].Success)
+		assert.Nil(t, resp.Events[0].FailureReason)
+		assert.Equal(t, loginFailureInvalidPassword, *resp.Events[1].FailureReason)
+
+		// the cursor points at the last event of the page
+		cursor, err := decodeLoginEventCursor(*resp.NextCursor)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, events[1].ID, cursor.ID)
+		assert.True(t, events[1].CreatedAt.Equal(cursor.CreatedAt))
+	})
+
+	t.Run("last page", func(t *testing.T) {
+		c, rec := newContext()
+
+		cursor := encodeLoginEventCursor(&repository.LoginEventCursor{CreatedAt: events[1].CreatedAt, ID: events[1].ID})
+		mockRepository.EXPECT().ListLoginEvents(gomock.Any(), "user-id", gomock.Any(), DefaultLoginHistoryLimit+1).
+			DoAndReturn(func(_ interface{}, _ string, after *repository.LoginEventCursor, _ int) ([]*repository.LoginEvent, error) {
+				assert.Equal(t, events[1].ID, after.ID)
+				return events[2:], nil
+			}).Times(1)
+
+		err := srv.GetLoginHistory(c, generated.GetLoginHistoryParams{Cursor: &cursor})
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		resp := generated.LoginHistoryResponse{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Len(t, resp.Events, 1)
+		assert.Nil(t, resp.NextCursor)
+	})
+
+	t.Run("cursor invalid", func(t *testing.T) {
+		for _, cursor := range []string{"%%%", "bm90LWEtY3Vyc29y", encodeLoginEventCursor(&repository.LoginEventCursor{ID: "not-a-uuid"})} {
+			c, rec := newContext()
+
+			err := srv.GetLoginHistory(c, generated.GetLoginHistoryParams{Cursor: &cursor})
+			assert.Nil(t, err, "error should be nil")
+			assert.Equal(t, http.StatusBadRequest, rec.Code, "cursor: %s", cursor)
+		}
+	})
+
+	t.Run("limit out of range", func(t *testing.T) {
+		for _, limit := range []int{0, MaxLoginHistoryLimit + 1} {
+			c, rec := newContext()
+
+			limit := limit
+			err := srv.GetLoginHistory(c, generated.GetLoginHistoryParams{Limit: &limit})
+			assert.Nil(t, err, "error should be nil")
+			assert.Equal(t, http.StatusBadRequest, rec.Code, "limit: %d", limit)
+		}
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		c, rec := newContext()
+
+		mockRepository.EXPECT().ListLoginEvents(gomock.Any(), "user-id", nil, DefaultLoginHistoryLimit+1).
+			Return(nil, errors.New("error")).Times(1)
+
+		err := srv.GetLoginHistory(c, generated.GetLoginHistoryParams{})
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/helper"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	errOTPLoginDisabled      = errors.New("One-time code login is not enabled")
+	errInvalidOTPCredentials = errors.New("Phone number or code is not valid")
+)
+
+// RequestLoginOTP texts a one-time login code to the phone number. The
+// response is the same whether or not the phone number is registered or
+// locked out.
+func (s *Server) RequestLoginOTP(ctx echo.Context) error {
+	var (
+		successResp generated.RequestLoginOTPResponse
+	)
+
+	if !s.EnableOTPLogin {
+		return sendErrorResponse(ctx, http.StatusForbidden, errOTPLoginDisabled)
+	}
+
+	request := &generated.RequestLoginOTPRequest{}
+	err := json.NewDecoder(ctx.Request().Body).Decode(&request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	err = validateLoginPhoneNumber(request.PhoneNumber)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	// every text message costs, so requests take from the login buckets
+	allowed, retryAfter, err := s.checkRateLimit(ctx, "login", request.PhoneNumber)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if !allowed {
+		return sendRateLimitResponse(ctx, retryAfter)
+	}
+
+	successResp.Result = "a login code is sent if the phone number is registered"
+
+	user, err := s.getActiveUser(ctx.Request().Context(), request.PhoneNumber)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ctx.JSON(http.StatusOK, successResp)
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	lockoutCode, _, err := s.checkLockout(ctx.Request().Context(), user.ID)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	// a locked out user gets no code either, the response must not tell
+	if lockoutCode != 0 {
+		return ctx.JSON(http.StatusOK, successResp)
+	}
+
+	err = s.sendOneTimeCode(ctx.Request().Context(), user, oneTimeCodeLogin,
+		"%s is your login code. Do not share it with anyone.")
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	return ctx.JSON(http.StatusOK, successResp)
+}
+
+// VerifyLoginOTP logs in with a code sent by RequestLoginOTP in place of the
+// password. Wrong codes count as failed logins.
+func (s *Server) VerifyLoginOTP(ctx echo.Context) error {
+	if !s.EnableOTPLogin {
+		return sendErrorResponse(ctx, http.StatusForbidden, errOTPLoginDisabled)
+	}
+
+	request := &generated.VerifyLoginOTPRequest{}
+	err := json.NewDecoder(ctx.Request().Body).Decode(&request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	err = validateVerifyLoginOTP(request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	allowed, retryAfter, err := s.checkRateLimit(ctx, "login", request.PhoneNumber)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if !allowed {
+		return sendRateLimitResponse(ctx, retryAfter)
+	}
+
+	user, err := s.getActiveUser(ctx.Request().Context(), request.PhoneNumber)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sendErrorResponse(ctx, http.StatusForbidden, errInvalidOTPCredentials)
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	lockoutCode, lockoutRetryAfter, err := s.checkLockout(ctx.Request().Context(), user.ID)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if lockoutCode != 0 {
+		return s.rejectLockedOutLogin(ctx, user.ID, loginMethodOTP, lockoutCode, lockoutRetryAfter)
+	}
+
+	err = s.verifyOneTimeCode(ctx.Request().Context(), user.ID, oneTimeCodeLogin, request.Code)
+	if err != nil {
+		if !errors.Is(err, repository.ErrOneTimeCodeInvalid) {
+			return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+		}
+
+		err = s.recordLoginFailure(ctx, user.ID, loginMethodOTP, loginFailureInvalidCode)
+		if err != nil {
+			return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+		}
+		return sendErrorResponse(ctx, http.StatusForbidden, errInvalidOTPCredentials)
+	}
+
+	if s.RequirePhoneVerification && user.PhoneVerifiedAt == nil {
+		return sendErrorResponse(ctx, http.StatusForbidden, errPhoneNotVerified)
+	}
+
+	// the code replaces the password, not the authenticator app
+	return s.continueLogin(ctx, user, loginMethodOTP)
+}
+
+func validateVerifyLoginOTP(request *generated.VerifyLoginOTPRequest) error {
+	errStrs := []string{}
+
+	if err := validateLoginPhoneNumber(request.PhoneNumber); err != nil {
+		errStrs = append(errStrs, err.Error())
+	}
+
+	if request.Code == "" {
+		errStrs = append(errStrs, "code: can't be empty")
+	}
+
+	return helper.ErrStringsToErr(errStrs)
+}
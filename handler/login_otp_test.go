@@ -0,0 +1,301 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/ratelimit"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/sms"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestLoginOTP(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	var smsLog bytes.Buffer
+	srv := Server{
+		Repository:     mockRepository,
+		SMSSender:      sms.NewLogSender(&smsLog),
+		EnableOTPLogin: true,
+		LockoutPolicy:  DefaultLockoutPolicy,
+	}
+
+	mockUser := &repository.User{ID: "user-id", PhoneNumber: "+622342342322"}
+
+	newContext := func(payload string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/login/otp/request", bytes.NewBufferString(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return e.NewContext(req, rec), rec
+	}
+
+	payload := `{"phone_number": "+622342342322"}`
+
+	t.Run("positive", func(t *testing.T) {
+		smsLog.Reset()
+		c, rec := newContext(payload)
+
+		var storedCode *repository.OneTimeCode
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().GetLoginAttempts(gomock.Any(), "user-id").Return(&repository.LoginAttempts{}, nil).Times(1)
+		mockRepository.EXPECT().StoreOneTimeCode(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, data *repository.OneTimeCode) error {
+				storedCode = data
+				return nil
+			}).Times(1)
+
+		err := srv.RequestLoginOTP(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		code := regexp.MustCompile(`message="(\d{6}) `).FindStringSubmatch(smsLog.String())[1]
+		assert.Contains(t, smsLog.String(), "to=+622342342322")
+		assert.Equal(t, oneTimeCodeLogin, storedCode.Purpose)
+		assert.Equal(t, hashOneTimeCode("user-id", code), storedCode.CodeHash)
+	})
+
+	t.Run("phone number not registered", func(t *testing.T) {
+		smsLog.Reset()
+		c, rec := newContext(payload)
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(nil, sql.ErrNoRows).Times(1)
+
+		err := srv.RequestLoginOTP(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, smsLog.String())
+	})
+
+	t.Run("locked out", func(t *testing.T) {
+		smsLog.Reset()
+		c, rec := newContext(payload)
+
+		lockedUntil := time.Now().Add(10 * time.Minute)
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().GetLoginAttempts(gomock.Any(), "user-id").
+			Return(&repository.LoginAttempts{FailureCounter: 5, LockedUntil: &lockedUntil}, nil).Times(1)
+
+		err := srv.RequestLoginOTP(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, smsLog.String())
+	})
+
+	t.Run("shares the rate limits of login", func(t *testing.T) {
+		srv := srv
+		srv.RateLimitStore = ratelimit.NewMemoryStore(ratelimit.NewMemoryStoreOptions{})
+		srv.RateLimits = RateLimits{
+			IP:          ratelimit.Limit{Burst: 2, Period: time.Minute},
+			PhoneNumber: ratelimit.Limit{Burst: 1, Period: time.Minute},
+		}
+		srv.PasswordHasher = newTestPasswordHasher()
+
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(`{"phone_number": "+622342342322", "password": "AAAAAAAAA1a^1"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		mockRepository.EXPECT().GetUser(gomock.Any(), gomock.Any()).Return(nil, sql.ErrNoRows).Times(1)
+		mockRepository.EXPECT().GetUnknownLoginAttempts(gomock.Any(), "+622342342322").Return(&repository.LoginAttempts{}, nil).Times(1)
+		mockRepository.EXPECT().RecordUnknownLoginFailure(gomock.Any(), "+622342342322", gomock.Any()).Return(nil).Times(1)
+		_ = srv.Login(echo.New().NewContext(req, rec))
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+
+		c, rec := newContext(payload)
+		err := srv.RequestLoginOTP(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	})
+
+	t.Run("store code error", func(t *testing.T) {
+		c, rec := newContext(payload)
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().GetLoginAttempts(gomock.Any(), "user-id").Return(&repository.LoginAttempts{}, nil).Times(1)
+		mockRepository.EXPECT().StoreOneTimeCode(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
+
+		err := srv.RequestLoginOTP(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+
+	t.Run("payload invalid", func(t *testing.T) {
+		c, rec := newContext(`{"phone_number": ""}`)
+
+		err := srv.RequestLoginOTP(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("not enabled", func(t *testing.T) {
+		c, rec := newContext(payload)
+
+		srv := Server{Repository: mockRepository}
+		err := srv.RequestLoginOTP(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
+
+func TestVerifyLoginOTP(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository:      mockRepository,
+		TokenRevocation: repository.NewMemoryTokenRevocation(),
+		KeyRing:         newTestKeyRing(t),
+		EnableOTPLogin:  true,
+		LockoutPolicy:   DefaultLockoutPolicy,
+	}
+
+	mockUser := &repository.User{ID: "user-id", FullName: "sadam", PhoneNumber: "+622342342322"}
+
+	newContext := func(payload string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/login/otp/verify", bytes.NewBufferString(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return e.NewContext(req, rec), rec
+	}
+
+	payload := `{"phone_number": "+622342342322", "code": "123456"}`
+
+	t.Run("positive", func(t *testing.T) {
+		c, rec := newContext(payload)
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().GetLoginAttempts(gomock.Any(), "user-id").Return(&repository.LoginAttempts{}, nil).Times(1)
+		mockRepository.EXPECT().ConsumeOneTimeCode(gomock.Any(), "user-id", oneTimeCodeLogin, hashOneTimeCode("user-id", "123456"), MaxOneTimeCodeAttempts).
+			Return(&repository.OneTimeCode{}, nil).Times(1)
+		mockRepository.EXPECT().GetTOTPCredential(gomock.Any(), "user-id").Return(nil, sql.ErrNoRows).Times(1)
+		mockRepository.EXPECT().StoreSession(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().StoreRefreshToken(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().RecordLoginSuccess(gomock.Any(), isLoginEvent("user-id", loginMethodOTP, "")).Return(nil).Times(1)
+
+		err := srv.VerifyLoginOTP(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		resp := generated.LoginResponse{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Equal(t, "user-id", resp.UserId)
+		assert.NotEmpty(t, resp.Token)
+		assert.NotEmpty(t, resp.RefreshToken)
+	})
+
+	t.Run("authenticator app required", func(t *testing.T) {
+		c, rec := newContext(payload)
+
+		confirmedAt := time.Now()
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().GetLoginAttempts(gomock.Any(), "user-id").Return(&repository.LoginAttempts{}, nil).Times(1)
+		mockRepository.EXPECT().ConsumeOneTimeCode(gomock.Any(), "user-id", oneTimeCodeLogin, gomock.Any(), MaxOneTimeCodeAttempts).
+			Return(&repository.OneTimeCode{}, nil).Times(1)
+		mockRepository.EXPECT().GetTOTPCredential(gomock.Any(), "user-id").
+			Return(&repository.TOTPCredential{UserID: "user-id", ConfirmedAt: &confirmedAt}, nil).Times(1)
+
+		err := srv.VerifyLoginOTP(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"mfa_token"`)
+	})
+
+	t.Run("code invalid", func(t *testing.T) {
+		c, rec := newContext(payload)
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().GetLoginAttempts(gomock.Any(), "user-id").Return(&repository.LoginAttempts{}, nil).Times(1)
+		mockRepository.EXPECT().ConsumeOneTimeCode(gomock.Any(), "user-id", oneTimeCodeLogin, gomock.Any(), MaxOneTimeCodeAttempts).
+			Return(nil, repository.ErrOneTimeCodeInvalid).Times(1)
+		mockRepository.EXPECT().RecordLoginFailure(gomock.Any(), isLoginEvent("user-id", loginMethodOTP, loginFailureInvalidCode), gomock.Any()).Return(nil).Times(1)
+
+		err := srv.VerifyLoginOTP(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), errInvalidOTPCredentials.Error())
+	})
+
+	t.Run("no pending code", func(t *testing.T) {
+		c, rec := newContext(payload)
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().GetLoginAttempts(gomock.Any(), "user-id").Return(&repository.LoginAttempts{}, nil).Times(1)
+		mockRepository.EXPECT().ConsumeOneTimeCode(gomock.Any(), "user-id", oneTimeCodeLogin, gomock.Any(), MaxOneTimeCodeAttempts).
+			Return(nil, sql.ErrNoRows).Times(1)
+		mockRepository.EXPECT().RecordLoginFailure(gomock.Any(), isLoginEvent("user-id", loginMethodOTP, loginFailureInvalidCode), gomock.Any()).Return(nil).Times(1)
+
+		err := srv.VerifyLoginOTP(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("locked out", func(t *testing.T) {
+		c, rec := newContext(payload)
+
+		lockedUntil := time.Now().Add(10 * time.Minute)
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().GetLoginAttempts(gomock.Any(), "user-id").
+			Return(&repository.LoginAttempts{FailureCounter: 5, LockedUntil: &lockedUntil}, nil).Times(1)
+		mockRepository.EXPECT().StoreLoginEvent(gomock.Any(), isLoginEvent("user-id", loginMethodOTP, loginFailureLockedOut)).Return(nil).Times(1)
+
+		err := srv.VerifyLoginOTP(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusLocked, rec.Code)
+		assert.Equal(t, "600", rec.Header().Get(echo.HeaderRetryAfter))
+	})
+
+	t.Run("phone number not verified", func(t *testing.T) {
+		c, rec := newContext(payload)
+
+		srv := srv
+		srv.RequirePhoneVerification = true
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().GetLoginAttempts(gomock.Any(), "user-id").Return(&repository.LoginAttempts{}, nil).Times(1)
+		mockRepository.EXPECT().ConsumeOneTimeCode(gomock.Any(), "user-id", oneTimeCodeLogin, gomock.Any(), MaxOneTimeCodeAttempts).
+			Return(&repository.OneTimeCode{}, nil).Times(1)
+
+		err := srv.VerifyLoginOTP(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), errPhoneNotVerified.Error())
+	})
+
+	t.Run("phone number not registered", func(t *testing.T) {
+		c, rec := newContext(payload)
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(nil, sql.ErrNoRows).Times(1)
+
+		err := srv.VerifyLoginOTP(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), errInvalidOTPCredentials.Error())
+	})
+
+	t.Run("payload invalid", func(t *testing.T) {
+		c, rec := newContext(`{"phone_number": "abc", "code": ""}`)
+
+		err := srv.VerifyLoginOTP(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("not enabled", func(t *testing.T) {
+		c, rec := newContext(payload)
+
+		srv := Server{Repository: mockRepository}
+		err := srv.VerifyLoginOTP(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
@@ -2,29 +2,54 @@ package handler
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/password"
 	"github.com/SawitProRecruitment/UserService/repository"
 	"github.com/golang/mock/gomock"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// testArgon2id has cheaper parameters than the default to keep tests fast.
+var testArgon2id = password.Argon2id{
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// newTestPasswordHasher hashes with argon2id and accepts bcrypt hashes the way
+// main configures it.
+func newTestPasswordHasher() *password.Hasher {
+	return password.NewHasher(testArgon2id, password.Bcrypt{Cost: bcrypt.MinCost})
+}
+
 func TestLogin(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
 	srv := Server{
-		Repository: mockRepository,
+		Repository:     mockRepository,
+		KeyRing:        newTestKeyRing(t),
+		PasswordHasher: newTestPasswordHasher(),
 	}
 	var param generated.LoginRequest
 
+	hashedPassword, _ := srv.PasswordHasher.Hash([]byte("AAAAAAAAA1a^1"))
 	mockUser := repository.User{
+		ID:       "user-id",
 		FullName: "sadam",
+		Password: hashedPassword,
 	}
 	t.Run("positive", func(t *testing.T) {
 		payload := []byte(
@@ -44,16 +69,19 @@ func TestLogin(t *testing.T) {
 
 		mockRepository.EXPECT().GetUser(gomock.Any(), gomock.Any()).Return(&mockUser, nil).Times(1)
 
-		tempCompareHashAndPassword := CompareHashAndPassword
-		CompareHashAndPassword = func(hashedPassword, password []byte) error {
-			return nil
-		}
-
-		defer func() {
-			CompareHashAndPassword = tempCompareHashAndPassword
-		}()
-
-		mockRepository.EXPECT().UpdateLogin(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().GetTOTPCredential(gomock.Any(), gomock.Any()).Return(nil, sql.ErrNoRows).Times(1)
+		var session *repository.Session
+		mockRepository.EXPECT().StoreSession(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, data *repository.Session) error {
+				session = data
+				return nil
+			}).Times(1)
+		mockRepository.EXPECT().StoreRefreshToken(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().RecordLoginSuccess(gomock.Any(), isLoginEvent("user-id", loginMethodPassword, "")).
+			DoAndReturn(func(_ context.Context, data *repository.LoginEvent) error {
+				assert.Equal(t, session.ID, data.SessionID)
+				return nil
+			}).Times(1)
 
 		err := srv.Login(c)
 		assert.Nil(t, err, "error should be nil")
@@ -77,19 +105,40 @@ func TestLogin(t *testing.T) {
 
 		mockRepository.EXPECT().GetUser(gomock.Any(), gomock.Any()).Return(&mockUser, nil).Times(1)
 
-		tempCompareHashAndPassword := CompareHashAndPassword
-		CompareHashAndPassword = func(hashedPassword, password []byte) error {
-			return nil
-		}
+		mockRepository.EXPECT().GetTOTPCredential(gomock.Any(), gomock.Any()).Return(nil, sql.ErrNoRows).Times(1)
+		mockRepository.EXPECT().StoreSession(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().StoreRefreshToken(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().RecordLoginSuccess(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
 
-		defer func() {
-			CompareHashAndPassword = tempCompareHashAndPassword
-		}()
+		err := srv.Login(c)
+		assert.Nil(t, err, "error should be nil")
+	})
 
-		mockRepository.EXPECT().UpdateLogin(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
+	t.Run("store refresh token error", func(t *testing.T) {
+		payload := []byte(
+			`{
+				"phone_number": "+622342342322",
+				"password":     "AAAAAAAAA1a^1"
+			}`)
+
+		paramBytes := payload
+		_ = json.Unmarshal(paramBytes, &param)
+
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(paramBytes))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), gomock.Any()).Return(&mockUser, nil).Times(1)
+
+		mockRepository.EXPECT().GetTOTPCredential(gomock.Any(), gomock.Any()).Return(nil, sql.ErrNoRows).Times(1)
+		mockRepository.EXPECT().StoreSession(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().StoreRefreshToken(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
 
 		err := srv.Login(c)
 		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
 	})
 
 	t.Run("decode request error", func(t *testing.T) {
@@ -132,13 +181,98 @@ func TestLogin(t *testing.T) {
 		assert.Nil(t, err, "error should be nil")
 	})
 
-	t.Run("CompareHashAndPassword error", func(t *testing.T) {
+	t.Run("outdated hash is upgraded", func(t *testing.T) {
 		payload := []byte(
 			`{
 				"phone_number": "+622342342322",
 				"password":     "AAAAAAAAA1a^1"
 			}`)
 
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		c := e.NewContext(req, rec)
+
+		legacyHash, _ := bcrypt.GenerateFromPassword([]byte("AAAAAAAAA1a^1"), bcrypt.MinCost)
+		legacyUser := mockUser
+		legacyUser.Password = string(legacyHash)
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), gomock.Any()).Return(&legacyUser, nil).Times(1)
+		mockRepository.EXPECT().UpdatePassword(gomock.Any(), "user-id", gomock.Any(), "system").
+			DoAndReturn(func(_ context.Context, _, hashedPassword, _ string) error {
+				assert.False(t, srv.PasswordHasher.NeedsRehash(hashedPassword))
+				return nil
+			}).Times(1)
+		mockRepository.EXPECT().GetTOTPCredential(gomock.Any(), gomock.Any()).Return(nil, sql.ErrNoRows).Times(1)
+		mockRepository.EXPECT().StoreSession(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().StoreRefreshToken(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().RecordLoginSuccess(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		err := srv.Login(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("upgrading outdated hash fails", func(t *testing.T) {
+		payload := []byte(
+			`{
+				"phone_number": "+622342342322",
+				"password":     "AAAAAAAAA1a^1"
+			}`)
+
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		c := e.NewContext(req, rec)
+
+		legacyHash, _ := bcrypt.GenerateFromPassword([]byte("AAAAAAAAA1a^1"), bcrypt.MinCost)
+		legacyUser := mockUser
+		legacyUser.Password = string(legacyHash)
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), gomock.Any()).Return(&legacyUser, nil).Times(1)
+		mockRepository.EXPECT().UpdatePassword(gomock.Any(), "user-id", gomock.Any(), "system").Return(errors.New("error")).Times(1)
+		mockRepository.EXPECT().GetTOTPCredential(gomock.Any(), gomock.Any()).Return(nil, sql.ErrNoRows).Times(1)
+		mockRepository.EXPECT().StoreSession(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().StoreRefreshToken(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().RecordLoginSuccess(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		err := srv.Login(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("phone number not verified", func(t *testing.T) {
+		payload := []byte(
+			`{
+				"phone_number": "+622342342322",
+				"password":     "AAAAAAAAA1a^1"
+			}`)
+
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		c := e.NewContext(req, rec)
+
+		verifyingSrv := srv
+		verifyingSrv.RequirePhoneVerification = true
+		mockRepository.EXPECT().GetUser(gomock.Any(), gomock.Any()).Return(&mockUser, nil).Times(1)
+
+		err := verifyingSrv.Login(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), errPhoneNotVerified.Error())
+	})
+
+	t.Run("CompareHashAndPassword error", func(t *testing.T) {
+		payload := []byte(
+			`{
+				"phone_number": "+622342342322",
+				"password":     "AAAAAAAAA1a^2"
+			}`)
+
 		paramBytes := payload
 		_ = json.Unmarshal(paramBytes, &param)
 
@@ -149,9 +283,12 @@ func TestLogin(t *testing.T) {
 		c := e.NewContext(req, rec)
 
 		mockRepository.EXPECT().GetUser(gomock.Any(), gomock.Any()).Return(&mockUser, nil).Times(1)
+		mockRepository.EXPECT().RecordLoginFailure(gomock.Any(), isLoginEvent(mockUser.ID, loginMethodPassword, loginFailureInvalidPassword), nil).
+			Return(nil).Times(1)
 
 		err := srv.Login(c)
 		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
 	})
 
 	t.Run("GetUser error", func(t *testing.T) {
@@ -174,6 +311,154 @@ func TestLogin(t *testing.T) {
 
 		err := srv.Login(c)
 		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
 	})
 
 }
+
+func TestLoginAccountStatus(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository:     mockRepository,
+		KeyRing:        newTestKeyRing(t),
+		PasswordHasher: newTestPasswordHasher(),
+	}
+
+	hashedPassword, _ := srv.PasswordHasher.Hash([]byte("AAAAAAAAA1a^1"))
+	newContext := func(password string) (echo.Context, *httptest.ResponseRecorder) {
+		payload := `{"phone_number": "+622342342322", "password": "` + password + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return e.NewContext(req, rec), rec
+	}
+
+	tests := []struct {
+		name   string
+		status string
+		want   error
+	}{
+		{name: "deactivated", status: repository.UserStatusDeactivated, want: errAccountDeactivated},
+		{name: "suspended", status: repository.UserStatusSuspended, want: errAccountSuspended},
+		{name: "pending deletion", status: repository.UserStatusPendingDeletion, want: errAccountPendingDeletion},
+	}
+
+	for _, tt := range tests {
+		mockUser := &repository.User{ID: "user-id", Password: hashedPassword, Status: tt.status}
+
+		t.Run(tt.name, func(t *testing.T) {
+			c, rec := newContext("AAAAAAAAA1a^1")
+
+			mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(mockUser, nil).Times(1)
+
+			err := srv.Login(c)
+			assert.Nil(t, err, "error should be nil")
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.want.Error())
+		})
+
+		t.Run(tt.name+" with wrong password", func(t *testing.T) {
+			c, rec := newContext("AAAAAAAAA1a^2")
+
+			mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(mockUser, nil).Times(1)
+			mockRepository.EXPECT().RecordLoginFailure(gomock.Any(), isLoginEvent("user-id", loginMethodPassword, loginFailureInvalidPassword), nil).
+				Return(nil).Times(1)
+
+			err := srv.Login(c)
+			assert.Nil(t, err, "error should be nil")
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.Contains(t, rec.Body.String(), errInvalidCredentials.Error())
+		})
+	}
+}
+
+// slowScheme makes every password comparison take at least delay.
+type slowScheme struct {
+	password.Scheme
+	delay time.Duration
+}
+
+func (s slowScheme) Compare(hash string, password []byte) error {
+	time.Sleep(s.delay)
+	return s.Scheme.Compare(hash, password)
+}
+
+func TestLoginUserEnumeration(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	current := slowScheme{Scheme: testArgon2id, delay: 50 * time.Millisecond}
+	legacy := slowScheme{Scheme: password.Bcrypt{Cost: bcrypt.MinCost}, delay: 50 * time.Millisecond}
+	srv := Server{
+		Repository:     mockRepository,
+		PasswordHasher: password.NewHasher(current, legacy),
+		LockoutPolicy:  DefaultLockoutPolicy,
+	}
+
+	// the user still has a hash of the legacy scheme
+	legacyHash, _ := legacy.Hash([]byte("AAAAAAAAA1a^1"))
+	mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").
+		Return(&repository.User{ID: "user-id", Password: legacyHash}, nil).AnyTimes()
+	mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342323").Return(nil, sql.ErrNoRows).AnyTimes()
+
+	// both kinds of attempts are counted the way the repository does
+	userAttempts, unknownAttempts := &repository.LoginAttempts{}, &repository.LoginAttempts{}
+	recordFailure := func(attempts *repository.LoginAttempts, backoff func(failures int) time.Duration) {
+		attempts.FailureCounter++
+		lockedUntil := time.Now().Add(backoff(attempts.FailureCounter))
+		attempts.LockedUntil = &lockedUntil
+	}
+	mockRepository.EXPECT().GetLoginAttempts(gomock.Any(), "user-id").Return(userAttempts, nil).AnyTimes()
+	mockRepository.EXPECT().RecordLoginFailure(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ *repository.LoginEvent, backoff func(failures int) time.Duration) error {
+			recordFailure(userAttempts, backoff)
+			return nil
+		}).AnyTimes()
+	mockRepository.EXPECT().StoreLoginEvent(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	mockRepository.EXPECT().GetUnknownLoginAttempts(gomock.Any(), "+622342342323").Return(unknownAttempts, nil).AnyTimes()
+	mockRepository.EXPECT().RecordUnknownLoginFailure(gomock.Any(), "+622342342323", gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, backoff func(failures int) time.Duration) error {
+			recordFailure(unknownAttempts, backoff)
+			return nil
+		}).AnyTimes()
+
+	login := func(phoneNumber string) (*httptest.ResponseRecorder, time.Duration) {
+		payload := `{"phone_number": "` + phoneNumber + `", "password": "AAAAAAAAA1a^2"}`
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		c := e.NewContext(req, rec)
+
+		start := time.Now()
+		err := srv.Login(c)
+		assert.Nil(t, err, "error should be nil")
+		return rec, time.Since(start)
+	}
+
+	wrongPasswordRec, wrongPasswordDuration := login("+622342342322")
+	unknownUserRec, unknownUserDuration := login("+622342342323")
+
+	t.Run("same response", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, unknownUserRec.Code)
+		assert.Equal(t, wrongPasswordRec.Code, unknownUserRec.Code)
+		assert.Equal(t, wrongPasswordRec.Body.String(), unknownUserRec.Body.String())
+	})
+
+	t.Run("same hashing time", func(t *testing.T) {
+		// every scheme is compared, whichever made the hash of the user
+		assert.GreaterOrEqual(t, wrongPasswordDuration, current.delay+legacy.delay)
+		assert.GreaterOrEqual(t, unknownUserDuration, current.delay+legacy.delay)
+	})
+
+	t.Run("same response to repeated attempts", func(t *testing.T) {
+		wrongPasswordRec, _ := login("+622342342322")
+		unknownUserRec, _ := login("+622342342323")
+
+		assert.Equal(t, http.StatusTooManyRequests, unknownUserRec.Code)
+		assert.Equal(t, wrongPasswordRec.Code, unknownUserRec.Code)
+		assert.Equal(t, wrongPasswordRec.Header().Get(echo.HeaderRetryAfter), unknownUserRec.Header().Get(echo.HeaderRetryAfter))
+		assert.Equal(t, wrongPasswordRec.Body.String(), unknownUserRec.Body.String())
+	})
+}
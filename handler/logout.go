@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/labstack/echo/v4"
+)
+
+// Logout revokes the presented access token until it expires, and the refresh
+// tokens and other access tokens of its session, so none can be used again.
+func (s *Server) Logout(ctx echo.Context) error {
+	var (
+		successResp generated.LogoutResponse
+	)
+
+	claims, ok := ClaimsFromContext(ctx.Request().Context())
+	if !ok || claims.ID == "" || claims.ExpiresAt == nil {
+		return sendErrorResponse(ctx, http.StatusForbidden, errors.New("User is not authorized"))
+	}
+
+	err := s.TokenRevocation.RevokeToken(ctx.Request().Context(), claims.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if claims.SessionID != "" {
+		err = s.Repository.RevokeRefreshTokenFamily(ctx.Request().Context(), claims.SessionID)
+		if err != nil {
+			return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+		}
+
+		err = s.revokeSessionTokens(ctx.Request().Context(), claims.SessionID)
+		if err != nil {
+			return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+		}
+	}
+
+	successResp.Result = "logout success"
+	return ctx.JSON(http.StatusOK, successResp)
+}
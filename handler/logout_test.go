@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogout(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository:      mockRepository,
+		TokenRevocation: repository.NewMemoryTokenRevocation(),
+	}
+
+	newContext := func() (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		claims := &Claims{
+			UserID:    "user-id",
+			SessionID: "session-id",
+			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        "token-id",
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+		}
+		return withClaims(e.NewContext(req, rec), claims), rec
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		c, rec := newContext()
+
+		mockRepository.EXPECT().RevokeRefreshTokenFamily(gomock.Any(), "session-id").Return(nil).Times(1)
+
+		err := srv.Logout(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		revoked, _ := srv.TokenRevocation.IsTokenRevoked(c.Request().Context(), "token-id")
+		assert.True(t, revoked)
+
+		// other access tokens of the session are revoked through its id
+		revoked, _ = srv.TokenRevocation.IsTokenRevoked(c.Request().Context(), "session-id")
+		assert.True(t, revoked)
+	})
+
+	t.Run("revoke refresh token family error", func(t *testing.T) {
+		c, rec := newContext()
+
+		mockRepository.EXPECT().RevokeRefreshTokenFamily(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
+
+		err := srv.Logout(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+
+	t.Run("claims missing", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		c := e.NewContext(req, rec)
+
+		err := srv.Logout(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// BearerAuthScheme is the name of the security scheme in api.yml that marks
+// an operation as requiring a bearer token.
+const BearerAuthScheme = "bearerAuth"
+
+type claimsContextKey struct{}
+
+var errTokenRevocationUnavailable = errors.New("token revocation store is unavailable")
+
+var pathParamPattern = regexp.MustCompile(`\{([^}]+)\}`)
+
+// Authenticate returns an Echo middleware validating the bearer token of every
+// operation that declares the bearerAuth security scheme in the spec. The
+// claims of a valid token are available through ClaimsFromContext for user
+// tokens and ClientClaimsFromContext for client credentials tokens.
+func (s *Server) Authenticate(swagger *openapi3.T) echo.MiddlewareFunc {
+	protected := protectedRoutes(swagger)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			if !protected[routeKey(ctx.Request().Method, ctx.Path())] {
+				return next(ctx)
+			}
+
+			claims, httpCode, err := s.authenticate(ctx)
+			if err != nil {
+				return sendErrorResponse(ctx, httpCode, err)
+			}
+
+			reqCtx := context.WithValue(ctx.Request().Context(), claimsContextKey{}, claims)
+			ctx.SetRequest(ctx.Request().WithContext(reqCtx))
+			return next(ctx)
+		}
+	}
+}
+
+// ClaimsFromContext returns the claims stored by the Authenticate middleware.
+// It reports false for tokens that were not issued on behalf of a user.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+	return claims, ok
+}
+
+// ClientClaimsFromContext returns the claims stored by the Authenticate
+// middleware when the request was made with a client credentials token.
+func ClientClaimsFromContext(ctx context.Context) (*ClientClaims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*ClientClaims)
+	return claims, ok
+}
+
+// authenticate validates the bearer token of the request and returns its
+// claims, or the HTTP status and error to respond with.
+func (s *Server) authenticate(ctx echo.Context) (jwt.Claims, int, error) {
+	authHeader := ctx.Request().Header.Get(echo.HeaderAuthorization)
+	splittedAuth := strings.Split(authHeader, " ")
+	if len(splittedAuth) < 2 || !strings.EqualFold(splittedAuth[0], "Bearer") {
+		return nil, http.StatusBadRequest, errors.New("Auth header is not valid")
+	}
+
+	claims, err := s.verifyAccessToken(ctx.Request().Context(), splittedAuth[1])
+	if err != nil {
+		if errors.Is(err, errTokenRevocationUnavailable) {
+			return nil, http.StatusInternalServerError, err
+		}
+		return nil, http.StatusForbidden, err
+	}
+
+	return claims, http.StatusOK, nil
+}
+
+// accessTokenClaims decodes both kinds of access tokens, only client
+// credentials tokens carry a client_id claim.
+type accessTokenClaims struct {
+	Claims
+	ClientID string `json:"client_id"`
+}
+
+// verifyAccessToken checks signature, expiry and revocation of an access
+// token and returns either its *Claims or its *ClientClaims.
+func (s *Server) verifyAccessToken(ctx context.Context, tknStr string) (jwt.Claims, error) {
+	claims := &accessTokenClaims{}
+
+	tkn, err := ParseWithClaims(tknStr, claims, s.verificationKey, jwt.WithValidMethods(AllowedSigningAlgorithms))
+	if err != nil {
+		if errors.Is(err, jwt.ErrSignatureInvalid) {
+			return nil, errors.New("User is not authorized")
+		}
+		return nil, err
+	}
+
+	if !tkn.Valid {
+		return nil, errors.New("User is not authorized")
+	}
+
+	// only access tokens name a user or a client, ID tokens and MFA
+	// challenges are signed with the same keys but are no bearer tokens
+	if claims.UserID == "" && claims.ClientID == "" {
+		return nil, errors.New("User is not authorized")
+	}
+
+	// access tokens always get a UUID jti, anything else can't be looked up
+	// in the revocation store
+	if _, err := uuid.Parse(claims.ID); err != nil {
+		return nil, errors.New("User is not authorized")
+	}
+
+	revoked, err := s.isRevoked(ctx, claims.ID, claims.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errTokenRevocationUnavailable, err)
+	}
+
+	if revoked {
+		return nil, errors.New("User is not authorized")
+	}
+
+	if claims.ClientID != "" {
+		return &ClientClaims{
+			ClientID:         claims.ClientID,
+			Scope:            claims.Scope,
+			RegisteredClaims: claims.RegisteredClaims,
+		}, nil
+	}
+
+	return &claims.Claims, nil
+}
+
+// isRevoked reports whether the token itself or its whole session has been
+// revoked. Sessions are revoked by their id when all access tokens of a
+// session must stop working at once, see revokeOtherSessions.
+func (s *Server) isRevoked(ctx context.Context, tokenID, sessionID string) (bool, error) {
+	revoked, err := s.TokenRevocation.IsTokenRevoked(ctx, tokenID)
+	if err != nil || revoked || sessionID == "" {
+		return revoked, err
+	}
+
+	return s.TokenRevocation.IsTokenRevoked(ctx, sessionID)
+}
+
+// protectedRoutes lists the "METHOD /echo/:path" of operations requiring
+// bearerAuth, either through their own security or the global one.
+func protectedRoutes(swagger *openapi3.T) map[string]bool {
+	protected := map[string]bool{}
+	for path, pathItem := range swagger.Paths {
+		for method, operation := range pathItem.Operations() {
+			security := swagger.Security
+			if operation.Security != nil {
+				security = *operation.Security
+			}
+
+			for _, requirement := range security {
+				if _, ok := requirement[BearerAuthScheme]; ok {
+					protected[routeKey(method, pathParamPattern.ReplaceAllString(path, ":$1"))] = true
+				}
+			}
+		}
+	}
+
+	return protected
+}
+
+func routeKey(method, path string) string {
+	return strings.ToUpper(method) + " " + path
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// withClaims stores claims the way the Authenticate middleware does.
+func withClaims(c echo.Context, claims jwt.Claims) echo.Context {
+	reqCtx := context.WithValue(c.Request().Context(), claimsContextKey{}, claims)
+	c.SetRequest(c.Request().WithContext(reqCtx))
+	return c
+}
+
+func TestAuthenticate(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := &Server{
+		Repository:      mockRepository,
+		TokenRevocation: repository.NewMemoryTokenRevocation(),
+		KeyRing:         newTestKeyRing(t),
+	}
+
+	swagger, err := generated.GetSwagger()
+	assert.Nil(t, err, "error should be nil")
+
+	e := echo.New()
+	e.Use(srv.Authenticate(swagger))
+	generated.RegisterHandlers(e, srv)
+
+	serve := func(method, path, authHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if authHeader != "" {
+			req.Header.Set(echo.HeaderAuthorization, authHeader)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tokenString, _ := srv.createJWTToken(&repository.User{ID: "user-id"}, "session-id", UserTokenScope)
+
+	t.Run("positive", func(t *testing.T) {
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(&repository.User{}, nil).Times(1)
+
+		rec := serve(http.MethodGet, "/profile", "Bearer "+tokenString)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("client token on user operation", func(t *testing.T) {
+		clientTokenString, _ := srv.createClientToken(&repository.Client{ID: "batch"}, "users:read")
+
+		rec := serve(http.MethodGet, "/profile", "Bearer "+clientTokenString)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("unprotected operation", func(t *testing.T) {
+		rec := serve(http.MethodGet, "/.well-known/jwks.json", "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("auth header missing", func(t *testing.T) {
+		rec := serve(http.MethodGet, "/profile", "")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("auth header invalid", func(t *testing.T) {
+		rec := serve(http.MethodPatch, "/profile/update", "mockAuthHeader")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("parse with claims error", func(t *testing.T) {
+		rec := serve(http.MethodGet, "/profile", "Bearer eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("signature invalid", func(t *testing.T) {
+		tempParseWithClaims := ParseWithClaims
+		ParseWithClaims = func(tokenString string, claims jwt.Claims, keyFunc jwt.Keyfunc, options ...jwt.ParserOption) (*jwt.Token, error) {
+			return &jwt.Token{Valid: false}, jwt.ErrSignatureInvalid
+		}
+
+		defer func() {
+			ParseWithClaims = tempParseWithClaims
+		}()
+
+		rec := serve(http.MethodGet, "/profile", "Bearer "+tokenString)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("token invalid", func(t *testing.T) {
+		tempParseWithClaims := ParseWithClaims
+		ParseWithClaims = func(tokenString string, claims jwt.Claims, keyFunc jwt.Keyfunc, options ...jwt.ParserOption) (*jwt.Token, error) {
+			return &jwt.Token{Valid: false}, nil
+		}
+
+		defer func() {
+			ParseWithClaims = tempParseWithClaims
+		}()
+
+		rec := serve(http.MethodGet, "/profile", "Bearer "+tokenString)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("token without uuid jti", func(t *testing.T) {
+		mockRevocation := repository.NewMockTokenRevocationInterface(mockCtrl)
+		jtiSrv := *srv
+		jtiSrv.TokenRevocation = mockRevocation
+
+		for _, id := range []string{"", "not-a-uuid"} {
+			claims := srv.newClaims(&repository.User{ID: "user-id"}, "session-id", UserTokenScope)
+			claims.ID = id
+			jtiTokenString, _ := srv.signToken(claims)
+
+			_, err := jtiSrv.verifyAccessToken(context.Background(), jtiTokenString)
+			assert.NotNil(t, err, "error should not be nil")
+			assert.False(t, errors.Is(err, errTokenRevocationUnavailable))
+		}
+	})
+
+	t.Run("revoked token", func(t *testing.T) {
+		revokedString, _ := srv.createJWTToken(&repository.User{ID: "user-id"}, "session-id", UserTokenScope)
+		claims := &Claims{}
+		_, _ = jwt.ParseWithClaims(revokedString, claims, srv.verificationKey)
+		_ = srv.TokenRevocation.RevokeToken(context.Background(), claims.ID, time.Now().Add(time.Minute))
+
+		rec := serve(http.MethodGet, "/profile", "Bearer "+revokedString)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("id token", func(t *testing.T) {
+		// ID tokens carry no jti, the revocation store must not be asked
+		mockRevocation := repository.NewMockTokenRevocationInterface(mockCtrl)
+		idSrv := *srv
+		idSrv.TokenRevocation = mockRevocation
+
+		idTokenString, _ := idSrv.createIDToken(&Claims{UserID: "user-id", Scope: "openid"}, "web", "", time.Now())
+		claims, err := idSrv.verifyAccessToken(context.Background(), idTokenString)
+		assert.Nil(t, claims)
+		assert.NotNil(t, err, "error should not be nil")
+
+		rec := serve(http.MethodGet, "/profile", "Bearer "+idTokenString)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("revoked session", func(t *testing.T) {
+		sessionTokenString, _ := srv.createJWTToken(&repository.User{ID: "user-id"}, "revoked-session-id", UserTokenScope)
+		_ = srv.TokenRevocation.RevokeToken(context.Background(), "revoked-session-id", time.Now().Add(time.Minute))
+
+		rec := serve(http.MethodGet, "/profile", "Bearer "+sessionTokenString)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	grantTypeAuthorizationCode = "authorization_code"
+	grantTypeClientCredentials = "client_credentials"
+)
+
+// Token is the OAuth 2.0 token endpoint. Errors use the RFC 6749 section 5.2
+// format so standard client libraries can read them.
+func (s *Server) Token(ctx echo.Context) error {
+	client, err := s.authenticateClient(ctx)
+	if err != nil {
+		if errors.Is(err, errClientUnauthorized) {
+			ctx.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="user-service"`)
+			return sendOAuthError(ctx, http.StatusUnauthorized, "invalid_client", err.Error())
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	switch ctx.FormValue("grant_type") {
+	case grantTypeAuthorizationCode:
+		return s.exchangeAuthorizationCode(ctx, client)
+	case grantTypeClientCredentials:
+		return s.grantClientCredentials(ctx, client)
+	}
+
+	return sendOAuthError(ctx, http.StatusBadRequest, "unsupported_grant_type", "grant_type is not supported")
+}
+
+func (s *Server) exchangeAuthorizationCode(ctx echo.Context, client *repository.Client) error {
+	codeString := ctx.FormValue("code")
+	if codeString == "" {
+		return sendOAuthError(ctx, http.StatusBadRequest, "invalid_request", "code can't be empty")
+	}
+
+	code, err := s.Repository.ConsumeAuthorizationCode(ctx.Request().Context(), hashRefreshToken(codeString))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sendOAuthError(ctx, http.StatusBadRequest, "invalid_grant", "code is not valid")
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if code.ClientID != client.ID || code.RedirectURI != ctx.FormValue("redirect_uri") || time.Now().After(code.ExpiresAt) {
+		return sendOAuthError(ctx, http.StatusBadRequest, "invalid_grant", "code is not valid")
+	}
+
+	if !verifyCodeChallenge(ctx.FormValue("code_verifier"), code.CodeChallenge) {
+		return sendOAuthError(ctx, http.StatusBadRequest, "invalid_grant", "code_verifier does not match code_challenge")
+	}
+
+	user, err := s.getActiveUserByID(ctx.Request().Context(), code.UserID)
+	if err != nil {
+		return sendUserLookupError(ctx, err)
+	}
+
+	// the request comes from the client backend, so its name is the best
+	// label for the device. The user authenticated when the code was issued.
+	sessionID, err := s.startSession(ctx, user.ID, client.Name, code.AuthTime)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	refreshToken, err := s.issueRefreshToken(ctx.Request().Context(), user.ID, sessionID, code.Scope)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	claims := s.newClaims(user, sessionID, code.Scope)
+	accessToken, err := s.signToken(claims)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	idToken, err := s.createIDToken(claims, client.ID, code.Nonce, code.AuthTime)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	return sendTokenResponse(ctx, generated.TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(AccessTokenDuration.Seconds()),
+		RefreshToken: &refreshToken,
+		IdToken:      &idToken,
+		Scope:        &code.Scope,
+	})
+}
+
+// grantClientCredentials issues an access token to the client itself. The
+// requested scope must be a subset of the scopes registered for the client,
+// all of them are granted when none is requested. No refresh token is issued
+// as the client can always authenticate again (RFC 6749 section 4.4.3).
+func (s *Server) grantClientCredentials(ctx echo.Context, client *repository.Client) error {
+	scopes := client.Scopes
+	if requested := strings.Fields(ctx.FormValue("scope")); len(requested) > 0 {
+		for _, scope := range requested {
+			if !containsString(client.Scopes, scope) {
+				return sendOAuthError(ctx, http.StatusBadRequest, "invalid_scope", "scope "+scope+" is not allowed for this client")
+			}
+		}
+		scopes = requested
+	}
+
+	scope := strings.Join(scopes, " ")
+	accessToken, err := s.createClientToken(client, scope)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	return sendTokenResponse(ctx, generated.TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(AccessTokenDuration.Seconds()),
+		Scope:       &scope,
+	})
+}
+
+func (s *Server) createClientToken(client *repository.Client, scope string) (string, error) {
+	now := time.Now()
+
+	return s.signToken(&ClientClaims{
+		ClientID: client.ID,
+		Scope:    scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Issuer:    s.Issuer,
+			Subject:   client.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenDuration)),
+		},
+	})
+}
+
+func sendTokenResponse(ctx echo.Context, resp generated.TokenResponse) error {
+	// RFC 6749 section 5.1, token responses must not be cached
+	ctx.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	ctx.Response().Header().Set("Pragma", "no-cache")
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+func sendOAuthError(ctx echo.Context, httpCode int, errorCode, description string) error {
+	return ctx.JSON(httpCode, generated.OAuthErrorResponse{
+		Error:            errorCode,
+		ErrorDescription: &description,
+	})
+}
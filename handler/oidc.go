@@ -0,0 +1,278 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/keyring"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopePhone   = "phone"
+
+	AuthorizationCodeDuration = 5 * time.Minute
+	IDTokenDuration           = time.Hour
+
+	codeChallengeMethodS256 = "S256"
+
+	promptNone  = "none"
+	promptLogin = "login"
+)
+
+var supportedScopes = []string{ScopeOpenID, ScopeProfile, ScopePhone}
+
+// IDTokenClaims are the claims of an OpenID Connect ID token, derived from the
+// access token Claims of the same user.
+type IDTokenClaims struct {
+	Nonce       string           `json:"nonce,omitempty"`
+	AuthTime    *jwt.NumericDate `json:"auth_time,omitempty"`
+	Name        string           `json:"name,omitempty"`
+	PhoneNumber string           `json:"phone_number,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// GetOpenIDConfiguration serves the OpenID Connect discovery document.
+func (s *Server) GetOpenIDConfiguration(ctx echo.Context) error {
+	issuer := s.Issuer
+	introspectionEndpoint := issuer + "/oauth/introspect"
+
+	return ctx.JSON(http.StatusOK, generated.OpenIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/authorize",
+		TokenEndpoint:                     issuer + "/token",
+		UserinfoEndpoint:                  issuer + "/userinfo",
+		JwksUri:                           issuer + "/.well-known/jwks.json",
+		IntrospectionEndpoint:             &introspectionEndpoint,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               &[]string{grantTypeAuthorizationCode, grantTypeClientCredentials},
+		SubjectTypesSupported:             []string{"public"},
+		IdTokenSigningAlgValuesSupported:  keyring.SupportedAlgorithms,
+		ScopesSupported:                   &supportedScopes,
+		ClaimsSupported:                   &[]string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "name", "phone_number"},
+		TokenEndpointAuthMethodsSupported: &[]string{"client_secret_basic", "client_secret_post"},
+		CodeChallengeMethodsSupported:     &[]string{codeChallengeMethodS256},
+	})
+}
+
+// Authorize issues an authorization code to the client for the signed in
+// user, see authorizeSession. Browsers that are not signed in, or must log in
+// again because of prompt or max_age, get the login page. Once client and
+// redirect_uri are trusted every error is sent back to the client through
+// the redirect, as RFC 6749 section 4.1.2.1 asks.
+func (s *Server) Authorize(ctx echo.Context, params generated.AuthorizeParams) error {
+	session, httpCode, err := s.authorizeSession(ctx)
+	if err != nil {
+		return sendErrorResponse(ctx, httpCode, err)
+	}
+
+	client, err := s.Repository.GetClient(ctx.Request().Context(), params.ClientId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sendErrorResponse(ctx, http.StatusBadRequest, errors.New("client_id: unknown client"))
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if !containsString(client.RedirectURIs, params.RedirectUri) {
+		return sendErrorResponse(ctx, http.StatusBadRequest, errors.New("redirect_uri: not registered for client"))
+	}
+
+	state := stringValue(params.State)
+	if stringValue(params.ResponseType) != "code" {
+		return redirectWithError(ctx, params.RedirectUri, state, "unsupported_response_type", "response_type must be code")
+	}
+
+	scope, err := parseOIDCScope(stringValue(params.Scope))
+	if err != nil {
+		return redirectWithError(ctx, params.RedirectUri, state, "invalid_scope", err.Error())
+	}
+
+	if stringValue(params.CodeChallenge) == "" || stringValue(params.CodeChallengeMethod) != codeChallengeMethodS256 {
+		return redirectWithError(ctx, params.RedirectUri, state, "invalid_request", "code_challenge with code_challenge_method S256 is required")
+	}
+
+	prompt := strings.Fields(stringValue(params.Prompt))
+	if containsString(prompt, promptNone) && len(prompt) > 1 {
+		return redirectWithError(ctx, params.RedirectUri, state, "invalid_request", "prompt none can't be combined with other values")
+	}
+
+	if params.MaxAge != nil && *params.MaxAge < 0 {
+		return redirectWithError(ctx, params.RedirectUri, state, "invalid_request", "max_age can't be negative")
+	}
+
+	// OpenID Connect Core section 3.1.2.1
+	loginRequired := session == nil || containsString(prompt, promptLogin) ||
+		(params.MaxAge != nil && time.Since(session.AuthTime) > time.Duration(*params.MaxAge)*time.Second)
+	if loginRequired {
+		if containsString(prompt, promptNone) {
+			return redirectWithError(ctx, params.RedirectUri, state, "login_required", "user must log in")
+		}
+		return s.renderLoginPage(ctx)
+	}
+
+	code, err := randomToken()
+	if err != nil {
+		return redirectWithError(ctx, params.RedirectUri, state, "server_error", "authorization code could not be generated")
+	}
+
+	err = s.Repository.StoreAuthorizationCode(ctx.Request().Context(), &repository.AuthorizationCode{
+		CodeHash:            hashRefreshToken(code),
+		ClientID:            client.ID,
+		UserID:              session.UserID,
+		RedirectURI:         params.RedirectUri,
+		Scope:               scope,
+		Nonce:               stringValue(params.Nonce),
+		CodeChallenge:       stringValue(params.CodeChallenge),
+		CodeChallengeMethod: codeChallengeMethodS256,
+		AuthTime:            session.AuthTime,
+		ExpiresAt:           time.Now().Add(AuthorizationCodeDuration),
+	})
+	if err != nil {
+		return redirectWithError(ctx, params.RedirectUri, state, "server_error", "authorization code could not be stored")
+	}
+
+	return redirectWithQuery(ctx, params.RedirectUri, url.Values{"code": {code}}, state)
+}
+
+// UserInfo returns the claims about the user of an access token granted
+// with the openid scope.
+func (s *Server) UserInfo(ctx echo.Context) error {
+	var (
+		successResp generated.UserInfoResponse
+	)
+
+	claims, ok := ClaimsFromContext(ctx.Request().Context())
+	if !ok || !hasScope(claims.Scope, ScopeOpenID) {
+		return sendErrorResponse(ctx, http.StatusForbidden, errors.New("User is not authorized"))
+	}
+
+	user, err := s.getActiveUserByID(ctx.Request().Context(), claims.UserID)
+	if err != nil {
+		return sendUserLookupError(ctx, err)
+	}
+
+	successResp.Sub = user.ID
+	if hasScope(claims.Scope, ScopeProfile) {
+		successResp.Name = &user.FullName
+	}
+	if hasScope(claims.Scope, ScopePhone) {
+		successResp.PhoneNumber = &user.PhoneNumber
+	}
+
+	return ctx.JSON(http.StatusOK, successResp)
+}
+
+// createIDToken signs an ID token for the client out of the access token
+// claims issued in the same exchange.
+func (s *Server) createIDToken(claims *Claims, clientID, nonce string, authTime time.Time) (string, error) {
+	now := time.Now()
+	idClaims := &IDTokenClaims{
+		Nonce:    nonce,
+		AuthTime: jwt.NewNumericDate(authTime),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    claims.Issuer,
+			Subject:   claims.UserID,
+			Audience:  jwt.ClaimStrings{clientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(IDTokenDuration)),
+		},
+	}
+
+	if hasScope(claims.Scope, ScopeProfile) {
+		idClaims.Name = claims.FullName
+	}
+	if hasScope(claims.Scope, ScopePhone) {
+		idClaims.PhoneNumber = claims.PhoneNumber
+	}
+
+	return s.signToken(idClaims)
+}
+
+// parseOIDCScope validates a requested scope, which must contain openid.
+func parseOIDCScope(scope string) (string, error) {
+	scopes := strings.Fields(scope)
+	for _, requested := range scopes {
+		if !containsString(supportedScopes, requested) {
+			return "", fmt.Errorf("scope %s is not supported", requested)
+		}
+	}
+
+	if !containsString(scopes, ScopeOpenID) {
+		return "", errors.New("scope must contain openid")
+	}
+
+	return strings.Join(scopes, " "), nil
+}
+
+// verifyCodeChallenge checks a PKCE code_verifier against the S256 challenge.
+func verifyCodeChallenge(codeVerifier, codeChallenge string) bool {
+	// RFC 7636 section 4.1
+	if len(codeVerifier) < 43 || len(codeVerifier) > 128 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(codeVerifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(codeChallenge)) == 1
+}
+
+func redirectWithError(ctx echo.Context, redirectURI, state, errorCode, description string) error {
+	return redirectWithQuery(ctx, redirectURI, url.Values{
+		"error":             {errorCode},
+		"error_description": {description},
+	}, state)
+}
+
+func redirectWithQuery(ctx echo.Context, redirectURI string, values url.Values, state string) error {
+	location, err := url.Parse(redirectURI)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	query := location.Query()
+	for name := range values {
+		query.Set(name, values.Get(name))
+	}
+	if state != "" {
+		query.Set("state", state)
+	}
+	location.RawQuery = query.Encode()
+
+	return ctx.Redirect(http.StatusFound, location.String())
+}
+
+func hasScope(scope, wanted string) bool {
+	return containsString(strings.Fields(scope), wanted)
+}
+
+func containsString(values []string, wanted string) bool {
+	for _, value := range values {
+		if value == wanted {
+			return true
+		}
+	}
+
+	return false
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	return *value
+}
@@ -0,0 +1,563 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// RFC 7636 appendix B
+const (
+	mockCodeVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	mockCodeChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestGetOpenIDConfiguration(t *testing.T) {
+	srv := Server{
+		Issuer: "https://id.example.com",
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil)
+	rec := httptest.NewRecorder()
+	e := echo.New()
+	c := e.NewContext(req, rec)
+
+	err := srv.GetOpenIDConfiguration(c)
+	assert.Nil(t, err, "error should be nil")
+
+	var resp generated.OpenIDConfiguration
+	_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+	assert.Equal(t, "https://id.example.com", resp.Issuer)
+	assert.Equal(t, "https://id.example.com/authorize", resp.AuthorizationEndpoint)
+	assert.Equal(t, "https://id.example.com/.well-known/jwks.json", resp.JwksUri)
+	assert.Equal(t, []string{"S256"}, *resp.CodeChallengeMethodsSupported)
+}
+
+func TestAuthorize(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	revocation := repository.NewMemoryTokenRevocation()
+	srv := Server{
+		Repository:      mockRepository,
+		TokenRevocation: revocation,
+		KeyRing:         newTestKeyRing(t),
+		Issuer:          "https://id.example.com",
+	}
+
+	mockClient := &repository.Client{
+		ID:           "web",
+		RedirectURIs: []string{"https://app.example.com/callback"},
+	}
+
+	// the user logged in an hour ago, refreshing the tokens since
+	mockSession := &repository.Session{
+		ID:       testSessionID,
+		UserID:   "user-id",
+		AuthTime: time.Now().Add(-time.Hour).Truncate(time.Second),
+	}
+
+	str := func(value string) *string {
+		return &value
+	}
+
+	integer := func(value int) *int {
+		return &value
+	}
+
+	validParams := func() generated.AuthorizeParams {
+		return generated.AuthorizeParams{
+			ResponseType:        str("code"),
+			ClientId:            "web",
+			RedirectUri:         "https://app.example.com/callback",
+			Scope:               str("openid profile"),
+			State:               str("xyz"),
+			Nonce:               str("n-0S6_WzA2Mj"),
+			CodeChallenge:       str(mockCodeChallenge),
+			CodeChallengeMethod: str("S256"),
+		}
+	}
+
+	sessionCookie := func(sessionID string) *http.Cookie {
+		req := httptest.NewRequest(http.MethodPost, "/authorize/session", nil)
+		rec := httptest.NewRecorder()
+		c := withClaims(echo.New().NewContext(req, rec), &Claims{UserID: "user-id", SessionID: sessionID, Scope: UserTokenScope})
+		if err := srv.StartAuthorizeSession(c); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Result().Cookies()[0]
+	}
+
+	newContext := func(cookie *http.Cookie, query string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodGet, "/authorize?"+query, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return e.NewContext(req, rec), rec
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		c, rec := newContext(sessionCookie(testSessionID), "")
+
+		mockRepository.EXPECT().GetSession(gomock.Any(), testSessionID).Return(mockSession, nil).Times(1)
+		mockRepository.EXPECT().GetClient(gomock.Any(), "web").Return(mockClient, nil).Times(1)
+		mockRepository.EXPECT().StoreAuthorizationCode(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ interface{}, code *repository.AuthorizationCode) error {
+				assert.Equal(t, "user-id", code.UserID)
+				assert.Equal(t, "openid profile", code.Scope)
+				assert.Equal(t, mockCodeChallenge, code.CodeChallenge)
+				assert.Equal(t, mockSession.AuthTime, code.AuthTime)
+				return nil
+			}).Times(1)
+
+		err := srv.Authorize(c, validParams())
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusFound, rec.Code)
+
+		location, _ := url.Parse(rec.Header().Get(echo.HeaderLocation))
+		assert.Equal(t, "app.example.com", location.Host)
+		assert.NotEmpty(t, location.Query().Get("code"))
+		assert.Equal(t, "xyz", location.Query().Get("state"))
+	})
+
+	t.Run("bearer token keeps the time of the login", func(t *testing.T) {
+		c, rec := newContext(nil, "")
+		token, _ := srv.createJWTToken(&repository.User{ID: "user-id"}, testSessionID, UserTokenScope)
+		c.Request().Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+
+		mockRepository.EXPECT().GetSession(gomock.Any(), testSessionID).Return(mockSession, nil).Times(1)
+		mockRepository.EXPECT().GetClient(gomock.Any(), "web").Return(mockClient, nil).Times(1)
+		mockRepository.EXPECT().StoreAuthorizationCode(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ interface{}, code *repository.AuthorizationCode) error {
+				assert.Equal(t, mockSession.AuthTime, code.AuthTime)
+				return nil
+			}).Times(1)
+
+		err := srv.Authorize(c, validParams())
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusFound, rec.Code)
+	})
+
+	t.Run("bearer token issued to a client", func(t *testing.T) {
+		c, rec := newContext(nil, "")
+		token, _ := srv.createJWTToken(&repository.User{ID: "user-id"}, testSessionID, "openid profile")
+		c.Request().Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+
+		err := srv.Authorize(c, validParams())
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("not signed in", func(t *testing.T) {
+		c, rec := newContext(nil, "client_id=web&prompt=login&max_age=60")
+
+		mockRepository.EXPECT().GetClient(gomock.Any(), "web").Return(mockClient, nil).Times(1)
+
+		err := srv.Authorize(c, validParams())
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Header().Get(echo.HeaderContentType), echo.MIMETextHTML)
+		assert.Equal(t, "DENY", rec.Header().Get(echo.HeaderXFrameOptions))
+		assert.Contains(t, rec.Body.String(), `"https://id.example.com/login"`)
+		assert.Contains(t, rec.Body.String(), `"/authorize?client_id=web"`)
+	})
+
+	t.Run("not signed in with prompt none", func(t *testing.T) {
+		c, rec := newContext(nil, "")
+
+		params := validParams()
+		params.Prompt = str("none")
+		mockRepository.EXPECT().GetClient(gomock.Any(), "web").Return(mockClient, nil).Times(1)
+
+		err := srv.Authorize(c, params)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusFound, rec.Code)
+
+		location, _ := url.Parse(rec.Header().Get(echo.HeaderLocation))
+		assert.Equal(t, "login_required", location.Query().Get("error"))
+		assert.Equal(t, "xyz", location.Query().Get("state"))
+	})
+
+	t.Run("prompt login", func(t *testing.T) {
+		c, rec := newContext(sessionCookie(testSessionID), "")
+
+		params := validParams()
+		params.Prompt = str("login")
+		mockRepository.EXPECT().GetSession(gomock.Any(), testSessionID).Return(mockSession, nil).Times(1)
+		mockRepository.EXPECT().GetClient(gomock.Any(), "web").Return(mockClient, nil).Times(1)
+
+		err := srv.Authorize(c, params)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("login older than max_age", func(t *testing.T) {
+		c, rec := newContext(sessionCookie(testSessionID), "")
+
+		params := validParams()
+		params.Prompt = str("none")
+		params.MaxAge = integer(60)
+		mockRepository.EXPECT().GetSession(gomock.Any(), testSessionID).Return(mockSession, nil).Times(1)
+		mockRepository.EXPECT().GetClient(gomock.Any(), "web").Return(mockClient, nil).Times(1)
+
+		err := srv.Authorize(c, params)
+		assert.Nil(t, err, "error should be nil")
+
+		location, _ := url.Parse(rec.Header().Get(echo.HeaderLocation))
+		assert.Equal(t, "login_required", location.Query().Get("error"))
+	})
+
+	t.Run("login within max_age", func(t *testing.T) {
+		c, rec := newContext(sessionCookie(testSessionID), "")
+
+		params := validParams()
+		params.MaxAge = integer(7200)
+		mockRepository.EXPECT().GetSession(gomock.Any(), testSessionID).Return(mockSession, nil).Times(1)
+		mockRepository.EXPECT().GetClient(gomock.Any(), "web").Return(mockClient, nil).Times(1)
+		mockRepository.EXPECT().StoreAuthorizationCode(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		err := srv.Authorize(c, params)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusFound, rec.Code)
+	})
+
+	t.Run("session signed out", func(t *testing.T) {
+		c, rec := newContext(sessionCookie(testOtherSessionID), "")
+
+		_ = revocation.RevokeToken(context.Background(), testOtherSessionID, time.Now().Add(time.Hour))
+		mockRepository.EXPECT().GetClient(gomock.Any(), "web").Return(mockClient, nil).Times(1)
+
+		err := srv.Authorize(c, validParams())
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("session signed out after its revocation expired", func(t *testing.T) {
+		c, rec := newContext(sessionCookie(testSessionID), "")
+
+		mockRepository.EXPECT().GetSession(gomock.Any(), testSessionID).
+			Return(&repository.Session{ID: testSessionID, UserID: "user-id", SignedOut: true}, nil).Times(1)
+		mockRepository.EXPECT().GetClient(gomock.Any(), "web").Return(mockClient, nil).Times(1)
+
+		err := srv.Authorize(c, validParams())
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Header().Get(echo.HeaderContentType), echo.MIMETextHTML)
+	})
+
+	t.Run("unregistered redirect uri", func(t *testing.T) {
+		c, rec := newContext(nil, "")
+
+		params := validParams()
+		params.RedirectUri = "https://evil.example.com/callback"
+		mockRepository.EXPECT().GetClient(gomock.Any(), "web").Return(mockClient, nil).Times(1)
+
+		err := srv.Authorize(c, params)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("missing code challenge", func(t *testing.T) {
+		c, rec := newContext(nil, "")
+
+		params := validParams()
+		params.CodeChallengeMethod = str("plain")
+		mockRepository.EXPECT().GetClient(gomock.Any(), "web").Return(mockClient, nil).Times(1)
+
+		err := srv.Authorize(c, params)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusFound, rec.Code)
+
+		location, _ := url.Parse(rec.Header().Get(echo.HeaderLocation))
+		assert.Equal(t, "invalid_request", location.Query().Get("error"))
+		assert.Equal(t, "xyz", location.Query().Get("state"))
+	})
+
+	t.Run("scope without openid", func(t *testing.T) {
+		c, rec := newContext(nil, "")
+
+		params := validParams()
+		params.Scope = str("profile")
+		mockRepository.EXPECT().GetClient(gomock.Any(), "web").Return(mockClient, nil).Times(1)
+
+		err := srv.Authorize(c, params)
+		assert.Nil(t, err, "error should be nil")
+
+		location, _ := url.Parse(rec.Header().Get(echo.HeaderLocation))
+		assert.Equal(t, "invalid_scope", location.Query().Get("error"))
+	})
+
+	t.Run("unknown client", func(t *testing.T) {
+		c, rec := newContext(nil, "")
+
+		mockRepository.EXPECT().GetClient(gomock.Any(), "web").Return(nil, errors.New("error")).Times(1)
+
+		err := srv.Authorize(c, validParams())
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
+
+func TestStartAuthorizeSession(t *testing.T) {
+	srv := Server{
+		TokenRevocation: repository.NewMemoryTokenRevocation(),
+		KeyRing:         newTestKeyRing(t),
+		Issuer:          "https://id.example.com",
+	}
+
+	newContext := func(claims *Claims) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/authorize/session", nil)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return withClaims(e.NewContext(req, rec), claims), rec
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		c, rec := newContext(&Claims{UserID: "user-id", SessionID: testSessionID, Scope: UserTokenScope})
+
+		err := srv.StartAuthorizeSession(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		cookie := rec.Result().Cookies()[0]
+		assert.Equal(t, "/authorize", cookie.Path)
+		assert.True(t, cookie.HttpOnly)
+		assert.True(t, cookie.Secure)
+		assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+
+		claims, err := srv.verifyAuthorizeSession(context.Background(), cookie.Value)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, "user-id", claims.Subject)
+		assert.Equal(t, testSessionID, claims.SessionID)
+
+		// the cookie is no access token
+		_, err = srv.verifyAccessToken(context.Background(), cookie.Value)
+		assert.NotNil(t, err, "error should not be nil")
+	})
+
+	t.Run("token issued to a client", func(t *testing.T) {
+		c, rec := newContext(&Claims{UserID: "user-id", SessionID: testSessionID, Scope: "openid profile"})
+
+		err := srv.StartAuthorizeSession(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Empty(t, rec.Result().Cookies())
+	})
+}
+
+func TestToken(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository:      mockRepository,
+		TokenRevocation: repository.NewMemoryTokenRevocation(),
+		KeyRing:         newTestKeyRing(t),
+		Issuer:          "https://id.example.com",
+	}
+
+	secretHash, _ := bcrypt.GenerateFromPassword([]byte("client-secret"), bcrypt.MinCost)
+	mockClient := &repository.Client{
+		ID:           "web",
+		SecretHash:   string(secretHash),
+		RedirectURIs: []string{"https://app.example.com/callback"},
+	}
+
+	mockCode := func() *repository.AuthorizationCode {
+		return &repository.AuthorizationCode{
+			ClientID:      "web",
+			UserID:        "user-id",
+			RedirectURI:   "https://app.example.com/callback",
+			Scope:         "openid profile",
+			Nonce:         "n-0S6_WzA2Mj",
+			CodeChallenge: mockCodeChallenge,
+			AuthTime:      time.Now(),
+			ExpiresAt:     time.Now().Add(time.Minute),
+		}
+	}
+
+	newContext := func(form url.Values) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		req.SetBasicAuth("web", "client-secret")
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return e.NewContext(req, rec), rec
+	}
+
+	codeForm := func(codeVerifier string) url.Values {
+		return url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {"mock-code"},
+			"redirect_uri":  {"https://app.example.com/callback"},
+			"code_verifier": {codeVerifier},
+		}
+	}
+
+	t.Run("authorization code exchange", func(t *testing.T) {
+		c, rec := newContext(codeForm(mockCodeVerifier))
+
+		mockRepository.EXPECT().GetClient(gomock.Any(), "web").Return(mockClient, nil).Times(1)
+		mockRepository.EXPECT().ConsumeAuthorizationCode(gomock.Any(), hashRefreshToken("mock-code")).Return(mockCode(), nil).Times(1)
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(&repository.User{ID: "user-id", FullName: "sadam"}, nil).Times(1)
+		mockRepository.EXPECT().StoreSession(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().StoreRefreshToken(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		err := srv.Token(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "no-store", rec.Header().Get(echo.HeaderCacheControl))
+
+		var resp generated.TokenResponse
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Equal(t, "Bearer", resp.TokenType)
+		assert.NotNil(t, resp.RefreshToken)
+
+		idClaims := &IDTokenClaims{}
+		_, err = jwt.ParseWithClaims(*resp.IdToken, idClaims, srv.verificationKey)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, "user-id", idClaims.Subject)
+		assert.Equal(t, "https://id.example.com", idClaims.Issuer)
+		assert.Equal(t, jwt.ClaimStrings{"web"}, idClaims.Audience)
+		assert.Equal(t, "n-0S6_WzA2Mj", idClaims.Nonce)
+		assert.Equal(t, "sadam", idClaims.Name)
+
+		claims := &Claims{}
+		_, err = jwt.ParseWithClaims(resp.AccessToken, claims, srv.verificationKey)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, "openid profile", claims.Scope)
+	})
+
+	t.Run("wrong code verifier", func(t *testing.T) {
+		c, rec := newContext(codeForm(strings.Repeat("a", 43)))
+
+		mockRepository.EXPECT().GetClient(gomock.Any(), "web").Return(mockClient, nil).Times(1)
+		mockRepository.EXPECT().ConsumeAuthorizationCode(gomock.Any(), gomock.Any()).Return(mockCode(), nil).Times(1)
+
+		err := srv.Token(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "invalid_grant")
+	})
+
+	t.Run("code issued to another client", func(t *testing.T) {
+		c, rec := newContext(codeForm(mockCodeVerifier))
+
+		code := mockCode()
+		code.ClientID = "other"
+		mockRepository.EXPECT().GetClient(gomock.Any(), "web").Return(mockClient, nil).Times(1)
+		mockRepository.EXPECT().ConsumeAuthorizationCode(gomock.Any(), gomock.Any()).Return(code, nil).Times(1)
+
+		err := srv.Token(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Contains(t, rec.Body.String(), "invalid_grant")
+	})
+
+	t.Run("client credentials", func(t *testing.T) {
+		c, rec := newContext(url.Values{"grant_type": {"client_credentials"}, "scope": {"users:read"}})
+
+		client := *mockClient
+		client.Scopes = []string{"users:read", "users:unlock"}
+		mockRepository.EXPECT().GetClient(gomock.Any(), "web").Return(&client, nil).Times(1)
+
+		err := srv.Token(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var resp generated.TokenResponse
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(t, resp.RefreshToken)
+		assert.Equal(t, "users:read", *resp.Scope)
+
+		claims, err := srv.verifyAccessToken(context.Background(), resp.AccessToken)
+		assert.Nil(t, err, "error should be nil")
+		assert.IsType(t, &ClientClaims{}, claims)
+		assert.Equal(t, "web", claims.(*ClientClaims).ClientID)
+	})
+
+	t.Run("client credentials with unregistered scope", func(t *testing.T) {
+		c, rec := newContext(url.Values{"grant_type": {"client_credentials"}, "scope": {"users:delete"}})
+
+		client := *mockClient
+		client.Scopes = []string{"users:read"}
+		mockRepository.EXPECT().GetClient(gomock.Any(), "web").Return(&client, nil).Times(1)
+
+		err := srv.Token(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "invalid_scope")
+	})
+
+	t.Run("unsupported grant type", func(t *testing.T) {
+		c, rec := newContext(url.Values{"grant_type": {"password"}})
+
+		mockRepository.EXPECT().GetClient(gomock.Any(), "web").Return(mockClient, nil).Times(1)
+
+		err := srv.Token(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "unsupported_grant_type")
+	})
+
+	t.Run("invalid client", func(t *testing.T) {
+		c, rec := newContext(codeForm(mockCodeVerifier))
+
+		mockRepository.EXPECT().GetClient(gomock.Any(), "web").Return(&repository.Client{ID: "web", SecretHash: "invalid"}, nil).Times(1)
+
+		err := srv.Token(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Contains(t, rec.Body.String(), "invalid_client")
+	})
+}
+
+func TestUserInfo(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository: mockRepository,
+	}
+
+	newContext := func(scope string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return withClaims(e.NewContext(req, rec), &Claims{UserID: "user-id", Scope: scope}), rec
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		c, rec := newContext("openid phone")
+
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(&repository.User{
+			ID:          "user-id",
+			FullName:    "sadam",
+			PhoneNumber: "+622342342322",
+		}, nil).Times(1)
+
+		err := srv.UserInfo(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.JSONEq(t, `{"sub": "user-id", "phone_number": "+622342342322"}`, rec.Body.String())
+	})
+
+	t.Run("token without openid scope", func(t *testing.T) {
+		c, rec := newContext(UserTokenScope)
+
+		err := srv.UserInfo(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/google/uuid"
+)
+
+const (
+	OneTimeCodeDuration    = 10 * time.Minute
+	OneTimeCodeDigits      = 6
+	MaxOneTimeCodeAttempts = 5
+
+	oneTimeCodeLogin             = "login"
+	oneTimeCodePasswordReset     = "password_reset"
+	oneTimeCodePhoneVerification = "phone_verification"
+	oneTimeCodeStepUp            = "step_up"
+	oneTimeCodeReactivation      = "reactivation"
+)
+
+// sendOneTimeCode issues a new code for purpose and texts it to the user.
+// message is a format string receiving the code.
+func (s *Server) sendOneTimeCode(ctx context.Context, user *repository.User, purpose, message string) error {
+	code, err := newOneTimeCode()
+	if err != nil {
+		return err
+	}
+
+	err = s.Repository.StoreOneTimeCode(ctx, &repository.OneTimeCode{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		Purpose:   purpose,
+		CodeHash:  hashOneTimeCode(user.ID, code),
+		ExpiresAt: time.Now().Add(OneTimeCodeDuration),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.SMSSender.Send(ctx, user.PhoneNumber, fmt.Sprintf(message, code))
+}
+
+// verifyOneTimeCode consumes the pending code of a user for purpose. Every
+// failure caused by the code itself is reported as
+// repository.ErrOneTimeCodeInvalid.
+func (s *Server) verifyOneTimeCode(ctx context.Context, userID, purpose, code string) error {
+	_, err := s.Repository.ConsumeOneTimeCode(ctx, userID, purpose, hashOneTimeCode(userID, code), MaxOneTimeCodeAttempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repository.ErrOneTimeCodeInvalid
+	}
+
+	return err
+}
+
+func newOneTimeCode() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < OneTimeCodeDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%0*d", OneTimeCodeDigits, n), nil
+}
+
+// hashOneTimeCode binds the code to the user, so equal codes of different
+// users never share a hash.
+func hashOneTimeCode(userID, code string) string {
+	hash := sha256.Sum256([]byte(userID + ":" + code))
+	return hex.EncodeToString(hash[:])
+}
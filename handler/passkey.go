@@ -0,0 +1,421 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/helper"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/webauthn"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// PasskeyTimeout is how long a WebAuthn ceremony may take, from the
+	// options to the response of the authenticator.
+	PasskeyTimeout     = 5 * time.Minute
+	DefaultPasskeyName = "Passkey"
+
+	passkeyRegistrationAudience = "passkey_registration"
+	passkeyLoginAudience        = "passkey_login"
+	publicKeyCredentialType     = "public-key"
+)
+
+var (
+	errPasskeyNotConfigured = errors.New("passkeys are not configured")
+	errPasskeyInvalid       = errors.New("Passkey is not valid")
+)
+
+// passkeySessionClaims carry the challenge of a WebAuthn ceremony between
+// its options and its response, so no server side state is needed. The
+// audience tells registrations and logins apart.
+type passkeySessionClaims struct {
+	Challenge string `json:"challenge"`
+	jwt.RegisteredClaims
+}
+
+// BeginPasskeyRegistration returns the options to create a passkey for the
+// current user. Passkeys are discoverable and verify the user, so they can
+// replace both the phone number and the password.
+func (s *Server) BeginPasskeyRegistration(ctx echo.Context) error {
+	var (
+		successResp generated.BeginPasskeyRegistrationResponse
+	)
+
+	claims, ok := ClaimsFromContext(ctx.Request().Context())
+	if !ok {
+		return sendErrorResponse(ctx, http.StatusForbidden, errors.New("User is not authorized"))
+	}
+
+	if s.WebAuthn == nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, errPasskeyNotConfigured)
+	}
+
+	user, err := s.getActiveUserByID(ctx.Request().Context(), claims.UserID)
+	if err != nil {
+		return sendUserLookupError(ctx, err)
+	}
+
+	// an authenticator holds at most one passkey per user
+	credentials, err := s.Repository.ListWebAuthnCredentials(ctx.Request().Context(), user.ID)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	excludeCredentials := []generated.PasskeyCredentialDescriptor{}
+	for _, credential := range credentials {
+		excludeCredentials = append(excludeCredentials, generated.PasskeyCredentialDescriptor{
+			Type: publicKeyCredentialType,
+			Id:   credential.ID,
+		})
+	}
+
+	challenge, sessionToken, err := s.createPasskeySession(user.ID, passkeyRegistrationAudience)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	pubKeyCredParams := []generated.PasskeyCredentialParameter{}
+	for _, alg := range webauthn.SupportedAlgorithms {
+		pubKeyCredParams = append(pubKeyCredParams, generated.PasskeyCredentialParameter{
+			Type: publicKeyCredentialType,
+			Alg:  alg,
+		})
+	}
+
+	successResp.SessionToken = sessionToken
+	successResp.PublicKey = generated.PasskeyCreationOptions{
+		Rp: generated.PasskeyRelyingParty{
+			Id:   s.WebAuthn.ID,
+			Name: s.WebAuthn.Name,
+		},
+		User: generated.PasskeyUser{
+			Id:          webauthn.Encoding.EncodeToString([]byte(user.ID)),
+			Name:        user.PhoneNumber,
+			DisplayName: user.FullName,
+		},
+		Challenge:          challenge,
+		PubKeyCredParams:   pubKeyCredParams,
+		Timeout:            int(PasskeyTimeout.Milliseconds()),
+		ExcludeCredentials: excludeCredentials,
+		AuthenticatorSelection: generated.PasskeyAuthenticatorSelection{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   "required",
+		},
+		Attestation: "none",
+	}
+	return ctx.JSON(http.StatusOK, successResp)
+}
+
+// RegisterPasskey stores the passkey created with the options of
+// BeginPasskeyRegistration.
+func (s *Server) RegisterPasskey(ctx echo.Context) error {
+	var (
+		successResp generated.RegisterPasskeyResponse
+	)
+
+	claims, ok := ClaimsFromContext(ctx.Request().Context())
+	if !ok {
+		return sendErrorResponse(ctx, http.StatusForbidden, errors.New("User is not authorized"))
+	}
+
+	if s.WebAuthn == nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, errPasskeyNotConfigured)
+	}
+
+	request := &generated.RegisterPasskeyRequest{}
+	err := json.NewDecoder(ctx.Request().Body).Decode(&request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	clientDataJSON, attestationObject, err := validateRegisterPasskey(request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	session, err := s.verifyPasskeySession(ctx.Request().Context(), request.SessionToken, passkeyRegistrationAudience)
+	if err != nil {
+		if errors.Is(err, errTokenRevocationUnavailable) {
+			return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+		}
+		return sendErrorResponse(ctx, http.StatusForbidden, errSingleUseTokenInvalid)
+	}
+
+	if session.Subject != claims.UserID {
+		return sendErrorResponse(ctx, http.StatusForbidden, errSingleUseTokenInvalid)
+	}
+
+	// revoked before the ceremony is checked, so concurrent requests with
+	// the same session token can't both register a passkey
+	err = s.TokenRevocation.RevokeToken(ctx.Request().Context(), session.ID, session.ExpiresAt.Time)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	challenge, _ := webauthn.Encoding.DecodeString(session.Challenge)
+	credential, err := s.WebAuthn.VerifyRegistration(challenge, clientDataJSON, attestationObject)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, errPasskeyInvalid)
+	}
+
+	aaguid, err := uuid.FromBytes(credential.AAGUID)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, errPasskeyInvalid)
+	}
+
+	name := DefaultPasskeyName
+	if request.Name != nil && *request.Name != "" {
+		name = *request.Name
+	}
+
+	credentialID := webauthn.Encoding.EncodeToString(credential.ID)
+	err = s.Repository.StoreWebAuthnCredential(ctx.Request().Context(), &repository.WebAuthnCredential{
+		ID:                credentialID,
+		UserID:            claims.UserID,
+		Name:              name,
+		PublicKey:         credential.PublicKey,
+		SignCount:         credential.SignCount,
+		AAGUID:            aaguid.String(),
+		AttestationFormat: credential.AttestationFormat,
+	})
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	successResp.Result = "register passkey success"
+	successResp.CredentialId = credentialID
+	return ctx.JSON(http.StatusOK, successResp)
+}
+
+// BeginPasskeyLogin returns the options to log in with a passkey. No user
+// is named, the authenticator offers the passkeys it holds for the service.
+func (s *Server) BeginPasskeyLogin(ctx echo.Context) error {
+	var (
+		successResp generated.BeginPasskeyLoginResponse
+	)
+
+	if s.WebAuthn == nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, errPasskeyNotConfigured)
+	}
+
+	challenge, sessionToken, err := s.createPasskeySession("", passkeyLoginAudience)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	successResp.SessionToken = sessionToken
+	successResp.PublicKey = generated.PasskeyRequestOptions{
+		Challenge:        challenge,
+		RpId:             s.WebAuthn.ID,
+		Timeout:          int(PasskeyTimeout.Milliseconds()),
+		UserVerification: "required",
+	}
+	return ctx.JSON(http.StatusOK, successResp)
+}
+
+// LoginPasskey logs the owner of the passkey in with the assertion made for
+// the options of BeginPasskeyLogin, issuing the same tokens as Login.
+func (s *Server) LoginPasskey(ctx echo.Context) error {
+	if s.WebAuthn == nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, errPasskeyNotConfigured)
+	}
+
+	request := &generated.LoginPasskeyRequest{}
+	err := json.NewDecoder(ctx.Request().Body).Decode(&request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	assertion, err := validateLoginPasskey(request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	session, err := s.verifyPasskeySession(ctx.Request().Context(), request.SessionToken, passkeyLoginAudience)
+	if err != nil {
+		if errors.Is(err, errTokenRevocationUnavailable) {
+			return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+		}
+		return sendErrorResponse(ctx, http.StatusForbidden, errSingleUseTokenInvalid)
+	}
+
+	// revoked before the assertion is checked, so concurrent requests with
+	// the same session token can't start two sessions
+	err = s.TokenRevocation.RevokeToken(ctx.Request().Context(), session.ID, session.ExpiresAt.Time)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	credentialID := webauthn.Encoding.EncodeToString(assertion.credentialID)
+	credential, err := s.Repository.GetWebAuthnCredential(ctx.Request().Context(), credentialID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sendErrorResponse(ctx, http.StatusForbidden, errPasskeyInvalid)
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	// the user handle is the id the passkey was created for
+	if assertion.userHandle != nil && string(assertion.userHandle) != credential.UserID {
+		return sendErrorResponse(ctx, http.StatusForbidden, errPasskeyInvalid)
+	}
+
+	challenge, _ := webauthn.Encoding.DecodeString(session.Challenge)
+	signCount, err := s.WebAuthn.VerifyAssertion(challenge, credential.PublicKey, credential.SignCount,
+		assertion.clientDataJSON, assertion.authenticatorData, assertion.signature)
+	if err != nil {
+		// passkeys cannot be guessed, so failures only show in the history
+		event := newLoginEvent(ctx, credential.UserID, loginMethodPasskey)
+		event.FailureReason = loginFailureInvalidPasskey
+		err = s.Repository.StoreLoginEvent(ctx.Request().Context(), event)
+		if err != nil {
+			return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+		}
+		return sendErrorResponse(ctx, http.StatusForbidden, errPasskeyInvalid)
+	}
+
+	err = s.Repository.UpdateWebAuthnSignCount(ctx.Request().Context(), credential.ID, signCount)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	user, err := s.getActiveUserByID(ctx.Request().Context(), credential.UserID)
+	if err != nil {
+		return sendUserLookupError(ctx, err)
+	}
+
+	return s.completeLogin(ctx, user, loginMethodPasskey)
+}
+
+// createPasskeySession returns a new base64url challenge and the token
+// carrying it to the second step of the ceremony.
+func (s *Server) createPasskeySession(userID, audience string) (string, string, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	encodedChallenge := webauthn.Encoding.EncodeToString(challenge)
+	sessionToken, err := s.signToken(&passkeySessionClaims{
+		Challenge: encodedChallenge,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Issuer:    s.Issuer,
+			Subject:   userID,
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(PasskeyTimeout)),
+		},
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return encodedChallenge, sessionToken, nil
+}
+
+func (s *Server) verifyPasskeySession(ctx context.Context, tknStr, audience string) (*passkeySessionClaims, error) {
+	claims := &passkeySessionClaims{}
+
+	err := s.verifySingleUseToken(ctx, tknStr, audience, claims, &claims.RegisteredClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// passkeyAssertion is the decoded response of navigator.credentials.get.
+type passkeyAssertion struct {
+	credentialID      []byte
+	clientDataJSON    []byte
+	authenticatorData []byte
+	signature         []byte
+	userHandle        []byte
+}
+
+func validateRegisterPasskey(request *generated.RegisterPasskeyRequest) ([]byte, []byte, error) {
+	errStrs := []string{}
+
+	if request.SessionToken == "" {
+		errStrs = append(errStrs, "session_token: can't be empty")
+	}
+
+	if request.Credential.Type != publicKeyCredentialType {
+		errStrs = append(errStrs, "credential.type: must be public-key")
+	}
+
+	clientDataJSON, err := decodeBase64URLField("credential.response.clientDataJSON", request.Credential.Response.ClientDataJSON)
+	if err != nil {
+		errStrs = append(errStrs, err.Error())
+	}
+
+	attestationObject, err := decodeBase64URLField("credential.response.attestationObject", request.Credential.Response.AttestationObject)
+	if err != nil {
+		errStrs = append(errStrs, err.Error())
+	}
+
+	return clientDataJSON, attestationObject, helper.ErrStringsToErr(errStrs)
+}
+
+func validateLoginPasskey(request *generated.LoginPasskeyRequest) (*passkeyAssertion, error) {
+	var err error
+	errStrs := []string{}
+	assertion := &passkeyAssertion{}
+	response := request.Credential.Response
+
+	if request.SessionToken == "" {
+		errStrs = append(errStrs, "session_token: can't be empty")
+	}
+
+	if request.Credential.Type != publicKeyCredentialType {
+		errStrs = append(errStrs, "credential.type: must be public-key")
+	}
+
+	if assertion.credentialID, err = decodeBase64URLField("credential.rawId", request.Credential.RawId); err != nil {
+		errStrs = append(errStrs, err.Error())
+	}
+
+	if assertion.clientDataJSON, err = decodeBase64URLField("credential.response.clientDataJSON", response.ClientDataJSON); err != nil {
+		errStrs = append(errStrs, err.Error())
+	}
+
+	if assertion.authenticatorData, err = decodeBase64URLField("credential.response.authenticatorData", response.AuthenticatorData); err != nil {
+		errStrs = append(errStrs, err.Error())
+	}
+
+	if assertion.signature, err = decodeBase64URLField("credential.response.signature", response.Signature); err != nil {
+		errStrs = append(errStrs, err.Error())
+	}
+
+	if response.UserHandle != nil && *response.UserHandle != "" {
+		if assertion.userHandle, err = decodeBase64URLField("credential.response.userHandle", *response.UserHandle); err != nil {
+			errStrs = append(errStrs, err.Error())
+		}
+	}
+
+	return assertion, helper.ErrStringsToErr(errStrs)
+}
+
+func decodeBase64URLField(field, value string) ([]byte, error) {
+	if value == "" {
+		return nil, errors.New(field + ": can't be empty")
+	}
+
+	decoded, err := webauthn.Encoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New(field + ": not base64url")
+	}
+
+	return decoded, nil
+}
@@ -0,0 +1,310 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/webauthn"
+	"github.com/SawitProRecruitment/UserService/webauthn/webauthntest"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasskey(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository:      mockRepository,
+		TokenRevocation: repository.NewMemoryTokenRevocation(),
+		KeyRing:         newTestKeyRing(t),
+		WebAuthn: &webauthn.RelyingParty{
+			ID:                      "localhost",
+			Name:                    "UserService",
+			Origins:                 []string{"http://localhost:8080"},
+			RequireUserVerification: true,
+		},
+	}
+	mockUser := &repository.User{ID: "user-id", FullName: "sadam", PhoneNumber: "+622342342322"}
+	authenticator := webauthntest.NewAuthenticator()
+
+	newContext := func(path string, body interface{}) (echo.Context, *httptest.ResponseRecorder) {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBuffer(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return e.NewContext(req, rec), rec
+	}
+
+	beginRegistration := func(t *testing.T) generated.BeginPasskeyRegistrationResponse {
+		c, rec := newContext("/profile/passkeys/options", nil)
+		c = withClaims(c, &Claims{UserID: "user-id"})
+
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().ListWebAuthnCredentials(gomock.Any(), "user-id").Return(nil, nil).Times(1)
+
+		err := srv.BeginPasskeyRegistration(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		resp := generated.BeginPasskeyRegistrationResponse{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp
+	}
+
+	// create runs navigator.credentials.create with the options
+	create := func(t *testing.T, authenticator *webauthntest.Authenticator, options generated.PasskeyCreationOptions) generated.PasskeyRegistrationCredential {
+		challenge, _ := webauthn.Encoding.DecodeString(options.Challenge)
+		userHandle, _ := webauthn.Encoding.DecodeString(options.User.Id)
+
+		attestation, err := authenticator.Create(options.Rp.Id, "http://localhost:8080", challenge, userHandle)
+		assert.Nil(t, err, "error should be nil")
+
+		credentialID := webauthn.Encoding.EncodeToString(attestation.CredentialID)
+		return generated.PasskeyRegistrationCredential{
+			Id:    credentialID,
+			RawId: credentialID,
+			Type:  "public-key",
+			Response: generated.PasskeyAttestationResponse{
+				ClientDataJSON:    webauthn.Encoding.EncodeToString(attestation.ClientDataJSON),
+				AttestationObject: webauthn.Encoding.EncodeToString(attestation.AttestationObject),
+			},
+		}
+	}
+
+	var stored *repository.WebAuthnCredential
+
+	t.Run("register", func(t *testing.T) {
+		options := beginRegistration(t)
+		assert.Equal(t, "localhost", options.PublicKey.Rp.Id)
+		assert.Equal(t, "+622342342322", options.PublicKey.User.Name)
+		assert.Equal(t, "required", options.PublicKey.AuthenticatorSelection.UserVerification)
+
+		credential := create(t, authenticator, options.PublicKey)
+		name := "Phone"
+		c, rec := newContext("/profile/passkeys", generated.RegisterPasskeyRequest{
+			SessionToken: options.SessionToken,
+			Name:         &name,
+			Credential:   credential,
+		})
+		c = withClaims(c, &Claims{UserID: "user-id"})
+
+		mockRepository.EXPECT().StoreWebAuthnCredential(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, data *repository.WebAuthnCredential) error {
+				stored = data
+				return nil
+			}).Times(1)
+
+		err := srv.RegisterPasskey(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		assert.Equal(t, credential.Id, stored.ID)
+		assert.Equal(t, "user-id", stored.UserID)
+		assert.Equal(t, "Phone", stored.Name)
+		assert.Equal(t, webauthn.AttestationFormatNone, stored.AttestationFormat)
+
+		t.Run("session is single use", func(t *testing.T) {
+			c, rec := newContext("/profile/passkeys", generated.RegisterPasskeyRequest{
+				SessionToken: options.SessionToken,
+				Credential:   create(t, webauthntest.NewAuthenticator(), options.PublicKey),
+			})
+			c = withClaims(c, &Claims{UserID: "user-id"})
+
+			err := srv.RegisterPasskey(c)
+			assert.Nil(t, err, "error should be nil")
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+		})
+	})
+
+	t.Run("register with the session of another user", func(t *testing.T) {
+		options := beginRegistration(t)
+		c, rec := newContext("/profile/passkeys", generated.RegisterPasskeyRequest{
+			SessionToken: options.SessionToken,
+			Credential:   create(t, webauthntest.NewAuthenticator(), options.PublicKey),
+		})
+		c = withClaims(c, &Claims{UserID: "other-user-id"})
+
+		err := srv.RegisterPasskey(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("register from another origin", func(t *testing.T) {
+		options := beginRegistration(t)
+		challenge, _ := webauthn.Encoding.DecodeString(options.PublicKey.Challenge)
+		attestation, _ := webauthntest.NewAuthenticator().Create("localhost", "http://evil.example", challenge, []byte("user-id"))
+
+		c, rec := newContext("/profile/passkeys", generated.RegisterPasskeyRequest{
+			SessionToken: options.SessionToken,
+			Credential: generated.PasskeyRegistrationCredential{
+				Id:    webauthn.Encoding.EncodeToString(attestation.CredentialID),
+				RawId: webauthn.Encoding.EncodeToString(attestation.CredentialID),
+				Type:  "public-key",
+				Response: generated.PasskeyAttestationResponse{
+					ClientDataJSON:    webauthn.Encoding.EncodeToString(attestation.ClientDataJSON),
+					AttestationObject: webauthn.Encoding.EncodeToString(attestation.AttestationObject),
+				},
+			},
+		})
+		c = withClaims(c, &Claims{UserID: "user-id"})
+
+		err := srv.RegisterPasskey(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	beginLogin := func(t *testing.T) generated.BeginPasskeyLoginResponse {
+		c, rec := newContext("/login/passkey/options", nil)
+
+		err := srv.BeginPasskeyLogin(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		resp := generated.BeginPasskeyLoginResponse{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp
+	}
+
+	// get runs navigator.credentials.get with the options
+	get := func(t *testing.T, authenticator *webauthntest.Authenticator, options generated.PasskeyRequestOptions) generated.PasskeyAuthenticationCredential {
+		challenge, _ := webauthn.Encoding.DecodeString(options.Challenge)
+
+		assertion, err := authenticator.Get(options.RpId, "http://localhost:8080", challenge)
+		assert.Nil(t, err, "error should be nil")
+
+		credentialID := webauthn.Encoding.EncodeToString(assertion.CredentialID)
+		userHandle := webauthn.Encoding.EncodeToString(assertion.UserHandle)
+		return generated.PasskeyAuthenticationCredential{
+			Id:    credentialID,
+			RawId: credentialID,
+			Type:  "public-key",
+			Response: generated.PasskeyAssertionResponse{
+				ClientDataJSON:    webauthn.Encoding.EncodeToString(assertion.ClientDataJSON),
+				AuthenticatorData: webauthn.Encoding.EncodeToString(assertion.AuthenticatorData),
+				Signature:         webauthn.Encoding.EncodeToString(assertion.Signature),
+				UserHandle:        &userHandle,
+			},
+		}
+	}
+
+	t.Run("login", func(t *testing.T) {
+		options := beginLogin(t)
+		c, rec := newContext("/login/passkey", generated.LoginPasskeyRequest{
+			SessionToken: options.SessionToken,
+			Credential:   get(t, authenticator, options.PublicKey),
+		})
+
+		mockRepository.EXPECT().GetWebAuthnCredential(gomock.Any(), stored.ID).Return(stored, nil).Times(1)
+		mockRepository.EXPECT().UpdateWebAuthnSignCount(gomock.Any(), stored.ID, uint32(1)).Return(nil).Times(1)
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().StoreSession(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().StoreRefreshToken(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().RecordLoginSuccess(gomock.Any(), isLoginEvent("user-id", loginMethodPasskey, "")).Return(nil).Times(1)
+
+		err := srv.LoginPasskey(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		// the same access token as a password login
+		resp := generated.LoginResponse{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Equal(t, "user-id", resp.UserId)
+		claims, err := srv.verifyAccessToken(context.Background(), resp.Token)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, "user-id", claims.(*Claims).UserID)
+		assert.Equal(t, "+622342342322", claims.(*Claims).PhoneNumber)
+	})
+
+	t.Run("login with a cloned authenticator", func(t *testing.T) {
+		options := beginLogin(t)
+		request := generated.LoginPasskeyRequest{
+			SessionToken: options.SessionToken,
+			Credential:   get(t, authenticator, options.PublicKey),
+		}
+		c, rec := newContext("/login/passkey", request)
+
+		// the counter already went past the one of the authenticator
+		cloned := *stored
+		cloned.SignCount = 100
+		mockRepository.EXPECT().GetWebAuthnCredential(gomock.Any(), stored.ID).Return(&cloned, nil).Times(1)
+		mockRepository.EXPECT().StoreLoginEvent(gomock.Any(), isLoginEvent("user-id", loginMethodPasskey, loginFailureInvalidPasskey)).
+			Return(nil).Times(1)
+
+		err := srv.LoginPasskey(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+
+		// the session is used up as soon as it is presented
+		c, rec = newContext("/login/passkey", request)
+
+		err = srv.LoginPasskey(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), errSingleUseTokenInvalid.Error())
+	})
+
+	t.Run("login with an unknown passkey", func(t *testing.T) {
+		other := webauthntest.NewAuthenticator()
+		_, _ = other.Create("localhost", "http://localhost:8080", []byte("challenge"), []byte("user-id"))
+
+		options := beginLogin(t)
+		c, rec := newContext("/login/passkey", generated.LoginPasskeyRequest{
+			SessionToken: options.SessionToken,
+			Credential:   get(t, other, options.PublicKey),
+		})
+
+		mockRepository.EXPECT().GetWebAuthnCredential(gomock.Any(), gomock.Any()).Return(nil, sql.ErrNoRows).Times(1)
+
+		err := srv.LoginPasskey(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("login with a registration session", func(t *testing.T) {
+		registration := beginRegistration(t)
+		options := beginLogin(t)
+		options.PublicKey.Challenge = registration.PublicKey.Challenge
+
+		c, rec := newContext("/login/passkey", generated.LoginPasskeyRequest{
+			SessionToken: registration.SessionToken,
+			Credential:   get(t, authenticator, options.PublicKey),
+		})
+
+		err := srv.LoginPasskey(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("session is not an access token", func(t *testing.T) {
+		options := beginLogin(t)
+
+		_, err := srv.verifyAccessToken(context.Background(), options.SessionToken)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("payload validation error", func(t *testing.T) {
+		c, rec := newContext("/login/passkey", generated.LoginPasskeyRequest{})
+
+		err := srv.LoginPasskey(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		c, rec := newContext("/login/passkey/options", nil)
+
+		srv := Server{}
+		err := srv.BeginPasskeyLogin(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
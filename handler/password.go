@@ -0,0 +1,248 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/helper"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/labstack/echo/v4"
+)
+
+// ChangePassword replaces the password of the current user after checking
+// the current one. Every other session of the user is revoked, the session
+// making the request stays signed in.
+func (s *Server) ChangePassword(ctx echo.Context) error {
+	var (
+		successResp generated.ChangePasswordResponse
+	)
+
+	claims, ok := ClaimsFromContext(ctx.Request().Context())
+	if !ok {
+		return sendErrorResponse(ctx, http.StatusForbidden, errors.New("User is not authorized"))
+	}
+
+	request := &generated.ChangePasswordRequest{}
+	err := json.NewDecoder(ctx.Request().Body).Decode(&request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	err = validateChangePassword(request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	user, err := s.getActiveUserByID(ctx.Request().Context(), claims.UserID)
+	if err != nil {
+		return sendUserLookupError(ctx, err)
+	}
+
+	confirmed, err := s.confirmPassword(ctx, user, []byte(request.CurrentPassword))
+	if !confirmed {
+		return err
+	}
+
+	hashedPwd, err := s.PasswordHasher.Hash([]byte(request.NewPassword))
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	err = s.Repository.UpdatePassword(ctx.Request().Context(), user.ID, hashedPwd, user.ID)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	err = s.revokeOtherSessions(ctx.Request().Context(), user.ID, claims.SessionID)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	successResp.Result = "change password success"
+	return ctx.JSON(http.StatusOK, successResp)
+}
+
+// ForgotPassword texts a password reset code to the phone number. The
+// response is the same whether or not the phone number is registered.
+func (s *Server) ForgotPassword(ctx echo.Context) error {
+	var (
+		successResp generated.ForgotPasswordResponse
+	)
+
+	request := &generated.ForgotPasswordRequest{}
+	err := json.NewDecoder(ctx.Request().Body).Decode(&request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	err = validateLoginPhoneNumber(request.PhoneNumber)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	allowed, retryAfter, err := s.checkRateLimit(ctx, "password_reset", request.PhoneNumber)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if !allowed {
+		return sendRateLimitResponse(ctx, retryAfter)
+	}
+
+	successResp.Result = "a reset code is sent if the phone number is registered"
+
+	user, err := s.getActiveUser(ctx.Request().Context(), request.PhoneNumber)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ctx.JSON(http.StatusOK, successResp)
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	err = s.sendOneTimeCode(ctx.Request().Context(), user, oneTimeCodePasswordReset,
+		"%s is your password reset code. Do not share it with anyone.")
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	return ctx.JSON(http.StatusOK, successResp)
+}
+
+// ResetPassword sets a new password with a code sent by ForgotPassword, or
+// a recovery code, and signs the user out of every session.
+func (s *Server) ResetPassword(ctx echo.Context) error {
+	var (
+		successResp generated.ResetPasswordResponse
+	)
+
+	request := &generated.ResetPasswordRequest{}
+	err := json.NewDecoder(ctx.Request().Body).Decode(&request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	err = validateResetPassword(request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	allowed, retryAfter, err := s.checkRateLimit(ctx, "password_reset", request.PhoneNumber)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if !allowed {
+		return sendRateLimitResponse(ctx, retryAfter)
+	}
+
+	user, err := s.getActiveUser(ctx.Request().Context(), request.PhoneNumber)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sendErrorResponse(ctx, http.StatusBadRequest, repository.ErrOneTimeCodeInvalid)
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	// a recovery code replaces the text message when the phone is lost
+	if request.RecoveryCode != nil {
+		used, err := s.useRecoveryCode(ctx, user.ID, *request.RecoveryCode, "password_reset")
+		if err != nil {
+			return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+		}
+
+		if !used {
+			return sendErrorResponse(ctx, http.StatusBadRequest, errRecoveryCodeInvalid)
+		}
+	} else {
+		err = s.verifyOneTimeCode(ctx.Request().Context(), user.ID, oneTimeCodePasswordReset, *request.Code)
+		if err != nil {
+			if errors.Is(err, repository.ErrOneTimeCodeInvalid) {
+				return sendErrorResponse(ctx, http.StatusBadRequest, err)
+			}
+			return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+		}
+	}
+
+	hashedPwd, err := s.PasswordHasher.Hash([]byte(request.NewPassword))
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	err = s.Repository.UpdatePassword(ctx.Request().Context(), user.ID, hashedPwd, user.ID)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	err = s.revokeOtherSessions(ctx.Request().Context(), user.ID, "")
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	successResp.Result = "reset password success"
+	return ctx.JSON(http.StatusOK, successResp)
+}
+
+// revokeOtherSessions revokes the refresh tokens of every session of a user
+// but keepSessionID, all of them when it is empty, and the tokens bound to
+// their session ids.
+func (s *Server) revokeOtherSessions(ctx context.Context, userID, keepSessionID string) error {
+	sessionIDs, err := s.Repository.RevokeOtherRefreshTokenFamilies(ctx, userID, keepSessionID)
+	if err != nil {
+		return err
+	}
+
+	for _, sessionID := range sessionIDs {
+		err = s.revokeSessionTokens(ctx, sessionID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// revokeSessionTokens revokes the access tokens of a session and the
+// /authorize cookie bound to it through the session id, until the longest
+// any of them can still be valid.
+func (s *Server) revokeSessionTokens(ctx context.Context, sessionID string) error {
+	return s.TokenRevocation.RevokeToken(ctx, sessionID, time.Now().Add(MaxTokenLifetime()))
+}
+
+func validateResetPassword(request *generated.ResetPasswordRequest) error {
+	errStrs := []string{}
+
+	if err := validateLoginPhoneNumber(request.PhoneNumber); err != nil {
+		errStrs = append(errStrs, err.Error())
+	}
+
+	if err := validateCodeOrRecoveryCode(request.Code, request.RecoveryCode); err != nil {
+		errStrs = append(errStrs, err.Error())
+	}
+
+	if err := validatePassword(request.NewPassword); err != nil {
+		errStrs = append(errStrs, "new_"+err.Error())
+	}
+
+	return helper.ErrStringsToErr(errStrs)
+}
+
+func validateChangePassword(request *generated.ChangePasswordRequest) error {
+	errStrs := []string{}
+
+	if request.CurrentPassword == "" {
+		errStrs = append(errStrs, "current_password: can't be empty")
+	}
+
+	if err := validatePassword(request.NewPassword); err != nil {
+		errStrs = append(errStrs, "new_"+err.Error())
+	} else if request.NewPassword == request.CurrentPassword {
+		errStrs = append(errStrs, "new_password: must be different from current_password")
+	}
+
+	return helper.ErrStringsToErr(errStrs)
+}
@@ -0,0 +1,260 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/sms"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangePassword(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository:      mockRepository,
+		TokenRevocation: repository.NewMemoryTokenRevocation(),
+		PasswordHasher:  newTestPasswordHasher(),
+	}
+
+	hashedPassword, _ := srv.PasswordHasher.Hash([]byte("AAAAAAAAA1a^1"))
+	mockUser := &repository.User{
+		ID:       "user-id",
+		Password: hashedPassword,
+	}
+
+	newContext := func(payload string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/profile/password", bytes.NewBufferString(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return withClaims(e.NewContext(req, rec), &Claims{UserID: "user-id", SessionID: "session-id"}), rec
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		c, rec := newContext(`{"current_password": "AAAAAAAAA1a^1", "new_password": "BBBBBBBBB2b^2"}`)
+
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().UpdatePassword(gomock.Any(), "user-id", gomock.Any(), "user-id").
+			DoAndReturn(func(_ context.Context, _, hashedPassword, _ string) error {
+				assert.Nil(t, srv.PasswordHasher.Compare(hashedPassword, []byte("BBBBBBBBB2b^2")))
+				return nil
+			}).Times(1)
+		mockRepository.EXPECT().RevokeOtherRefreshTokenFamilies(gomock.Any(), "user-id", "session-id").
+			Return([]string{"other-session-id"}, nil).Times(1)
+
+		err := srv.ChangePassword(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		revoked, _ := srv.TokenRevocation.IsTokenRevoked(context.Background(), "other-session-id")
+		assert.True(t, revoked)
+		revoked, _ = srv.TokenRevocation.IsTokenRevoked(context.Background(), "session-id")
+		assert.False(t, revoked)
+	})
+
+	t.Run("current password invalid", func(t *testing.T) {
+		c, rec := newContext(`{"current_password": "AAAAAAAAA1a^2", "new_password": "BBBBBBBBB2b^2"}`)
+
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().RecordLoginFailure(gomock.Any(), isLoginEvent("user-id", loginMethodPassword, loginFailureInvalidPassword), nil).
+			Return(nil).Times(1)
+
+		err := srv.ChangePassword(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("new password invalid", func(t *testing.T) {
+		c, rec := newContext(`{"current_password": "AAAAAAAAA1a^1", "new_password": "weak"}`)
+
+		err := srv.ChangePassword(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "new_password: must be at minimum 6 characters")
+	})
+
+	t.Run("new password unchanged", func(t *testing.T) {
+		c, rec := newContext(`{"current_password": "AAAAAAAAA1a^1", "new_password": "AAAAAAAAA1a^1"}`)
+
+		err := srv.ChangePassword(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("update password error", func(t *testing.T) {
+		c, rec := newContext(`{"current_password": "AAAAAAAAA1a^1", "new_password": "BBBBBBBBB2b^2"}`)
+
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().UpdatePassword(gomock.Any(), "user-id", gomock.Any(), "user-id").Return(errors.New("error")).Times(1)
+
+		err := srv.ChangePassword(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+
+	t.Run("revoke sessions error", func(t *testing.T) {
+		c, rec := newContext(`{"current_password": "AAAAAAAAA1a^1", "new_password": "BBBBBBBBB2b^2"}`)
+
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().UpdatePassword(gomock.Any(), "user-id", gomock.Any(), "user-id").Return(nil).Times(1)
+		mockRepository.EXPECT().RevokeOtherRefreshTokenFamilies(gomock.Any(), "user-id", "session-id").Return(nil, errors.New("error")).Times(1)
+
+		err := srv.ChangePassword(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
+
+func TestForgotPassword(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	var smsLog bytes.Buffer
+	srv := Server{
+		Repository: mockRepository,
+		SMSSender:  sms.NewLogSender(&smsLog),
+	}
+
+	newContext := func(payload string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/password/forgot", bytes.NewBufferString(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return e.NewContext(req, rec), rec
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		smsLog.Reset()
+		c, rec := newContext(`{"phone_number": "+622342342322"}`)
+
+		var storedCode *repository.OneTimeCode
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(&repository.User{ID: "user-id", PhoneNumber: "+622342342322"}, nil).Times(1)
+		mockRepository.EXPECT().StoreOneTimeCode(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, data *repository.OneTimeCode) error {
+				storedCode = data
+				return nil
+			}).Times(1)
+
+		err := srv.ForgotPassword(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		code := regexp.MustCompile(`message="(\d{6}) `).FindStringSubmatch(smsLog.String())[1]
+		assert.Contains(t, smsLog.String(), "to=+622342342322")
+		assert.Equal(t, oneTimeCodePasswordReset, storedCode.Purpose)
+		assert.Equal(t, hashOneTimeCode("user-id", code), storedCode.CodeHash)
+	})
+
+	t.Run("phone number not registered", func(t *testing.T) {
+		smsLog.Reset()
+		c, rec := newContext(`{"phone_number": "+622342342322"}`)
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(nil, sql.ErrNoRows).Times(1)
+
+		err := srv.ForgotPassword(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, smsLog.String())
+	})
+
+	t.Run("store code error", func(t *testing.T) {
+		c, rec := newContext(`{"phone_number": "+622342342322"}`)
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(&repository.User{ID: "user-id"}, nil).Times(1)
+		mockRepository.EXPECT().StoreOneTimeCode(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
+
+		err := srv.ForgotPassword(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
+
+func TestResetPassword(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository:      mockRepository,
+		TokenRevocation: repository.NewMemoryTokenRevocation(),
+		PasswordHasher:  newTestPasswordHasher(),
+	}
+
+	mockUser := &repository.User{ID: "user-id", PhoneNumber: "+622342342322"}
+
+	newContext := func(payload string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/password/reset", bytes.NewBufferString(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return e.NewContext(req, rec), rec
+	}
+
+	payload := `{"phone_number": "+622342342322", "code": "123456", "new_password": "BBBBBBBBB2b^2"}`
+
+	t.Run("positive", func(t *testing.T) {
+		c, rec := newContext(payload)
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().ConsumeOneTimeCode(gomock.Any(), "user-id", oneTimeCodePasswordReset, hashOneTimeCode("user-id", "123456"), MaxOneTimeCodeAttempts).
+			Return(&repository.OneTimeCode{}, nil).Times(1)
+		mockRepository.EXPECT().UpdatePassword(gomock.Any(), "user-id", gomock.Any(), "user-id").Return(nil).Times(1)
+		mockRepository.EXPECT().RevokeOtherRefreshTokenFamilies(gomock.Any(), "user-id", "").Return([]string{"session-id"}, nil).Times(1)
+
+		err := srv.ResetPassword(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		revoked, _ := srv.TokenRevocation.IsTokenRevoked(context.Background(), "session-id")
+		assert.True(t, revoked)
+	})
+
+	t.Run("code invalid", func(t *testing.T) {
+		c, rec := newContext(payload)
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().ConsumeOneTimeCode(gomock.Any(), "user-id", oneTimeCodePasswordReset, gomock.Any(), MaxOneTimeCodeAttempts).
+			Return(nil, repository.ErrOneTimeCodeInvalid).Times(1)
+
+		err := srv.ResetPassword(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("no pending code", func(t *testing.T) {
+		c, rec := newContext(payload)
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().ConsumeOneTimeCode(gomock.Any(), "user-id", oneTimeCodePasswordReset, gomock.Any(), MaxOneTimeCodeAttempts).
+			Return(nil, sql.ErrNoRows).Times(1)
+
+		err := srv.ResetPassword(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("phone number not registered", func(t *testing.T) {
+		c, rec := newContext(payload)
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(nil, sql.ErrNoRows).Times(1)
+
+		err := srv.ResetPassword(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("payload invalid", func(t *testing.T) {
+		c, rec := newContext(`{"phone_number": "", "code": "", "new_password": "weak"}`)
+
+		err := srv.ResetPassword(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
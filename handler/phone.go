@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/helper"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/labstack/echo/v4"
+)
+
+var errPhoneNotVerified = errors.New("Phone number is not verified")
+
+// VerifyPhone marks the phone number as verified with the code sent after
+// registration or by ResendPhoneVerification.
+func (s *Server) VerifyPhone(ctx echo.Context) error {
+	var (
+		successResp generated.VerifyPhoneResponse
+	)
+
+	request := &generated.VerifyPhoneRequest{}
+	err := json.NewDecoder(ctx.Request().Body).Decode(&request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	err = validateVerifyPhone(request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	allowed, retryAfter, err := s.checkRateLimit(ctx, "phone_verification", request.PhoneNumber)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if !allowed {
+		return sendRateLimitResponse(ctx, retryAfter)
+	}
+
+	user, err := s.getActiveUser(ctx.Request().Context(), request.PhoneNumber)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sendErrorResponse(ctx, http.StatusBadRequest, repository.ErrOneTimeCodeInvalid)
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	err = s.verifyOneTimeCode(ctx.Request().Context(), user.ID, oneTimeCodePhoneVerification, request.Code)
+	if err != nil {
+		if errors.Is(err, repository.ErrOneTimeCodeInvalid) {
+			return sendErrorResponse(ctx, http.StatusBadRequest, err)
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	err = s.Repository.VerifyPhoneNumber(ctx.Request().Context(), user.ID)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	successResp.Result = "verify phone success"
+	return ctx.JSON(http.StatusOK, successResp)
+}
+
+// ResendPhoneVerification sends a new verification code to an unverified
+// phone number. The response does not tell whether the number is registered.
+func (s *Server) ResendPhoneVerification(ctx echo.Context) error {
+	var (
+		successResp generated.ResendPhoneVerificationResponse
+	)
+
+	request := &generated.ResendPhoneVerificationRequest{}
+	err := json.NewDecoder(ctx.Request().Body).Decode(&request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	err = validateLoginPhoneNumber(request.PhoneNumber)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	allowed, retryAfter, err := s.checkRateLimit(ctx, "phone_verification", request.PhoneNumber)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if !allowed {
+		return sendRateLimitResponse(ctx, retryAfter)
+	}
+
+	successResp.Result = "a verification code is sent if the phone number is registered and not verified"
+
+	user, err := s.getActiveUser(ctx.Request().Context(), request.PhoneNumber)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ctx.JSON(http.StatusOK, successResp)
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if user.PhoneVerifiedAt != nil {
+		return ctx.JSON(http.StatusOK, successResp)
+	}
+
+	err = s.sendPhoneVerification(ctx.Request().Context(), user)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	return ctx.JSON(http.StatusOK, successResp)
+}
+
+func (s *Server) sendPhoneVerification(ctx context.Context, user *repository.User) error {
+	return s.sendOneTimeCode(ctx, user, oneTimeCodePhoneVerification,
+		"%s is your phone verification code. Do not share it with anyone.")
+}
+
+func validateVerifyPhone(request *generated.VerifyPhoneRequest) error {
+	errStrs := []string{}
+
+	if err := validateLoginPhoneNumber(request.PhoneNumber); err != nil {
+		errStrs = append(errStrs, err.Error())
+	}
+
+	if request.Code == "" {
+		errStrs = append(errStrs, "code: can't be empty")
+	}
+
+	return helper.ErrStringsToErr(errStrs)
+}
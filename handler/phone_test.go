@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/sms"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyPhone(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository: mockRepository,
+	}
+
+	mockUser := &repository.User{ID: "user-id", PhoneNumber: "+622342342322"}
+
+	newContext := func(payload string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/phone/verify", bytes.NewBufferString(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return e.NewContext(req, rec), rec
+	}
+
+	payload := `{"phone_number": "+622342342322", "code": "123456"}`
+
+	t.Run("positive", func(t *testing.T) {
+		c, rec := newContext(payload)
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().ConsumeOneTimeCode(gomock.Any(), "user-id", oneTimeCodePhoneVerification, hashOneTimeCode("user-id", "123456"), MaxOneTimeCodeAttempts).
+			Return(&repository.OneTimeCode{}, nil).Times(1)
+		mockRepository.EXPECT().VerifyPhoneNumber(gomock.Any(), "user-id").Return(nil).Times(1)
+
+		err := srv.VerifyPhone(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("code invalid", func(t *testing.T) {
+		c, rec := newContext(payload)
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().ConsumeOneTimeCode(gomock.Any(), "user-id", oneTimeCodePhoneVerification, gomock.Any(), MaxOneTimeCodeAttempts).
+			Return(nil, repository.ErrOneTimeCodeInvalid).Times(1)
+
+		err := srv.VerifyPhone(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("verify phone number error", func(t *testing.T) {
+		c, rec := newContext(payload)
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().ConsumeOneTimeCode(gomock.Any(), "user-id", oneTimeCodePhoneVerification, gomock.Any(), MaxOneTimeCodeAttempts).
+			Return(&repository.OneTimeCode{}, nil).Times(1)
+		mockRepository.EXPECT().VerifyPhoneNumber(gomock.Any(), "user-id").Return(errors.New("error")).Times(1)
+
+		err := srv.VerifyPhone(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+
+	t.Run("payload invalid", func(t *testing.T) {
+		c, rec := newContext(`{"phone_number": "+asd", "code": ""}`)
+
+		err := srv.VerifyPhone(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestResendPhoneVerification(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	var smsLog bytes.Buffer
+	srv := Server{
+		Repository: mockRepository,
+		SMSSender:  sms.NewLogSender(&smsLog),
+	}
+
+	newContext := func() (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/phone/verify/resend", bytes.NewBufferString(`{"phone_number": "+622342342322"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return e.NewContext(req, rec), rec
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		smsLog.Reset()
+		c, rec := newContext()
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(&repository.User{ID: "user-id", PhoneNumber: "+622342342322"}, nil).Times(1)
+		mockRepository.EXPECT().StoreOneTimeCode(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		err := srv.ResendPhoneVerification(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, smsLog.String(), "phone verification code")
+	})
+
+	t.Run("already verified", func(t *testing.T) {
+		smsLog.Reset()
+		c, rec := newContext()
+
+		verifiedAt := time.Now()
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(&repository.User{ID: "user-id", PhoneVerifiedAt: &verifiedAt}, nil).Times(1)
+
+		err := srv.ResendPhoneVerification(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, smsLog.String())
+	})
+
+	t.Run("phone number not registered", func(t *testing.T) {
+		c, rec := newContext()
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(nil, sql.ErrNoRows).Times(1)
+
+		err := srv.ResendPhoneVerification(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
@@ -1,10 +1,7 @@
 package handler
 
 import (
-	"crypto/rsa"
-	"crypto/x509"
 	"encoding/json"
-	"encoding/pem"
 	"errors"
 	"net/http"
 	"strings"
@@ -12,46 +9,23 @@ import (
 	"github.com/SawitProRecruitment/UserService/generated"
 	"github.com/SawitProRecruitment/UserService/helper"
 	"github.com/SawitProRecruitment/UserService/repository"
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/labstack/echo/v4"
 )
 
-func (s *Server) GetProfile(ctx echo.Context, params generated.GetProfileParams) error {
+func (s *Server) GetProfile(ctx echo.Context) error {
 	var (
 		successResp generated.GetProfileResponse
 	)
 
-	authHeader := params.Authorization
-	splittedAuth := strings.Split(authHeader, " ")
-	if len(splittedAuth) < 2 {
-		return sendErrorResponse(ctx, http.StatusBadRequest, errors.New("Auth header is not valid"))
-	}
-
-	tknStr := splittedAuth[1]
-	claims := &Claims{}
-
-	block, _ := pem.Decode([]byte(PrivateKey))
-	parseResult, _ := x509.ParsePKCS8PrivateKey(block.Bytes)
-	key := parseResult.(*rsa.PrivateKey)
-
-	tkn, err := ParseWithClaims(tknStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return key.Public(), nil
-	})
-	if err != nil {
-		if err == jwt.ErrSignatureInvalid {
-			return sendErrorResponse(ctx, http.StatusForbidden, errors.New("User is not authorized"))
-		}
-		return sendErrorResponse(ctx, http.StatusForbidden, err)
-	}
-
-	if !tkn.Valid {
+	claims, ok := ClaimsFromContext(ctx.Request().Context())
+	if !ok {
 		return sendErrorResponse(ctx, http.StatusForbidden, errors.New("User is not authorized"))
 	}
 
 	// get user data by user id
-	user, err := s.Repository.GetUserByID(ctx.Request().Context(), claims.UserID)
+	user, err := s.getActiveUserByID(ctx.Request().Context(), claims.UserID)
 	if err != nil {
-		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+		return sendUserLookupError(ctx, err)
 	}
 
 	successResp.FullName = user.FullName
@@ -60,41 +34,18 @@ func (s *Server) GetProfile(ctx echo.Context, params generated.GetProfileParams)
 	return ctx.JSON(http.StatusOK, successResp)
 }
 
-func (s *Server) UpdateProfile(ctx echo.Context, params generated.UpdateProfileParams) error {
+func (s *Server) UpdateProfile(ctx echo.Context) error {
 	var (
 		successResp generated.UpdateProfileResponse
 	)
 
-	authHeader := params.Authorization
-	splittedAuth := strings.Split(authHeader, " ")
-	if len(splittedAuth) < 2 {
-		return sendErrorResponse(ctx, http.StatusBadRequest, errors.New("Auth header is not valid"))
-	}
-
-	tknStr := splittedAuth[1]
-	claims := &Claims{}
-
-	block, _ := pem.Decode([]byte(PrivateKey))
-	parseResult, _ := x509.ParsePKCS8PrivateKey(block.Bytes)
-	key := parseResult.(*rsa.PrivateKey)
-
-	tkn, err := ParseWithClaims(tknStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return key.Public(), nil
-	})
-	if err != nil {
-		if err == jwt.ErrSignatureInvalid {
-			return sendErrorResponse(ctx, http.StatusForbidden, errors.New("User is not authorized"))
-		}
-
-		return sendErrorResponse(ctx, http.StatusForbidden, err)
-	}
-
-	if !tkn.Valid {
+	claims, ok := ClaimsFromContext(ctx.Request().Context())
+	if !ok {
 		return sendErrorResponse(ctx, http.StatusForbidden, errors.New("User is not authorized"))
 	}
 
 	request := &generated.UpdateProfileRequest{}
-	err = json.NewDecoder(ctx.Request().Body).Decode(&request)
+	err := json.NewDecoder(ctx.Request().Body).Decode(&request)
 	if err != nil {
 		return sendErrorResponse(ctx, http.StatusBadRequest, err)
 	}
@@ -2,15 +2,12 @@ package handler
 
 import (
 	"bytes"
-	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
-	"github.com/SawitProRecruitment/UserService/generated"
 	"github.com/SawitProRecruitment/UserService/repository"
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/golang/mock/gomock"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
@@ -23,101 +20,54 @@ func TestGetProfile(t *testing.T) {
 		Repository: mockRepository,
 	}
 
-	mockAuthHeader := "Bearer eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9"
-	profileParams := generated.GetProfileParams{
-		Authorization: mockAuthHeader,
+	newContext := func() (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return withClaims(e.NewContext(req, rec), &Claims{UserID: "user-id"}), rec
 	}
 
-	req := httptest.NewRequest(http.MethodGet, "/profile", nil)
-	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	rec := httptest.NewRecorder()
-
-	e := echo.New()
-	c := e.NewContext(req, rec)
-
 	t.Run("positive", func(t *testing.T) {
-		tempParseWithClaims := ParseWithClaims
-		ret := &jwt.Token{
-			Valid: true,
-		}
-		ParseWithClaims = func(tokenString string, claims jwt.Claims, keyFunc jwt.Keyfunc, options ...jwt.ParserOption) (*jwt.Token, error) {
-			return ret, nil
-		}
-
-		defer func() {
-			ParseWithClaims = tempParseWithClaims
-		}()
+		c, rec := newContext()
 
-		mockRepository.EXPECT().GetUserByID(gomock.Any(), gomock.Any()).Return(&repository.User{}, nil).Times(1)
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(&repository.User{}, nil).Times(1)
 
-		err := srv.GetProfile(c, profileParams)
+		err := srv.GetProfile(c)
 		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
 	})
 
 	t.Run("get user by id error", func(t *testing.T) {
-		tempParseWithClaims := ParseWithClaims
-		ret := &jwt.Token{
-			Valid: true,
-		}
-		ParseWithClaims = func(tokenString string, claims jwt.Claims, keyFunc jwt.Keyfunc, options ...jwt.ParserOption) (*jwt.Token, error) {
-			return ret, nil
-		}
-
-		defer func() {
-			ParseWithClaims = tempParseWithClaims
-		}()
+		c, rec := newContext()
 
 		mockRepository.EXPECT().GetUserByID(gomock.Any(), gomock.Any()).Return(&repository.User{}, errors.New("error")).Times(1)
 
-		err := srv.GetProfile(c, profileParams)
+		err := srv.GetProfile(c)
 		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
 	})
 
-	t.Run("token invalid", func(t *testing.T) {
-		tempParseWithClaims := ParseWithClaims
-		ret := &jwt.Token{
-			Valid: false,
-		}
-		ParseWithClaims = func(tokenString string, claims jwt.Claims, keyFunc jwt.Keyfunc, options ...jwt.ParserOption) (*jwt.Token, error) {
-			return ret, nil
-		}
-
-		defer func() {
-			ParseWithClaims = tempParseWithClaims
-		}()
+	t.Run("account suspended", func(t *testing.T) {
+		c, rec := newContext()
 
-		err := srv.GetProfile(c, profileParams)
-		assert.Nil(t, err, "error should be nil")
-	})
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(&repository.User{Status: repository.UserStatusSuspended}, nil).Times(1)
 
-	t.Run("parse with claims error", func(t *testing.T) {
-		err := srv.GetProfile(c, profileParams)
+		err := srv.GetProfile(c)
 		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), errAccountSuspended.Error())
 	})
 
-	t.Run("auth token invalid", func(t *testing.T) {
-		profileParams := generated.GetProfileParams{
-			Authorization: "mockAuthHeader",
-		}
-		err := srv.GetProfile(c, profileParams)
-		assert.Nil(t, err, "error should be nil")
-	})
-
-	t.Run("signature invalid", func(t *testing.T) {
-		tempParseWithClaims := ParseWithClaims
-		ret := &jwt.Token{
-			Valid: false,
-		}
-		ParseWithClaims = func(tokenString string, claims jwt.Claims, keyFunc jwt.Keyfunc, options ...jwt.ParserOption) (*jwt.Token, error) {
-			return ret, jwt.ErrSignatureInvalid
-		}
-
-		defer func() {
-			ParseWithClaims = tempParseWithClaims
-		}()
+	t.Run("claims missing", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		c := e.NewContext(req, rec)
 
-		err := srv.GetProfile(c, profileParams)
+		err := srv.GetProfile(c)
 		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
 	})
 }
 
@@ -128,295 +78,77 @@ func TestUpdateProfile(t *testing.T) {
 		Repository: mockRepository,
 	}
 
-	mockAuthHeader := "Bearer eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9"
-	profileParams := generated.UpdateProfileParams{
-		Authorization: mockAuthHeader,
-	}
-
-	t.Run("positive", func(t *testing.T) {
-		payload := []byte(
-			`{
-				"full_name": "hai",
-				"phone_number": "+622342342322"
-			}`)
-
-		param := generated.UpdateProfileRequest{}
-		paramBytes := payload
-		_ = json.Unmarshal(paramBytes, &param)
-
-		req := httptest.NewRequest(http.MethodPatch, "/profile/update", bytes.NewBuffer(paramBytes))
+	newContext := func(payload string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPatch, "/profile/update", bytes.NewBufferString(payload))
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
-
 		e := echo.New()
-		c := e.NewContext(req, rec)
+		return withClaims(e.NewContext(req, rec), &Claims{UserID: "user-id"}), rec
+	}
 
-		tempParseWithClaims := ParseWithClaims
-		ret := &jwt.Token{
-			Valid: true,
-		}
-		ParseWithClaims = func(tokenString string, claims jwt.Claims, keyFunc jwt.Keyfunc, options ...jwt.ParserOption) (*jwt.Token, error) {
-			return ret, nil
-		}
+	payload := `{
+		"full_name": "hai",
+		"phone_number": "+622342342322"
+	}`
 
-		defer func() {
-			ParseWithClaims = tempParseWithClaims
-		}()
+	t.Run("positive", func(t *testing.T) {
+		c, rec := newContext(payload)
 
 		mockRepository.EXPECT().UpdateProfile(gomock.Any(), gomock.Any()).Return(nil).Times(1)
 
-		err := srv.UpdateProfile(c, profileParams)
+		err := srv.UpdateProfile(c)
 		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
 	})
 
 	t.Run("update profile error", func(t *testing.T) {
-		payload := []byte(
-			`{
-				"full_name": "hai",
-				"phone_number": "+622342342322"
-			}`)
-
-		param := generated.UpdateProfileRequest{}
-		paramBytes := payload
-		_ = json.Unmarshal(paramBytes, &param)
-
-		req := httptest.NewRequest(http.MethodPatch, "/profile/update", bytes.NewBuffer(paramBytes))
-		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-		rec := httptest.NewRecorder()
-
-		e := echo.New()
-		c := e.NewContext(req, rec)
-
-		tempParseWithClaims := ParseWithClaims
-		ret := &jwt.Token{
-			Valid: true,
-		}
-		ParseWithClaims = func(tokenString string, claims jwt.Claims, keyFunc jwt.Keyfunc, options ...jwt.ParserOption) (*jwt.Token, error) {
-			return ret, nil
-		}
-
-		defer func() {
-			ParseWithClaims = tempParseWithClaims
-		}()
+		c, rec := newContext(payload)
 
 		mockRepository.EXPECT().UpdateProfile(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
 
-		err := srv.UpdateProfile(c, profileParams)
+		err := srv.UpdateProfile(c)
 		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
 	})
 
 	t.Run("update profile error - user is not exist", func(t *testing.T) {
-		payload := []byte(
-			`{
-				"full_name": "hai",
-				"phone_number": "+622342342322"
-			}`)
-
-		param := generated.UpdateProfileRequest{}
-		paramBytes := payload
-		_ = json.Unmarshal(paramBytes, &param)
-
-		req := httptest.NewRequest(http.MethodPatch, "/profile/update", bytes.NewBuffer(paramBytes))
-		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-		rec := httptest.NewRecorder()
-
-		e := echo.New()
-		c := e.NewContext(req, rec)
-
-		tempParseWithClaims := ParseWithClaims
-		ret := &jwt.Token{
-			Valid: true,
-		}
-		ParseWithClaims = func(tokenString string, claims jwt.Claims, keyFunc jwt.Keyfunc, options ...jwt.ParserOption) (*jwt.Token, error) {
-			return ret, nil
-		}
-
-		defer func() {
-			ParseWithClaims = tempParseWithClaims
-		}()
+		c, rec := newContext(payload)
 
 		mockRepository.EXPECT().UpdateProfile(gomock.Any(), gomock.Any()).Return(errors.New("user is not exist")).Times(1)
 
-		err := srv.UpdateProfile(c, profileParams)
+		err := srv.UpdateProfile(c)
 		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
 	})
 
 	t.Run("update profile error - phone number conflict", func(t *testing.T) {
-		payload := []byte(
-			`{
-				"full_name": "hai",
-				"phone_number": "+622342342322"
-			}`)
-
-		param := generated.UpdateProfileRequest{}
-		paramBytes := payload
-		_ = json.Unmarshal(paramBytes, &param)
-
-		req := httptest.NewRequest(http.MethodPatch, "/profile/update", bytes.NewBuffer(paramBytes))
-		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-		rec := httptest.NewRecorder()
-
-		e := echo.New()
-		c := e.NewContext(req, rec)
-
-		tempParseWithClaims := ParseWithClaims
-		ret := &jwt.Token{
-			Valid: true,
-		}
-		ParseWithClaims = func(tokenString string, claims jwt.Claims, keyFunc jwt.Keyfunc, options ...jwt.ParserOption) (*jwt.Token, error) {
-			return ret, nil
-		}
-
-		defer func() {
-			ParseWithClaims = tempParseWithClaims
-		}()
+		c, rec := newContext(payload)
 
 		mockRepository.EXPECT().UpdateProfile(gomock.Any(), gomock.Any()).Return(errors.New("pq: duplicate key value")).Times(1)
 
-		err := srv.UpdateProfile(c, profileParams)
+		err := srv.UpdateProfile(c)
 		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusConflict, rec.Code)
 	})
 
 	t.Run("error validate payload", func(t *testing.T) {
-		payload := []byte(
-			`{
-				"full_name": "",
-				"phone_number": ""
-			}`)
-
-		param := generated.UpdateProfileRequest{}
-		paramBytes := payload
-		_ = json.Unmarshal(paramBytes, &param)
-
-		req := httptest.NewRequest(http.MethodPatch, "/profile/update", bytes.NewBuffer(paramBytes))
-		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-		rec := httptest.NewRecorder()
-
-		e := echo.New()
-		c := e.NewContext(req, rec)
+		c, rec := newContext(`{
+			"full_name": "h",
+			"phone_number": "2342342322"
+		}`)
 
-		tempParseWithClaims := ParseWithClaims
-		ret := &jwt.Token{
-			Valid: true,
-		}
-		ParseWithClaims = func(tokenString string, claims jwt.Claims, keyFunc jwt.Keyfunc, options ...jwt.ParserOption) (*jwt.Token, error) {
-			return ret, nil
-		}
-
-		defer func() {
-			ParseWithClaims = tempParseWithClaims
-		}()
-
-		err := srv.UpdateProfile(c, profileParams)
+		err := srv.UpdateProfile(c)
 		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
 	})
 
 	t.Run("decode request error", func(t *testing.T) {
-		payload := []byte(
-			`{
-				"full_name": "asdas",
-				"phone_number": 1
-			}`)
-
-		param := generated.UpdateProfileRequest{}
-		paramBytes := payload
-		_ = json.Unmarshal(paramBytes, &param)
-
-		req := httptest.NewRequest(http.MethodPatch, "/profile/update", bytes.NewBuffer(paramBytes))
-		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-		rec := httptest.NewRecorder()
-
-		e := echo.New()
-		c := e.NewContext(req, rec)
-
-		tempParseWithClaims := ParseWithClaims
-		ret := &jwt.Token{
-			Valid: true,
-		}
-		ParseWithClaims = func(tokenString string, claims jwt.Claims, keyFunc jwt.Keyfunc, options ...jwt.ParserOption) (*jwt.Token, error) {
-			return ret, nil
-		}
-
-		defer func() {
-			ParseWithClaims = tempParseWithClaims
-		}()
-
-		err := srv.UpdateProfile(c, profileParams)
-		assert.Nil(t, err, "error should be nil")
-	})
-
-	t.Run("signature invalid", func(t *testing.T) {
-		req := httptest.NewRequest(http.MethodPatch, "/profile/update", nil)
-		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-		rec := httptest.NewRecorder()
-
-		e := echo.New()
-		c := e.NewContext(req, rec)
-
-		tempParseWithClaims := ParseWithClaims
-		ret := &jwt.Token{
-			Valid: false,
-		}
-		ParseWithClaims = func(tokenString string, claims jwt.Claims, keyFunc jwt.Keyfunc, options ...jwt.ParserOption) (*jwt.Token, error) {
-			return ret, jwt.ErrSignatureInvalid
-		}
-
-		defer func() {
-			ParseWithClaims = tempParseWithClaims
-		}()
-
-		err := srv.UpdateProfile(c, profileParams)
-		assert.Nil(t, err, "error should be nil")
-	})
-
-	t.Run("token invalid", func(t *testing.T) {
-		req := httptest.NewRequest(http.MethodPatch, "/profile/update", nil)
-		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-		rec := httptest.NewRecorder()
-
-		e := echo.New()
-		c := e.NewContext(req, rec)
-
-		tempParseWithClaims := ParseWithClaims
-		ret := &jwt.Token{
-			Valid: false,
-		}
-		ParseWithClaims = func(tokenString string, claims jwt.Claims, keyFunc jwt.Keyfunc, options ...jwt.ParserOption) (*jwt.Token, error) {
-			return ret, nil
-		}
-
-		defer func() {
-			ParseWithClaims = tempParseWithClaims
-		}()
-
-		err := srv.UpdateProfile(c, profileParams)
-		assert.Nil(t, err, "error should be nil")
-	})
-
-	t.Run("parse with claims error", func(t *testing.T) {
-		req := httptest.NewRequest(http.MethodPatch, "/profile/update", nil)
-		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-		rec := httptest.NewRecorder()
-
-		e := echo.New()
-		c := e.NewContext(req, rec)
-
-		err := srv.UpdateProfile(c, profileParams)
-		assert.Nil(t, err, "error should be nil")
-	})
-
-	t.Run("auth token invalid", func(t *testing.T) {
-		profileParams := generated.UpdateProfileParams{
-			Authorization: "mockAuthHeader",
-		}
-		req := httptest.NewRequest(http.MethodPatch, "/profile/update", nil)
-		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-		rec := httptest.NewRecorder()
-
-		e := echo.New()
-		c := e.NewContext(req, rec)
+		c, rec := newContext(`{
+			"full_name": 1
+		}`)
 
-		err := srv.UpdateProfile(c, profileParams)
+		err := srv.UpdateProfile(c)
 		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
 	})
 }
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/ratelimit"
+	"github.com/labstack/echo/v4"
+)
+
+// RateLimits of the operations creating or guessing credentials, applied
+// per operation both to the client IP and to the phone number.
+type RateLimits struct {
+	IP          ratelimit.Limit
+	PhoneNumber ratelimit.Limit
+}
+
+// DefaultRateLimits is used unless configured otherwise.
+var DefaultRateLimits = RateLimits{
+	IP:          ratelimit.Limit{Burst: 20, Period: time.Minute},
+	PhoneNumber: ratelimit.Limit{Burst: 5, Period: time.Minute},
+}
+
+// checkRateLimit takes a token from the IP and the phone number buckets of
+// operation. It returns false and the time to wait when either is empty.
+func (s *Server) checkRateLimit(ctx echo.Context, operation, phoneNumber string) (bool, time.Duration, error) {
+	if s.RateLimitStore == nil {
+		return true, 0, nil
+	}
+
+	buckets := []struct {
+		key   string
+		limit ratelimit.Limit
+	}{
+		{key: operation + ":ip:" + ctx.RealIP(), limit: s.RateLimits.IP},
+		{key: operation + ":phone_number:" + phoneNumber, limit: s.RateLimits.PhoneNumber},
+	}
+
+	for _, bucket := range buckets {
+		result, err := s.RateLimitStore.Take(ctx.Request().Context(), bucket.key, bucket.limit)
+		if err != nil {
+			return false, 0, err
+		}
+
+		if !result.Allowed {
+			return false, result.RetryAfter, nil
+		}
+	}
+
+	return true, 0, nil
+}
+
+func sendRateLimitResponse(ctx echo.Context, retryAfter time.Duration) error {
+	return sendRetryAfterResponse(ctx, http.StatusTooManyRequests, "Too many requests", retryAfter)
+}
+
+// sendRetryAfterResponse tells the client to retry after a whole number of
+// seconds, both in the Retry-After header and in the body.
+func sendRetryAfterResponse(ctx echo.Context, httpCode int, message string, retryAfter time.Duration) error {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	ctx.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(seconds))
+
+	return ctx.JSON(httpCode, generated.RetryAfterErrorResponse{
+		Message:    fmt.Sprintf("%s, retry after %d seconds", message, seconds),
+		RetryAfter: seconds,
+	})
+}
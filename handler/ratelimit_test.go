@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/ratelimit"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/sms"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("error")
+}
+
+func TestRateLimit(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository:     mockRepository,
+		PasswordHasher: newTestPasswordHasher(),
+		RateLimits: RateLimits{
+			IP:          ratelimit.Limit{Burst: 2, Period: time.Minute},
+			PhoneNumber: ratelimit.Limit{Burst: 1, Period: time.Minute},
+		},
+	}
+
+	newContext := func(path, remoteAddr, payload string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		e.IPExtractor = echo.ExtractIPDirect()
+		return e.NewContext(req, rec), rec
+	}
+
+	loginPayload := func(phoneNumber string) string {
+		return `{"phone_number": "` + phoneNumber + `", "password": "AAAAAAAAA1a^1"}`
+	}
+
+	t.Run("login per phone number", func(t *testing.T) {
+		srv.RateLimitStore = ratelimit.NewMemoryStore(ratelimit.NewMemoryStoreOptions{})
+
+		c, rec := newContext("/login", "10.0.0.1:1234", loginPayload("+622342342322"))
+		mockRepository.EXPECT().GetUser(gomock.Any(), gomock.Any()).Return(nil, sql.ErrNoRows).Times(1)
+		mockRepository.EXPECT().RecordUnknownLoginFailure(gomock.Any(), "+622342342322", nil).Return(nil).Times(1)
+		_ = srv.Login(c)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+
+		c, rec = newContext("/login", "10.0.0.2:1234", loginPayload("+622342342322"))
+		err := srv.Login(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "60", rec.Header().Get(echo.HeaderRetryAfter))
+	})
+
+	t.Run("login per IP", func(t *testing.T) {
+		srv.RateLimitStore = ratelimit.NewMemoryStore(ratelimit.NewMemoryStoreOptions{})
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), gomock.Any()).Return(nil, sql.ErrNoRows).Times(2)
+		mockRepository.EXPECT().RecordUnknownLoginFailure(gomock.Any(), gomock.Any(), nil).Return(nil).Times(2)
+		for _, phoneNumber := range []string{"+622342342321", "+622342342322"} {
+			c, _ := newContext("/login", "10.0.0.1:1234", loginPayload(phoneNumber))
+			_ = srv.Login(c)
+		}
+
+		c, rec := newContext("/login", "10.0.0.1:1234", loginPayload("+622342342323"))
+		err := srv.Login(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "30", rec.Header().Get(echo.HeaderRetryAfter))
+	})
+
+	t.Run("register", func(t *testing.T) {
+		srv.RateLimitStore = ratelimit.NewMemoryStore(ratelimit.NewMemoryStoreOptions{})
+		payload := `{"full_name": "sadam 2", "phone_number": "+622342342322", "password": "AAAAAAAAA1a^1"}`
+
+		c, rec := newContext("/register", "10.0.0.1:1234", payload)
+		mockRepository.EXPECT().StoreRegistration(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
+		_ = srv.Register(c)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+		c, rec = newContext("/register", "10.0.0.1:1234", payload)
+		err := srv.Register(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	})
+
+	t.Run("password reset", func(t *testing.T) {
+		srv.RateLimitStore = ratelimit.NewMemoryStore(ratelimit.NewMemoryStoreOptions{})
+
+		c, rec := newContext("/password/forgot", "10.0.0.1:1234", `{"phone_number": "+622342342322"}`)
+		mockRepository.EXPECT().GetUser(gomock.Any(), gomock.Any()).Return(nil, sql.ErrNoRows).Times(1)
+		_ = srv.ForgotPassword(c)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		// confirming the code takes from the same buckets
+		c, rec = newContext("/password/reset", "10.0.0.1:1234",
+			`{"phone_number": "+622342342322", "code": "123456", "new_password": "AAAAAAAAA1a^2"}`)
+		err := srv.ResetPassword(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	})
+
+	t.Run("wrong codes hold the owner back for one period only", func(t *testing.T) {
+		now := time.Now()
+		srv.RateLimitStore = ratelimit.NewMemoryStore(ratelimit.NewMemoryStoreOptions{Now: func() time.Time { return now }})
+		srv.SMSSender = sms.NewLogSender(&bytes.Buffer{})
+		user := &repository.User{ID: "user-id", PhoneNumber: "+622342342322"}
+
+		// someone else guesses a code for the phone number
+		c, rec := newContext("/password/reset", "10.0.0.9:1234",
+			`{"phone_number": "+622342342322", "code": "123456", "new_password": "AAAAAAAAA1a^2"}`)
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(user, nil).Times(1)
+		mockRepository.EXPECT().ConsumeOneTimeCode(gomock.Any(), "user-id", oneTimeCodePasswordReset, gomock.Any(), MaxOneTimeCodeAttempts).
+			Return(nil, repository.ErrOneTimeCodeInvalid).Times(1)
+		_ = srv.ResetPassword(c)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		c, rec = newContext("/password/forgot", "10.0.0.1:1234", `{"phone_number": "+622342342322"}`)
+		_ = srv.ForgotPassword(c)
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+
+		// once the bucket refilled the owner gets a new code to try
+		now = now.Add(time.Minute)
+		c, rec = newContext("/password/forgot", "10.0.0.1:1234", `{"phone_number": "+622342342322"}`)
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(user, nil).Times(1)
+		mockRepository.EXPECT().StoreOneTimeCode(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, data *repository.OneTimeCode) error {
+				assert.Equal(t, 0, data.Attempts)
+				return nil
+			}).Times(1)
+		err := srv.ForgotPassword(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("phone verification", func(t *testing.T) {
+		srv.RateLimitStore = ratelimit.NewMemoryStore(ratelimit.NewMemoryStoreOptions{})
+
+		c, rec := newContext("/phone/verify/resend", "10.0.0.1:1234", `{"phone_number": "+622342342322"}`)
+		mockRepository.EXPECT().GetUser(gomock.Any(), gomock.Any()).Return(nil, sql.ErrNoRows).Times(1)
+		_ = srv.ResendPhoneVerification(c)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		c, rec = newContext("/phone/verify", "10.0.0.1:1234", `{"phone_number": "+622342342322", "code": "123456"}`)
+		err := srv.VerifyPhone(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	})
+
+	t.Run("password confirmation", func(t *testing.T) {
+		srv.RateLimitStore = ratelimit.NewMemoryStore(ratelimit.NewMemoryStoreOptions{})
+
+		c, rec := newContext("/login", "10.0.0.1:1234", loginPayload("+622342342322"))
+		mockRepository.EXPECT().GetUser(gomock.Any(), gomock.Any()).Return(nil, sql.ErrNoRows).Times(1)
+		mockRepository.EXPECT().RecordUnknownLoginFailure(gomock.Any(), "+622342342322", nil).Return(nil).Times(1)
+		_ = srv.Login(c)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+
+		// confirming the password of a signed in user takes from the login buckets
+		c, rec = newContext("/profile", "10.0.0.2:1234", `{"password": "AAAAAAAAA1a^1"}`)
+		c = withClaims(c, &Claims{UserID: "user-id"})
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").
+			Return(&repository.User{ID: "user-id", PhoneNumber: "+622342342322"}, nil).Times(1)
+		err := srv.DeleteProfile(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	})
+
+	t.Run("store error", func(t *testing.T) {
+		srv.RateLimitStore = failingRateLimitStore{}
+
+		c, rec := newContext("/login", "10.0.0.1:1234", loginPayload("+622342342322"))
+		err := srv.Login(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
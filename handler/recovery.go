@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	RecoveryCodeCount  = 10
+	RecoveryCodeLength = 10
+
+	// recoveryCodeAlphabet is Crockford's base32, without letters that read
+	// like digits. Its 32 symbols keep a random byte modulo uniform.
+	recoveryCodeAlphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+
+	auditRecoveryCodesGenerated = "recovery_codes_generated"
+	auditRecoveryCodeUsed       = "recovery_code_used"
+)
+
+var errRecoveryCodeInvalid = errors.New("Recovery code is not valid")
+
+// RegenerateRecoveryCodes replaces the recovery codes of the current user
+// with a new set, shown only in this response.
+func (s *Server) RegenerateRecoveryCodes(ctx echo.Context) error {
+	var (
+		successResp generated.RecoveryCodesResponse
+	)
+
+	claims, ok := ClaimsFromContext(ctx.Request().Context())
+	if !ok {
+		return sendErrorResponse(ctx, http.StatusForbidden, errors.New("User is not authorized"))
+	}
+
+	codes, err := s.generateRecoveryCodes(ctx, claims.UserID)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	successResp.RecoveryCodes = codes
+	return ctx.JSON(http.StatusOK, successResp)
+}
+
+// generateRecoveryCodes stores a new set of recovery codes for the user and
+// returns them in clear, they are only kept hashed.
+func (s *Server) generateRecoveryCodes(ctx echo.Context, userID string) ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	codeHashes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		codeHash, err := s.hashRecoveryCode(userID, code)
+		if err != nil {
+			return nil, err
+		}
+
+		codes[i] = code
+		codeHashes[i] = codeHash
+	}
+
+	err := s.Repository.ReplaceRecoveryCodes(ctx.Request().Context(), userID, codeHashes)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.recordAuditEvent(ctx, userID, auditRecoveryCodesGenerated, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// useRecoveryCode consumes a recovery code of the user in place of the
+// second factor or text message of flow, e.g. login. Every accepted code is
+// audited with flow as detail.
+func (s *Server) useRecoveryCode(ctx echo.Context, userID, code, flow string) (bool, error) {
+	// recovery codes are only generated along with two-factor authentication
+	if s.SecretCipher == nil {
+		return false, nil
+	}
+
+	codeHash, err := s.hashRecoveryCode(userID, code)
+	if err != nil {
+		return false, err
+	}
+
+	used, err := s.Repository.UseRecoveryCode(ctx.Request().Context(), userID, codeHash)
+	if err != nil || !used {
+		return false, err
+	}
+
+	err = s.recordAuditEvent(ctx, userID, auditRecoveryCodeUsed, flow)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// recordAuditEvent stores action on the account of userID along with the
+// client making the request.
+func (s *Server) recordAuditEvent(ctx echo.Context, userID, action, detail string) error {
+	return s.Repository.StoreAuditEvent(ctx.Request().Context(), &repository.AuditEvent{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Action:    action,
+		Detail:    detail,
+		IPAddress: ctx.RealIP(),
+		UserAgent: ctx.Request().UserAgent(),
+	})
+}
+
+// newRecoveryCode returns a code formatted as two groups of five symbols,
+// e.g. 3f9kx-q2m7a.
+func newRecoveryCode() (string, error) {
+	random := make([]byte, RecoveryCodeLength)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	code := make([]byte, 0, RecoveryCodeLength+1)
+	for i, b := range random {
+		if i == RecoveryCodeLength/2 {
+			code = append(code, '-')
+		}
+		code = append(code, recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)])
+	}
+
+	return string(code), nil
+}
+
+// hashRecoveryCode ignores case, spaces and dashes so codes can be typed
+// the way they are read. A plain hash of a code could be brute forced out of
+// a leaked dump, so codes are keyed with the secret of SecretCipher, which
+// two-factor authentication needs anyway.
+func (s *Server) hashRecoveryCode(userID, code string) (string, error) {
+	if s.SecretCipher == nil {
+		return "", errTOTPNotConfigured
+	}
+
+	normalized := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(code))
+
+	return s.SecretCipher.MAC([]byte(userID + ":" + normalized)), nil
+}
@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegenerateRecoveryCodes(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository:   mockRepository,
+		SecretCipher: newTestSecretCipher(t),
+	}
+
+	newContext := func() (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/profile/mfa/recovery-codes", nil)
+		req.Header.Set("User-Agent", "test-agent")
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return withClaims(e.NewContext(req, rec), &Claims{UserID: "user-id"}), rec
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		c, rec := newContext()
+
+		var codeHashes []string
+		mockRepository.EXPECT().ReplaceRecoveryCodes(gomock.Any(), "user-id", gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ string, hashes []string) error {
+				codeHashes = hashes
+				return nil
+			}).Times(1)
+		mockRepository.EXPECT().StoreAuditEvent(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, event *repository.AuditEvent) error {
+				assert.Equal(t, "user-id", event.UserID)
+				assert.Equal(t, auditRecoveryCodesGenerated, event.Action)
+				assert.Equal(t, "test-agent", event.UserAgent)
+				return nil
+			}).Times(1)
+
+		err := srv.RegenerateRecoveryCodes(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		resp := generated.RecoveryCodesResponse{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Len(t, resp.RecoveryCodes, RecoveryCodeCount)
+
+		// only hashes are stored, in the order of the codes
+		for i, code := range resp.RecoveryCodes {
+			assert.Regexp(t, regexp.MustCompile(`^[0-9a-z]{5}-[0-9a-z]{5}$`), code)
+			codeHash, _ := srv.hashRecoveryCode("user-id", code)
+			assert.Equal(t, codeHash, codeHashes[i])
+		}
+	})
+
+	t.Run("store error", func(t *testing.T) {
+		c, rec := newContext()
+
+		mockRepository.EXPECT().ReplaceRecoveryCodes(gomock.Any(), "user-id", gomock.Any()).Return(errors.New("error")).Times(1)
+
+		err := srv.RegenerateRecoveryCodes(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	srv := Server{
+		SecretCipher: newTestSecretCipher(t),
+	}
+
+	hash, err := srv.hashRecoveryCode("user-id", "3f9kx-q2m7a")
+	assert.Nil(t, err, "error should be nil")
+
+	for _, typed := range []string{"3F9KX Q2M7A", "3f9kxq2m7a"} {
+		typedHash, _ := srv.hashRecoveryCode("user-id", typed)
+		assert.Equal(t, hash, typedHash)
+	}
+
+	otherUserHash, _ := srv.hashRecoveryCode("other-user-id", "3f9kx-q2m7a")
+	assert.NotEqual(t, hash, otherUserHash)
+
+	// no plain hash, it can't be computed without the key
+	assert.NotEqual(t, hashOneTimeCode("user-id", "3f9kxq2m7a"), hash)
+
+	t.Run("two-factor authentication not configured", func(t *testing.T) {
+		_, err := (&Server{}).hashRecoveryCode("user-id", "3f9kx-q2m7a")
+		assert.ErrorIs(t, err, errTOTPNotConfigured)
+	})
+}
+
+func TestLoginMFARecoveryCode(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository:      mockRepository,
+		TokenRevocation: repository.NewMemoryTokenRevocation(),
+		KeyRing:         newTestKeyRing(t),
+		SecretCipher:    newTestSecretCipher(t),
+	}
+	mockUser := &repository.User{ID: "user-id", PhoneNumber: "+622342342322"}
+	recoveryCodeHash, _ := srv.hashRecoveryCode("user-id", "3f9kx-q2m7a")
+
+	newContext := func(payload string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/login/mfa", bytes.NewBufferString(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return e.NewContext(req, rec), rec
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		mfaToken, _ := srv.createMFAChallenge(mockUser, mfaMethodTOTP)
+		c, rec := newContext(fmt.Sprintf(`{"mfa_token": "%s", "recovery_code": "3F9KX-Q2M7A"}`, mfaToken))
+
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().UseRecoveryCode(gomock.Any(), "user-id", recoveryCodeHash).
+			Return(true, nil).Times(1)
+		mockRepository.EXPECT().StoreAuditEvent(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, event *repository.AuditEvent) error {
+				assert.Equal(t, auditRecoveryCodeUsed, event.Action)
+				assert.Equal(t, "login", event.Detail)
+				return nil
+			}).Times(1)
+		mockRepository.EXPECT().StoreSession(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().StoreRefreshToken(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().RecordLoginSuccess(gomock.Any(), isLoginEvent("user-id", loginMethodRecoveryCode, "")).Return(nil).Times(1)
+
+		err := srv.LoginMFA(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("used or unknown code", func(t *testing.T) {
+		mfaToken, _ := srv.createMFAChallenge(mockUser, mfaMethodTOTP)
+		c, rec := newContext(fmt.Sprintf(`{"mfa_token": "%s", "recovery_code": "3f9kx-q2m7a"}`, mfaToken))
+
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().UseRecoveryCode(gomock.Any(), "user-id", gomock.Any()).Return(false, nil).Times(1)
+		mockRepository.EXPECT().RecordLoginFailure(gomock.Any(), isLoginEvent("user-id", loginMethodRecoveryCode, loginFailureInvalidCode), nil).
+			Return(nil).Times(1)
+
+		err := srv.LoginMFA(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("both code and recovery code", func(t *testing.T) {
+		mfaToken, _ := srv.createMFAChallenge(mockUser, mfaMethodTOTP)
+		c, rec := newContext(fmt.Sprintf(`{"mfa_token": "%s", "code": "123456", "recovery_code": "3f9kx-q2m7a"}`, mfaToken))
+
+		err := srv.LoginMFA(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestResetPasswordRecoveryCode(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository:      mockRepository,
+		TokenRevocation: repository.NewMemoryTokenRevocation(),
+		PasswordHasher:  newTestPasswordHasher(),
+		SecretCipher:    newTestSecretCipher(t),
+	}
+	mockUser := &repository.User{ID: "user-id", PhoneNumber: "+622342342322"}
+	recoveryCodeHash, _ := srv.hashRecoveryCode("user-id", "3f9kx-q2m7a")
+
+	newContext := func() (echo.Context, *httptest.ResponseRecorder) {
+		payload := `{"phone_number": "+622342342322", "recovery_code": "3f9kx-q2m7a", "new_password": "BBBBBBBBB2b^2"}`
+		req := httptest.NewRequest(http.MethodPost, "/password/reset", bytes.NewBufferString(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return e.NewContext(req, rec), rec
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		c, rec := newContext()
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().UseRecoveryCode(gomock.Any(), "user-id", recoveryCodeHash).
+			Return(true, nil).Times(1)
+		mockRepository.EXPECT().StoreAuditEvent(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, event *repository.AuditEvent) error {
+				assert.Equal(t, auditRecoveryCodeUsed, event.Action)
+				assert.Equal(t, "password_reset", event.Detail)
+				return nil
+			}).Times(1)
+		mockRepository.EXPECT().UpdatePassword(gomock.Any(), "user-id", gomock.Any(), "user-id").Return(nil).Times(1)
+		mockRepository.EXPECT().RevokeOtherRefreshTokenFamilies(gomock.Any(), "user-id", "").Return(nil, nil).Times(1)
+
+		err := srv.ResetPassword(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("used or unknown code", func(t *testing.T) {
+		c, rec := newContext()
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().UseRecoveryCode(gomock.Any(), "user-id", gomock.Any()).Return(false, nil).Times(1)
+
+		err := srv.ResetPassword(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
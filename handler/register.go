@@ -14,7 +14,6 @@ import (
 	"github.com/SawitProRecruitment/UserService/repository"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
-	"golang.org/x/crypto/bcrypt"
 )
 
 const (
@@ -46,12 +45,21 @@ func (s *Server) Register(ctx echo.Context) error {
 		return sendErrorResponse(ctx, http.StatusBadRequest, err)
 	}
 
+	allowed, retryAfter, err := s.checkRateLimit(ctx, "register", request.PhoneNumber)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if !allowed {
+		return sendRateLimitResponse(ctx, retryAfter)
+	}
+
 	// hash password
-	hashedPwd, err := GenerateFromPassword([]byte(request.Password), bcrypt.MinCost)
+	hashedPwd, err := s.PasswordHasher.Hash([]byte(request.Password))
 	if err != nil {
 		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
 	}
-	request.Password = string(hashedPwd)
+	request.Password = hashedPwd
 
 	// set user id
 	userID := uuid.New().String()
@@ -73,6 +81,12 @@ func (s *Server) Register(ctx echo.Context) error {
 		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
 	}
 
+	// the account exists from here on, a lost code can be sent again
+	err = s.sendPhoneVerification(ctx.Request().Context(), registrationData)
+	if err != nil {
+		ctx.Logger().Warnf("send phone verification to user %s: %v", userID, err)
+	}
+
 	successResp.UserId = userID
 	return ctx.JSON(http.StatusOK, successResp)
 }
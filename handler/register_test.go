@@ -2,6 +2,7 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -9,17 +10,31 @@ import (
 	"testing"
 
 	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/password"
 	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/sms"
 	"github.com/golang/mock/gomock"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 )
 
+// failingScheme is a password scheme whose hashing always fails.
+type failingScheme struct {
+	password.Scheme
+}
+
+func (failingScheme) Hash(password []byte) (string, error) {
+	return "", errors.New("error")
+}
+
 func TestRegister(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	var smsLog bytes.Buffer
 	srv := Server{
-		Repository: mockRepository,
+		Repository:     mockRepository,
+		PasswordHasher: newTestPasswordHasher(),
+		SMSSender:      sms.NewLogSender(&smsLog),
 	}
 
 	var param generated.RegistrationRequest
@@ -41,9 +56,38 @@ func TestRegister(t *testing.T) {
 		c := e.NewContext(req, rec)
 
 		mockRepository.EXPECT().StoreRegistration(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().StoreOneTimeCode(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, data *repository.OneTimeCode) error {
+				assert.Equal(t, oneTimeCodePhoneVerification, data.Purpose)
+				return nil
+			}).Times(1)
+
+		err := srv.Register(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, smsLog.String(), "to=+622342342322")
+	})
+
+	t.Run("send phone verification error", func(t *testing.T) {
+		payload := []byte(
+			`{
+				"full_name":    "sadam 2",
+				"phone_number": "+622342342322",
+				"password":     "AAAAAAAAA1a^1"
+			}`)
+
+		req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewBuffer(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().StoreRegistration(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().StoreOneTimeCode(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
 
 		err := srv.Register(c)
 		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
 	})
 
 	t.Run("store registration error", func(t *testing.T) {
@@ -109,17 +153,12 @@ func TestRegister(t *testing.T) {
 		e := echo.New()
 		c := e.NewContext(req, rec)
 
-		tempGenerateFromPassword := GenerateFromPassword
-		GenerateFromPassword = func(password []byte, cost int) ([]byte, error) {
-			return []byte{}, errors.New("error")
-		}
-
-		defer func() {
-			GenerateFromPassword = tempGenerateFromPassword
-		}()
+		failingSrv := srv
+		failingSrv.PasswordHasher = password.NewHasher(failingScheme{})
 
-		err := srv.Register(c)
+		err := failingSrv.Register(c)
 		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
 	})
 
 	t.Run("payload invalid", func(t *testing.T) {
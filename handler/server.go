@@ -1,22 +1,98 @@
 package handler
 
 import (
+	"strings"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/encryption"
 	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/keyring"
+	"github.com/SawitProRecruitment/UserService/notify"
+	"github.com/SawitProRecruitment/UserService/password"
+	"github.com/SawitProRecruitment/UserService/ratelimit"
 	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/sms"
+	"github.com/SawitProRecruitment/UserService/webauthn"
 	"github.com/labstack/echo/v4"
 )
 
 type Server struct {
-	Repository repository.RepositoryInterface
+	Repository      repository.RepositoryInterface
+	TokenRevocation repository.TokenRevocationInterface
+	KeyRing         *keyring.KeyRing
+	PasswordHasher  *password.Hasher
+	SMSSender       sms.SMSSender
+	// SecretCipher encrypts the secrets of authenticator apps, nil disables
+	// two-factor authentication enrollment.
+	SecretCipher *encryption.Cipher
+	// WebAuthn is the relying party passkeys are registered for, nil
+	// disables passkeys.
+	WebAuthn *webauthn.RelyingParty
+	// RequirePhoneVerification refuses logins of users that have not
+	// verified their phone number yet.
+	RequirePhoneVerification bool
+	// EnableOTPLogin allows logging in with a code texted to the phone
+	// number in place of the password.
+	EnableOTPLogin bool
+	LockoutPolicy  LockoutPolicy
+	AnomalyPolicy  AnomalyPolicy
+	// AccountDeletionGracePeriod is how long a deleted account is kept
+	// before it is purged, DefaultAccountDeletionGracePeriod unless set.
+	AccountDeletionGracePeriod time.Duration
+	// Notifier tells users about logins flagged by AnomalyPolicy, nil
+	// only flags them in the login history.
+	Notifier notify.Notifier
+	// RateLimitStore keeps the buckets of RateLimits, nil disables rate
+	// limiting.
+	RateLimitStore ratelimit.Store
+	RateLimits     RateLimits
+	// Issuer is the public base URL of the service, used as iss claim
+	// and to build the OpenID Connect discovery document.
+	Issuer string
 }
 
 type NewServerOptions struct {
-	Repository repository.RepositoryInterface
+	Repository                 repository.RepositoryInterface
+	TokenRevocation            repository.TokenRevocationInterface
+	KeyRing                    *keyring.KeyRing
+	PasswordHasher             *password.Hasher
+	SMSSender                  sms.SMSSender
+	SecretCipher               *encryption.Cipher
+	WebAuthn                   *webauthn.RelyingParty
+	RequirePhoneVerification   bool
+	EnableOTPLogin             bool
+	LockoutPolicy              LockoutPolicy
+	AnomalyPolicy              AnomalyPolicy
+	Notifier                   notify.Notifier
+	AccountDeletionGracePeriod time.Duration
+	RateLimitStore             ratelimit.Store
+	RateLimits                 RateLimits
+	Issuer                     string
 }
 
 func NewServer(opts NewServerOptions) *Server {
+	accountDeletionGracePeriod := opts.AccountDeletionGracePeriod
+	if accountDeletionGracePeriod == 0 {
+		accountDeletionGracePeriod = DefaultAccountDeletionGracePeriod
+	}
+
 	return &Server{
-		Repository: opts.Repository,
+		Repository:                 opts.Repository,
+		TokenRevocation:            opts.TokenRevocation,
+		KeyRing:                    opts.KeyRing,
+		PasswordHasher:             opts.PasswordHasher,
+		SMSSender:                  opts.SMSSender,
+		SecretCipher:               opts.SecretCipher,
+		WebAuthn:                   opts.WebAuthn,
+		RequirePhoneVerification:   opts.RequirePhoneVerification,
+		EnableOTPLogin:             opts.EnableOTPLogin,
+		LockoutPolicy:              opts.LockoutPolicy,
+		AnomalyPolicy:              opts.AnomalyPolicy,
+		Notifier:                   opts.Notifier,
+		AccountDeletionGracePeriod: accountDeletionGracePeriod,
+		RateLimitStore:             opts.RateLimitStore,
+		RateLimits:                 opts.RateLimits,
+		Issuer:                     strings.TrimSuffix(opts.Issuer, "/"),
 	}
 }
 
@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+var errSessionNotFound = errors.New("Session is not found")
+
+// ListSessions returns the devices the user is logged in on.
+func (s *Server) ListSessions(ctx echo.Context) error {
+	var (
+		successResp generated.ListSessionsResponse
+	)
+
+	claims, ok := ClaimsFromContext(ctx.Request().Context())
+	if !ok {
+		return sendErrorResponse(ctx, http.StatusForbidden, errors.New("User is not authorized"))
+	}
+
+	sessions, err := s.Repository.ListSessions(ctx.Request().Context(), claims.UserID)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	successResp.Sessions = []generated.Session{}
+	for _, session := range sessions {
+		successResp.Sessions = append(successResp.Sessions, generated.Session{
+			Id:          session.ID,
+			DeviceLabel: session.DeviceLabel,
+			UserAgent:   session.UserAgent,
+			IpAddress:   session.IPAddress,
+			CreatedAt:   session.CreatedAt,
+			LastSeenAt:  session.LastSeenAt,
+			Current:     session.ID == claims.SessionID,
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, successResp)
+}
+
+// RevokeSession signs the user out of one session, its refresh tokens and
+// access tokens stop working right away.
+func (s *Server) RevokeSession(ctx echo.Context, id string) error {
+	var (
+		successResp generated.RevokeSessionResponse
+	)
+
+	claims, ok := ClaimsFromContext(ctx.Request().Context())
+	if !ok {
+		return sendErrorResponse(ctx, http.StatusForbidden, errors.New("User is not authorized"))
+	}
+
+	if _, err := uuid.Parse(id); err != nil {
+		return sendErrorResponse(ctx, http.StatusNotFound, errSessionNotFound)
+	}
+
+	session, err := s.Repository.GetSession(ctx.Request().Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sendErrorResponse(ctx, http.StatusNotFound, errSessionNotFound)
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	// sessions of other users do not exist as far as the caller knows
+	if session.UserID != claims.UserID {
+		return sendErrorResponse(ctx, http.StatusNotFound, errSessionNotFound)
+	}
+
+	err = s.Repository.RevokeRefreshTokenFamily(ctx.Request().Context(), session.ID)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	err = s.revokeSessionTokens(ctx.Request().Context(), session.ID)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	successResp.Result = "revoke session success"
+	return ctx.JSON(http.StatusOK, successResp)
+}
+
+// SignOutOtherSessions revokes every session of the user but the one of the
+// access token making the request.
+func (s *Server) SignOutOtherSessions(ctx echo.Context) error {
+	var (
+		successResp generated.RevokeSessionResponse
+	)
+
+	claims, ok := ClaimsFromContext(ctx.Request().Context())
+	if !ok {
+		return sendErrorResponse(ctx, http.StatusForbidden, errors.New("User is not authorized"))
+	}
+
+	err := s.revokeOtherSessions(ctx.Request().Context(), claims.UserID, claims.SessionID)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	successResp.Result = "sign out other sessions success"
+	return ctx.JSON(http.StatusOK, successResp)
+}
+
+// startSession records a new login of the user from the client making the
+// request and returns the session id, to be used as family of its refresh
+// tokens and as sid of its access tokens. authTime is when the user
+// authenticated, which refreshing the tokens of the session does not change.
+func (s *Server) startSession(ctx echo.Context, userID, deviceLabel string, authTime time.Time) (string, error) {
+	session := &repository.Session{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		DeviceLabel: deviceLabel,
+		UserAgent:   ctx.Request().UserAgent(),
+		IPAddress:   ctx.RealIP(),
+		AuthTime:    authTime,
+	}
+
+	err := s.Repository.StoreSession(ctx.Request().Context(), session)
+	if err != nil {
+		return "", err
+	}
+
+	return session.ID, nil
+}
+
+// userAgentBrowsers and userAgentPlatforms are matched in order, the first
+// product token found names the browser or platform. Edge and Opera also
+// claim to be Chrome, and Chrome to be Safari, so they come first.
+var (
+	userAgentBrowsers = []struct{ token, name string }{
+		{token: "Edg/", name: "Edge"},
+		{token: "OPR/", name: "Opera"},
+		{token: "SamsungBrowser/", name: "Samsung Internet"},
+		{token: "Firefox/", name: "Firefox"},
+		{token: "FxiOS/", name: "Firefox"},
+		{token: "CriOS/", name: "Chrome"},
+		{token: "Chrome/", name: "Chrome"},
+		{token: "Safari/", name: "Safari"},
+	}
+	userAgentPlatforms = []struct{ token, name string }{
+		{token: "Android", name: "Android"},
+		{token: "iPhone", name: "iPhone"},
+		{token: "iPad", name: "iPad"},
+		{token: "Windows", name: "Windows"},
+		{token: "Mac OS X", name: "macOS"},
+		{token: "CrOS", name: "ChromeOS"},
+		{token: "Linux", name: "Linux"},
+	}
+)
+
+// deviceLabel names the device of a user agent for people, e.g. "Chrome on
+// Android". Clients that are no browser are named by their first product
+// token, e.g. "okhttp".
+func deviceLabel(userAgent string) string {
+	var browser, platform string
+	for _, b := range userAgentBrowsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	for _, p := range userAgentPlatforms {
+		if strings.Contains(userAgent, p.token) {
+			platform = p.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	}
+
+	product, _, _ := strings.Cut(userAgent, "/")
+	product = strings.TrimSpace(product)
+	if product == "" {
+		return "Unknown device"
+	}
+
+	return product
+}
@@ -0,0 +1,272 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testSessionID      = "6f1b6a52-2d7c-4f0e-9a51-3c1f2b8d7e40"
+	testOtherSessionID = "0c8e2f3a-5b4d-4e6f-8a7b-9c0d1e2f3a4b"
+)
+
+func TestListSessions(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository: mockRepository,
+	}
+
+	newContext := func() (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodGet, "/sessions", nil)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		c := e.NewContext(req, rec)
+		return withClaims(c, &Claims{UserID: "user-id", SessionID: testSessionID}), rec
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		c, rec := newContext()
+
+		lastSeenAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		mockRepository.EXPECT().ListSessions(gomock.Any(), "user-id").Return([]*repository.Session{
+			{ID: testOtherSessionID, UserID: "user-id", DeviceLabel: "Chrome on Android", IPAddress: "10.0.0.2", LastSeenAt: lastSeenAt},
+			{ID: testSessionID, UserID: "user-id", DeviceLabel: "Firefox on Windows", IPAddress: "10.0.0.1"},
+		}, nil).Times(1)
+
+		err := srv.ListSessions(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		resp := generated.ListSessionsResponse{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Len(t, resp.Sessions, 2)
+		assert.Equal(t, "Chrome on Android", resp.Sessions[0].DeviceLabel)
+		assert.Equal(t, lastSeenAt, resp.Sessions[0].LastSeenAt)
+		assert.False(t, resp.Sessions[0].Current)
+		assert.True(t, resp.Sessions[1].Current)
+	})
+
+	t.Run("no sessions", func(t *testing.T) {
+		c, rec := newContext()
+
+		mockRepository.EXPECT().ListSessions(gomock.Any(), "user-id").Return([]*repository.Session{}, nil).Times(1)
+
+		err := srv.ListSessions(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"sessions": []}`, rec.Body.String())
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		c, rec := newContext()
+
+		mockRepository.EXPECT().ListSessions(gomock.Any(), "user-id").Return(nil, errors.New("error")).Times(1)
+
+		err := srv.ListSessions(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+
+	t.Run("no claims", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/sessions", nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+
+		err := srv.ListSessions(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
+
+func TestRevokeSession(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository:      mockRepository,
+		TokenRevocation: repository.NewMemoryTokenRevocation(),
+	}
+
+	newContext := func() (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodDelete, "/sessions/"+testOtherSessionID, nil)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		c := e.NewContext(req, rec)
+		return withClaims(c, &Claims{UserID: "user-id", SessionID: testSessionID}), rec
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		c, rec := newContext()
+
+		mockRepository.EXPECT().GetSession(gomock.Any(), testOtherSessionID).
+			Return(&repository.Session{ID: testOtherSessionID, UserID: "user-id"}, nil).Times(1)
+		mockRepository.EXPECT().RevokeRefreshTokenFamily(gomock.Any(), testOtherSessionID).Return(nil).Times(1)
+
+		err := srv.RevokeSession(c, testOtherSessionID)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		// access tokens of the session stop working as well
+		revoked, _ := srv.TokenRevocation.IsTokenRevoked(context.Background(), testOtherSessionID)
+		assert.True(t, revoked)
+	})
+
+	t.Run("session of another user", func(t *testing.T) {
+		c, rec := newContext()
+
+		mockRepository.EXPECT().GetSession(gomock.Any(), testOtherSessionID).
+			Return(&repository.Session{ID: testOtherSessionID, UserID: "other-user-id"}, nil).Times(1)
+
+		err := srv.RevokeSession(c, testOtherSessionID)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("unknown session", func(t *testing.T) {
+		c, rec := newContext()
+
+		mockRepository.EXPECT().GetSession(gomock.Any(), testOtherSessionID).Return(nil, sql.ErrNoRows).Times(1)
+
+		err := srv.RevokeSession(c, testOtherSessionID)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("malformed id", func(t *testing.T) {
+		c, rec := newContext()
+
+		err := srv.RevokeSession(c, "not-a-uuid")
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("revoke error", func(t *testing.T) {
+		c, rec := newContext()
+
+		mockRepository.EXPECT().GetSession(gomock.Any(), testOtherSessionID).
+			Return(&repository.Session{ID: testOtherSessionID, UserID: "user-id"}, nil).Times(1)
+		mockRepository.EXPECT().RevokeRefreshTokenFamily(gomock.Any(), testOtherSessionID).Return(errors.New("error")).Times(1)
+
+		err := srv.RevokeSession(c, testOtherSessionID)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
+
+func TestSignOutOtherSessions(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository:      mockRepository,
+		TokenRevocation: repository.NewMemoryTokenRevocation(),
+	}
+
+	newContext := func() (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodDelete, "/sessions", nil)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		c := e.NewContext(req, rec)
+		return withClaims(c, &Claims{UserID: "user-id", SessionID: testSessionID}), rec
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		c, rec := newContext()
+
+		mockRepository.EXPECT().RevokeOtherRefreshTokenFamilies(gomock.Any(), "user-id", testSessionID).
+			Return([]string{testOtherSessionID}, nil).Times(1)
+
+		err := srv.SignOutOtherSessions(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		revoked, _ := srv.TokenRevocation.IsTokenRevoked(context.Background(), testOtherSessionID)
+		assert.True(t, revoked)
+		revoked, _ = srv.TokenRevocation.IsTokenRevoked(context.Background(), testSessionID)
+		assert.False(t, revoked)
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		c, rec := newContext()
+
+		mockRepository.EXPECT().RevokeOtherRefreshTokenFamilies(gomock.Any(), "user-id", testSessionID).
+			Return(nil, errors.New("error")).Times(1)
+
+		err := srv.SignOutOtherSessions(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
+
+func TestStartSession(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository: mockRepository,
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/login", nil)
+	req.Header.Set("User-Agent", "okhttp/4.9.2")
+	req.RemoteAddr = "10.0.0.1:1234"
+	e := echo.New()
+	e.IPExtractor = echo.ExtractIPDirect()
+	c := e.NewContext(req, httptest.NewRecorder())
+
+	var stored *repository.Session
+	mockRepository.EXPECT().StoreSession(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, data *repository.Session) error {
+			stored = data
+			return nil
+		}).Times(1)
+
+	authTime := time.Now().Add(-time.Hour)
+	sessionID, err := srv.startSession(c, "user-id", "okhttp", authTime)
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, stored.ID, sessionID)
+	assert.Equal(t, "user-id", stored.UserID)
+	assert.Equal(t, "okhttp", stored.DeviceLabel)
+	assert.Equal(t, "okhttp/4.9.2", stored.UserAgent)
+	assert.Equal(t, "10.0.0.1", stored.IPAddress)
+	assert.Equal(t, authTime, stored.AuthTime)
+}
+
+func TestDeviceLabel(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      string
+	}{
+		{
+			userAgent: "Mozilla/5.0 (Linux; Android 13; SM-A536E) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36",
+			want:      "Chrome on Android",
+		},
+		{
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1",
+			want:      "Safari on iPhone",
+		},
+		{
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91",
+			want:      "Edge on Windows",
+		},
+		{
+			userAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 14.2; rv:121.0) Gecko/20100101 Firefox/121.0",
+			want:      "Firefox on macOS",
+		},
+		{userAgent: "okhttp/4.9.2", want: "okhttp"},
+		{userAgent: "", want: "Unknown device"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, deviceLabel(tt.userAgent), "user agent: %s", tt.userAgent)
+	}
+}
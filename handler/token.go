@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	AccessTokenDuration  = 5 * time.Minute
+	RefreshTokenDuration = 30 * 24 * time.Hour
+
+	refreshTokenBytes = 32
+)
+
+// MaxTokenLifetime is the longest any token signed by the service stays
+// valid. Retired signing keys keep verifying tokens for as long, and
+// revoking a session outlasts every token bound to it.
+func MaxTokenLifetime() time.Duration {
+	lifetime := AccessTokenDuration
+	for _, duration := range []time.Duration{IDTokenDuration, AuthorizeSessionDuration, MFAChallengeDuration, PasskeyTimeout} {
+		if duration > lifetime {
+			lifetime = duration
+		}
+	}
+
+	return lifetime
+}
+
+// RefreshToken exchanges a refresh token for a new access token and rotates
+// the refresh token. Presenting an already rotated token revokes its family.
+func (s *Server) RefreshToken(ctx echo.Context) error {
+	var (
+		successResp generated.RefreshTokenResponse
+	)
+
+	request := &generated.RefreshTokenRequest{}
+	err := json.NewDecoder(ctx.Request().Body).Decode(&request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	if request.RefreshToken == "" {
+		return sendErrorResponse(ctx, http.StatusBadRequest, errors.New("refresh_token: can't be empty"))
+	}
+
+	reqCtx := ctx.Request().Context()
+	current, err := s.Repository.GetRefreshToken(reqCtx, hashRefreshToken(request.RefreshToken))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sendErrorResponse(ctx, http.StatusUnauthorized, errors.New("Refresh token is not valid"))
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if current.RevokedAt != nil || time.Now().After(current.ExpiresAt) {
+		return sendErrorResponse(ctx, http.StatusUnauthorized, errors.New("Refresh token is not valid"))
+	}
+
+	// a rotated token presented again means it leaked, so kill the whole family
+	if current.RotatedAt != nil {
+		return s.rejectRefreshTokenReuse(ctx, current.FamilyID)
+	}
+
+	user, err := s.getActiveUserByID(reqCtx, current.UserID)
+	if err != nil {
+		return sendUserLookupError(ctx, err)
+	}
+
+	refreshToken, next, err := newRefreshToken(current.UserID, current.FamilyID, current.Scope)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	err = s.Repository.RotateRefreshToken(reqCtx, current.ID, next)
+	if err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenRotated) {
+			return s.rejectRefreshTokenReuse(ctx, current.FamilyID)
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	token, err := s.createJWTToken(user, current.FamilyID, current.Scope)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	// the session list only needs an approximate last seen time
+	err = s.Repository.TouchSession(reqCtx, current.FamilyID)
+	if err != nil {
+		ctx.Logger().Warnf("touch session %s: %v", current.FamilyID, err)
+	}
+
+	successResp.UserId = user.ID
+	successResp.Token = token
+	successResp.RefreshToken = refreshToken
+	return ctx.JSON(http.StatusOK, successResp)
+}
+
+func (s *Server) rejectRefreshTokenReuse(ctx echo.Context, familyID string) error {
+	err := s.Repository.RevokeRefreshTokenFamily(ctx.Request().Context(), familyID)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	return sendErrorResponse(ctx, http.StatusUnauthorized, errors.New("Refresh token reuse detected"))
+}
+
+// issueRefreshToken stores a new refresh token in the given family and returns
+// its plain value, which is never persisted.
+func (s *Server) issueRefreshToken(ctx context.Context, userID, familyID, scope string) (string, error) {
+	refreshToken, data, err := newRefreshToken(userID, familyID, scope)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.Repository.StoreRefreshToken(ctx, data)
+	if err != nil {
+		return "", err
+	}
+
+	return refreshToken, nil
+}
+
+func newRefreshToken(userID, familyID, scope string) (string, *repository.RefreshToken, error) {
+	refreshToken, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return refreshToken, &repository.RefreshToken{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashRefreshToken(refreshToken),
+		Scope:     scope,
+		ExpiresAt: time.Now().Add(RefreshTokenDuration),
+	}, nil
+}
+
+// randomToken returns an opaque, URL safe random token.
+func randomToken() (string, error) {
+	buf := make([]byte, refreshTokenBytes)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashRefreshToken(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
+}
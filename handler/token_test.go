@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshToken(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository: mockRepository,
+		KeyRing:    newTestKeyRing(t),
+	}
+
+	newContext := func(payload string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/token/refresh", bytes.NewBufferString(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return e.NewContext(req, rec), rec
+	}
+
+	payload := `{"refresh_token": "mock-refresh-token"}`
+	mockToken := func() *repository.RefreshToken {
+		return &repository.RefreshToken{
+			ID:        "token-id",
+			UserID:    "user-id",
+			FamilyID:  "family-id",
+			TokenHash: hashRefreshToken("mock-refresh-token"),
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		c, rec := newContext(payload)
+
+		mockRepository.EXPECT().GetRefreshToken(gomock.Any(), hashRefreshToken("mock-refresh-token")).Return(mockToken(), nil).Times(1)
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(&repository.User{ID: "user-id"}, nil).Times(1)
+		mockRepository.EXPECT().RotateRefreshToken(gomock.Any(), "token-id", gomock.Any()).
+			DoAndReturn(func(_ interface{}, _ string, next *repository.RefreshToken) error {
+				assert.Equal(t, "family-id", next.FamilyID)
+				return nil
+			}).Times(1)
+		mockRepository.EXPECT().TouchSession(gomock.Any(), "family-id").Return(nil).Times(1)
+
+		err := srv.RefreshToken(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("empty refresh token", func(t *testing.T) {
+		c, rec := newContext(`{"refresh_token": ""}`)
+
+		err := srv.RefreshToken(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("unknown refresh token", func(t *testing.T) {
+		c, rec := newContext(payload)
+
+		mockRepository.EXPECT().GetRefreshToken(gomock.Any(), gomock.Any()).Return(nil, sql.ErrNoRows).Times(1)
+
+		err := srv.RefreshToken(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("expired refresh token", func(t *testing.T) {
+		c, rec := newContext(payload)
+
+		token := mockToken()
+		token.ExpiresAt = time.Now().Add(-time.Minute)
+		mockRepository.EXPECT().GetRefreshToken(gomock.Any(), gomock.Any()).Return(token, nil).Times(1)
+
+		err := srv.RefreshToken(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("reused refresh token revokes family", func(t *testing.T) {
+		c, rec := newContext(payload)
+
+		token := mockToken()
+		rotatedAt := time.Now().Add(-time.Minute)
+		token.RotatedAt = &rotatedAt
+		mockRepository.EXPECT().GetRefreshToken(gomock.Any(), gomock.Any()).Return(token, nil).Times(1)
+		mockRepository.EXPECT().RevokeRefreshTokenFamily(gomock.Any(), "family-id").Return(nil).Times(1)
+
+		err := srv.RefreshToken(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("concurrent rotation revokes family", func(t *testing.T) {
+		c, rec := newContext(payload)
+
+		mockRepository.EXPECT().GetRefreshToken(gomock.Any(), gomock.Any()).Return(mockToken(), nil).Times(1)
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), gomock.Any()).Return(&repository.User{}, nil).Times(1)
+		mockRepository.EXPECT().RotateRefreshToken(gomock.Any(), gomock.Any(), gomock.Any()).Return(repository.ErrRefreshTokenRotated).Times(1)
+		mockRepository.EXPECT().RevokeRefreshTokenFamily(gomock.Any(), "family-id").Return(nil).Times(1)
+
+		err := srv.RefreshToken(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("get refresh token error", func(t *testing.T) {
+		c, rec := newContext(payload)
+
+		mockRepository.EXPECT().GetRefreshToken(gomock.Any(), gomock.Any()).Return(nil, errors.New("error")).Times(1)
+
+		err := srv.RefreshToken(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
+
+func TestMaxTokenLifetime(t *testing.T) {
+	// the session cookie of /authorize outlives every other token
+	assert.Equal(t, AuthorizeSessionDuration, MaxTokenLifetime())
+}
@@ -0,0 +1,382 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/helper"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/totp"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// TOTPIssuer names the service in authenticator apps.
+	TOTPIssuer = "UserService"
+	// TOTPSkew is the number of periods a code is accepted before and after
+	// its own, to tolerate clock drift of the user's device.
+	TOTPSkew = 1
+
+	MFAChallengeDuration = 5 * time.Minute
+	mfaChallengeAudience = "mfa"
+
+	mfaMethodTOTP = "totp"
+	mfaMethodSMS  = "sms"
+)
+
+var (
+	errTOTPNotConfigured   = errors.New("two-factor authentication is not configured")
+	errTOTPNotPending      = errors.New("No authenticator app is waiting for confirmation")
+	errTOTPCodeInvalid     = errors.New("Code is not valid")
+	errMFAChallengeInvalid = errors.New("MFA token is not valid")
+)
+
+// mfaChallengeClaims carry the second factor a login is waiting for, the
+// authenticator app or, for a step-up, a texted code.
+type mfaChallengeClaims struct {
+	MFAMethod string `json:"mfa_method"`
+	jwt.RegisteredClaims
+}
+
+// EnrollTOTP generates a new authenticator app secret for the current user.
+// It is not asked for on login until ConfirmTOTP proves the app was set up.
+func (s *Server) EnrollTOTP(ctx echo.Context) error {
+	var (
+		successResp generated.EnrollTOTPResponse
+	)
+
+	claims, ok := ClaimsFromContext(ctx.Request().Context())
+	if !ok {
+		return sendErrorResponse(ctx, http.StatusForbidden, errors.New("User is not authorized"))
+	}
+
+	if s.SecretCipher == nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, errTOTPNotConfigured)
+	}
+
+	user, err := s.getActiveUserByID(ctx.Request().Context(), claims.UserID)
+	if err != nil {
+		return sendUserLookupError(ctx, err)
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	secretEncrypted, err := s.SecretCipher.Encrypt(secret)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	err = s.Repository.StoreTOTPCredential(ctx.Request().Context(), &repository.TOTPCredential{
+		UserID:          user.ID,
+		SecretEncrypted: secretEncrypted,
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrTOTPAlreadyConfirmed) {
+			return sendErrorResponse(ctx, http.StatusConflict, err)
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	successResp.Secret = totp.Encoding.EncodeToString(secret)
+	successResp.OtpauthUri = totp.URI(TOTPIssuer, user.PhoneNumber, secret)
+	return ctx.JSON(http.StatusOK, successResp)
+}
+
+// ConfirmTOTP enables two-factor authentication for the current user with
+// the first code of the enrolled authenticator app.
+func (s *Server) ConfirmTOTP(ctx echo.Context) error {
+	var (
+		successResp generated.ConfirmTOTPResponse
+	)
+
+	claims, ok := ClaimsFromContext(ctx.Request().Context())
+	if !ok {
+		return sendErrorResponse(ctx, http.StatusForbidden, errors.New("User is not authorized"))
+	}
+
+	request := &generated.ConfirmTOTPRequest{}
+	err := json.NewDecoder(ctx.Request().Body).Decode(&request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	err = validateTOTPCode(request.Code)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	credential, err := s.Repository.GetTOTPCredential(ctx.Request().Context(), claims.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sendErrorResponse(ctx, http.StatusConflict, errTOTPNotPending)
+		}
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if credential.ConfirmedAt != nil {
+		return sendErrorResponse(ctx, http.StatusConflict, errTOTPNotPending)
+	}
+
+	step, ok, err := s.checkTOTPCode(credential, request.Code)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if !ok {
+		return sendErrorResponse(ctx, http.StatusBadRequest, errTOTPCodeInvalid)
+	}
+
+	confirmed, err := s.Repository.ConfirmTOTPCredential(ctx.Request().Context(), claims.UserID, step)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if !confirmed {
+		return sendErrorResponse(ctx, http.StatusConflict, errTOTPNotPending)
+	}
+
+	// the first recovery codes come with the second factor they replace
+	successResp.RecoveryCodes, err = s.generateRecoveryCodes(ctx, claims.UserID)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	successResp.Result = "confirm totp success"
+	return ctx.JSON(http.StatusOK, successResp)
+}
+
+// LoginMFA completes a login that Login answered with an MFA challenge,
+// given a code of the user's authenticator app, or the texted code of a
+// step-up. Wrong codes count as failed logins of the lockout policy.
+func (s *Server) LoginMFA(ctx echo.Context) error {
+	request := &generated.LoginMFARequest{}
+	err := json.NewDecoder(ctx.Request().Body).Decode(&request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	err = validateLoginMFA(request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusBadRequest, err)
+	}
+
+	challenge, err := s.verifyMFAChallenge(ctx.Request().Context(), request.MfaToken)
+	if err != nil {
+		if errors.Is(err, errTokenRevocationUnavailable) {
+			return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+		}
+		return sendErrorResponse(ctx, http.StatusForbidden, errMFAChallengeInvalid)
+	}
+
+	user, err := s.getActiveUserByID(ctx.Request().Context(), challenge.Subject)
+	if err != nil {
+		return sendUserLookupError(ctx, err)
+	}
+
+	allowed, retryAfter, err := s.checkRateLimit(ctx, "login_mfa", user.PhoneNumber)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if !allowed {
+		return sendRateLimitResponse(ctx, retryAfter)
+	}
+
+	method := loginMethodTOTP
+	switch {
+	case request.RecoveryCode != nil:
+		method = loginMethodRecoveryCode
+	case challenge.MFAMethod == mfaMethodSMS:
+		method = loginMethodOTP
+	}
+
+	lockoutCode, lockoutRetryAfter, err := s.checkLockout(ctx.Request().Context(), user.ID)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if lockoutCode != 0 {
+		return s.rejectLockedOutLogin(ctx, user.ID, method, lockoutCode, lockoutRetryAfter)
+	}
+
+	ok, err := s.verifySecondFactor(ctx, user.ID, challenge.MFAMethod, request)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	if !ok {
+		err = s.recordLoginFailure(ctx, user.ID, method, loginFailureInvalidCode)
+		if err != nil {
+			return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+		}
+		return sendErrorResponse(ctx, http.StatusForbidden, errTOTPCodeInvalid)
+	}
+
+	// the challenge is single use
+	err = s.TokenRevocation.RevokeToken(ctx.Request().Context(), challenge.ID, challenge.ExpiresAt.Time)
+	if err != nil {
+		return sendErrorResponse(ctx, http.StatusInternalServerError, err)
+	}
+
+	return s.completeLogin(ctx, user, method)
+}
+
+// verifySecondFactor checks the code of the user's authenticator app, or for
+// a step-up the code texted to the user. A recovery code is accepted in place
+// of either, for users who lost their phone.
+func (s *Server) verifySecondFactor(ctx echo.Context, userID, mfaMethod string, request *generated.LoginMFARequest) (bool, error) {
+	if request.RecoveryCode != nil {
+		return s.useRecoveryCode(ctx, userID, *request.RecoveryCode, "login")
+	}
+
+	if mfaMethod == mfaMethodSMS {
+		if request.Code == nil {
+			return false, nil
+		}
+
+		err := s.verifyOneTimeCode(ctx.Request().Context(), userID, oneTimeCodeStepUp, *request.Code)
+		if errors.Is(err, repository.ErrOneTimeCodeInvalid) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	credential, err := s.Repository.GetTOTPCredential(ctx.Request().Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if credential.ConfirmedAt == nil {
+		return false, nil
+	}
+
+	step, ok, err := s.checkTOTPCode(credential, *request.Code)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	// a code that was accepted before is as wrong as a mistyped one
+	return s.Repository.UseTOTPStep(ctx.Request().Context(), userID, step)
+}
+
+// hasConfirmedTOTP reports whether logins of the user need a second factor.
+func (s *Server) hasConfirmedTOTP(ctx context.Context, userID string) (bool, error) {
+	credential, err := s.Repository.GetTOTPCredential(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return credential.ConfirmedAt != nil, nil
+}
+
+// checkTOTPCode checks code against the secret of credential and returns
+// the step it belongs to.
+func (s *Server) checkTOTPCode(credential *repository.TOTPCredential, code string) (int64, bool, error) {
+	if s.SecretCipher == nil {
+		return 0, false, errTOTPNotConfigured
+	}
+
+	secret, err := s.SecretCipher.Decrypt(credential.SecretEncrypted)
+	if err != nil {
+		return 0, false, err
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now(), TOTPSkew)
+	return step, ok, nil
+}
+
+// createMFAChallenge signs the token proving the user passed the password
+// step, waiting for mfaMethod. Its audience keeps it from being accepted as
+// an access token.
+func (s *Server) createMFAChallenge(user *repository.User, mfaMethod string) (string, error) {
+	now := time.Now()
+
+	return s.signToken(&mfaChallengeClaims{
+		MFAMethod: mfaMethod,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Issuer:    s.Issuer,
+			Subject:   user.ID,
+			Audience:  jwt.ClaimStrings{mfaChallengeAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(MFAChallengeDuration)),
+		},
+	})
+}
+
+// verifyMFAChallenge checks a challenge created by createMFAChallenge.
+func (s *Server) verifyMFAChallenge(ctx context.Context, tknStr string) (*mfaChallengeClaims, error) {
+	claims := &mfaChallengeClaims{}
+
+	err := s.verifySingleUseToken(ctx, tknStr, mfaChallengeAudience, claims, &claims.RegisteredClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Subject == "" {
+		return nil, errSingleUseTokenInvalid
+	}
+
+	// challenges signed before step-ups existed wait for the app
+	if claims.MFAMethod == "" {
+		claims.MFAMethod = mfaMethodTOTP
+	}
+
+	return claims, nil
+}
+
+func validateLoginMFA(request *generated.LoginMFARequest) error {
+	errStrs := []string{}
+
+	if request.MfaToken == "" {
+		errStrs = append(errStrs, "mfa_token: can't be empty")
+	}
+
+	if err := validateCodeOrRecoveryCode(request.Code, request.RecoveryCode); err != nil {
+		errStrs = append(errStrs, err.Error())
+	}
+
+	return helper.ErrStringsToErr(errStrs)
+}
+
+func validateTOTPCode(code string) error {
+	if code == "" {
+		return errors.New("code: can't be empty")
+	}
+
+	return nil
+}
+
+// validateCodeOrRecoveryCode requires exactly one of the two, a recovery code
+// is used in place of the usual code.
+func validateCodeOrRecoveryCode(code, recoveryCode *string) error {
+	switch {
+	case code != nil && recoveryCode != nil:
+		return errors.New("code: can't be used along with recovery_code")
+	case recoveryCode != nil:
+		if *recoveryCode == "" {
+			return errors.New("recovery_code: can't be empty")
+		}
+		return nil
+	case code != nil:
+		return validateTOTPCode(*code)
+	default:
+		return errors.New("code: can't be empty")
+	}
+}
@@ -0,0 +1,336 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/encryption"
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/totp"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSecretCipher(t *testing.T) *encryption.Cipher {
+	cipher, err := encryption.NewCipher(bytes.Repeat([]byte{1}, 32))
+	assert.Nil(t, err, "error should be nil")
+
+	return cipher
+}
+
+func TestEnrollTOTP(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository:   mockRepository,
+		SecretCipher: newTestSecretCipher(t),
+	}
+	mockUser := &repository.User{ID: "user-id", PhoneNumber: "+622342342322"}
+
+	newContext := func() (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/profile/mfa/totp", nil)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return withClaims(e.NewContext(req, rec), &Claims{UserID: "user-id"}), rec
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		c, rec := newContext()
+
+		var stored *repository.TOTPCredential
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().StoreTOTPCredential(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, data *repository.TOTPCredential) error {
+				stored = data
+				return nil
+			}).Times(1)
+
+		err := srv.EnrollTOTP(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		resp := generated.EnrollTOTPResponse{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		uri, err := url.Parse(resp.OtpauthUri)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, "otpauth", uri.Scheme)
+		assert.Equal(t, resp.Secret, uri.Query().Get("secret"))
+
+		// the secret is only stored encrypted
+		assert.Equal(t, "user-id", stored.UserID)
+		assert.NotContains(t, stored.SecretEncrypted, resp.Secret)
+		secret, err := srv.SecretCipher.Decrypt(stored.SecretEncrypted)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, resp.Secret, totp.Encoding.EncodeToString(secret))
+	})
+
+	t.Run("already confirmed", func(t *testing.T) {
+		c, rec := newContext()
+
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().StoreTOTPCredential(gomock.Any(), gomock.Any()).
+			Return(repository.ErrTOTPAlreadyConfirmed).Times(1)
+
+		err := srv.EnrollTOTP(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		c, rec := newContext()
+
+		srv := Server{Repository: mockRepository}
+		err := srv.EnrollTOTP(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
+
+func TestConfirmTOTP(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository:   mockRepository,
+		SecretCipher: newTestSecretCipher(t),
+	}
+
+	secret, _ := totp.GenerateSecret()
+	secretEncrypted, _ := srv.SecretCipher.Encrypt(secret)
+	pending := &repository.TOTPCredential{UserID: "user-id", SecretEncrypted: secretEncrypted}
+
+	newContext := func(payload string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/profile/mfa/totp/confirm", bytes.NewBufferString(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return withClaims(e.NewContext(req, rec), &Claims{UserID: "user-id"}), rec
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		now := time.Now()
+		c, rec := newContext(fmt.Sprintf(`{"code": "%s"}`, totp.Code(secret, totp.Step(now))))
+
+		mockRepository.EXPECT().GetTOTPCredential(gomock.Any(), "user-id").Return(pending, nil).Times(1)
+		mockRepository.EXPECT().ConfirmTOTPCredential(gomock.Any(), "user-id", gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ string, step int64) (bool, error) {
+				assert.InDelta(t, totp.Step(now), step, 1)
+				return true, nil
+			}).Times(1)
+		mockRepository.EXPECT().ReplaceRecoveryCodes(gomock.Any(), "user-id", gomock.Len(RecoveryCodeCount)).Return(nil).Times(1)
+		mockRepository.EXPECT().StoreAuditEvent(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		err := srv.ConfirmTOTP(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		resp := generated.ConfirmTOTPResponse{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Len(t, resp.RecoveryCodes, RecoveryCodeCount)
+	})
+
+	t.Run("wrong code", func(t *testing.T) {
+		code := totp.Code(secret, totp.Step(time.Now().Add(-time.Hour)))
+		c, rec := newContext(fmt.Sprintf(`{"code": "%s"}`, code))
+
+		mockRepository.EXPECT().GetTOTPCredential(gomock.Any(), "user-id").Return(pending, nil).Times(1)
+
+		err := srv.ConfirmTOTP(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("nothing to confirm", func(t *testing.T) {
+		c, rec := newContext(`{"code": "123456"}`)
+
+		mockRepository.EXPECT().GetTOTPCredential(gomock.Any(), "user-id").Return(nil, sql.ErrNoRows).Times(1)
+
+		err := srv.ConfirmTOTP(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("already confirmed", func(t *testing.T) {
+		c, rec := newContext(`{"code": "123456"}`)
+
+		confirmedAt := time.Now()
+		mockRepository.EXPECT().GetTOTPCredential(gomock.Any(), "user-id").
+			Return(&repository.TOTPCredential{UserID: "user-id", ConfirmedAt: &confirmedAt}, nil).Times(1)
+
+		err := srv.ConfirmTOTP(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("empty code", func(t *testing.T) {
+		c, rec := newContext(`{"code": ""}`)
+
+		err := srv.ConfirmTOTP(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestLoginMFA(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepository := repository.NewMockRepositoryInterface(mockCtrl)
+	srv := Server{
+		Repository:      mockRepository,
+		TokenRevocation: repository.NewMemoryTokenRevocation(),
+		KeyRing:         newTestKeyRing(t),
+		PasswordHasher:  newTestPasswordHasher(),
+		SecretCipher:    newTestSecretCipher(t),
+		LockoutPolicy:   DefaultLockoutPolicy,
+	}
+
+	hashedPassword, _ := srv.PasswordHasher.Hash([]byte("AAAAAAAAA1a^1"))
+	mockUser := &repository.User{
+		ID:          "user-id",
+		PhoneNumber: "+622342342322",
+		Password:    hashedPassword,
+	}
+
+	secret, _ := totp.GenerateSecret()
+	secretEncrypted, _ := srv.SecretCipher.Encrypt(secret)
+	confirmedAt := time.Now()
+	credential := &repository.TOTPCredential{UserID: "user-id", SecretEncrypted: secretEncrypted, ConfirmedAt: &confirmedAt}
+
+	// login returns a challenge instead of tokens
+	login := func(t *testing.T) string {
+		req := httptest.NewRequest(http.MethodPost, "/login",
+			bytes.NewBufferString(`{"phone_number": "+622342342322", "password": "AAAAAAAAA1a^1"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUser(gomock.Any(), "+622342342322").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().GetLoginAttempts(gomock.Any(), "user-id").Return(&repository.LoginAttempts{}, nil).Times(1)
+		mockRepository.EXPECT().GetTOTPCredential(gomock.Any(), "user-id").Return(credential, nil).Times(1)
+
+		err := srv.Login(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+
+		resp := generated.MFAChallengeResponse{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Equal(t, "user-id", resp.UserId)
+		assert.NotEmpty(t, resp.MfaToken)
+		return resp.MfaToken
+	}
+
+	newContext := func(mfaToken, code string) (echo.Context, *httptest.ResponseRecorder) {
+		payload := fmt.Sprintf(`{"mfa_token": "%s", "code": "%s"}`, mfaToken, code)
+		req := httptest.NewRequest(http.MethodPost, "/login/mfa", bytes.NewBufferString(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		return e.NewContext(req, rec), rec
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		mfaToken := login(t)
+		c, rec := newContext(mfaToken, totp.Code(secret, totp.Step(time.Now())))
+
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().GetLoginAttempts(gomock.Any(), "user-id").Return(&repository.LoginAttempts{}, nil).Times(1)
+		mockRepository.EXPECT().GetTOTPCredential(gomock.Any(), "user-id").Return(credential, nil).Times(1)
+		mockRepository.EXPECT().UseTOTPStep(gomock.Any(), "user-id", gomock.Any()).Return(true, nil).Times(1)
+		mockRepository.EXPECT().StoreSession(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().StoreRefreshToken(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().RecordLoginSuccess(gomock.Any(), isLoginEvent("user-id", loginMethodTOTP, "")).Return(nil).Times(1)
+
+		err := srv.LoginMFA(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		resp := generated.LoginResponse{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Equal(t, "user-id", resp.UserId)
+		assert.NotEmpty(t, resp.RefreshToken)
+
+		t.Run("challenge is single use", func(t *testing.T) {
+			c, rec := newContext(mfaToken, totp.Code(secret, totp.Step(time.Now())))
+
+			err := srv.LoginMFA(c)
+			assert.Nil(t, err, "error should be nil")
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+		})
+	})
+
+	t.Run("challenge is not an access token", func(t *testing.T) {
+		mfaToken := login(t)
+
+		_, err := srv.verifyAccessToken(context.Background(), mfaToken)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("access token is not a challenge", func(t *testing.T) {
+		accessToken, _ := srv.createJWTToken(mockUser, "session-id", UserTokenScope)
+		c, rec := newContext(accessToken, "123456")
+
+		err := srv.LoginMFA(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("wrong code", func(t *testing.T) {
+		mfaToken := login(t)
+		c, rec := newContext(mfaToken, totp.Code(secret, totp.Step(time.Now().Add(-time.Hour))))
+
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().GetLoginAttempts(gomock.Any(), "user-id").Return(&repository.LoginAttempts{}, nil).Times(1)
+		mockRepository.EXPECT().GetTOTPCredential(gomock.Any(), "user-id").Return(credential, nil).Times(1)
+		mockRepository.EXPECT().RecordLoginFailure(gomock.Any(), isLoginEvent("user-id", loginMethodTOTP, loginFailureInvalidCode), gomock.Any()).Return(nil).Times(1)
+
+		err := srv.LoginMFA(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("replayed code", func(t *testing.T) {
+		mfaToken := login(t)
+		c, rec := newContext(mfaToken, totp.Code(secret, totp.Step(time.Now())))
+
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().GetLoginAttempts(gomock.Any(), "user-id").Return(&repository.LoginAttempts{}, nil).Times(1)
+		mockRepository.EXPECT().GetTOTPCredential(gomock.Any(), "user-id").Return(credential, nil).Times(1)
+		mockRepository.EXPECT().UseTOTPStep(gomock.Any(), "user-id", gomock.Any()).Return(false, nil).Times(1)
+		mockRepository.EXPECT().RecordLoginFailure(gomock.Any(), isLoginEvent("user-id", loginMethodTOTP, loginFailureInvalidCode), gomock.Any()).Return(nil).Times(1)
+
+		err := srv.LoginMFA(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("locked out", func(t *testing.T) {
+		mfaToken := login(t)
+		c, rec := newContext(mfaToken, totp.Code(secret, totp.Step(time.Now())))
+
+		lockedUntil := time.Now().Add(time.Hour)
+		mockRepository.EXPECT().GetUserByID(gomock.Any(), "user-id").Return(mockUser, nil).Times(1)
+		mockRepository.EXPECT().GetLoginAttempts(gomock.Any(), "user-id").
+			Return(&repository.LoginAttempts{FailureCounter: 5, LockedUntil: &lockedUntil}, nil).Times(1)
+		mockRepository.EXPECT().StoreLoginEvent(gomock.Any(), isLoginEvent("user-id", loginMethodTOTP, loginFailureLockedOut)).Return(nil).Times(1)
+
+		err := srv.LoginMFA(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusLocked, rec.Code)
+	})
+
+	t.Run("payload validation error", func(t *testing.T) {
+		c, rec := newContext("", "")
+
+		err := srv.LoginMFA(c)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
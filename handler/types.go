@@ -1,21 +1,39 @@
 package handler
 
 import (
-	"os"
-
+	"github.com/SawitProRecruitment/UserService/keyring"
 	"github.com/golang-jwt/jwt/v4"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var PrivateKey = os.Getenv("PRIVATE_KEY")
-
 type Claims struct {
 	UserID      string `json:"user_id"`
 	PhoneNumber string `json:"phone_number"`
 	FullName    string `json:"full_name"`
+	SessionID   string `json:"sid"`
+	Scope       string `json:"scope"`
+	jwt.RegisteredClaims
+}
+
+// ClientClaims are the claims of an access token issued to a client through
+// the client credentials grant. It is not tied to any user.
+type ClientClaims struct {
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope"`
 	jwt.RegisteredClaims
 }
 
+// UserTokenScope is the scope granted to tokens issued on behalf of a user.
+const UserTokenScope = "profile"
+
+// ScopeUnlockUsers lets a client lift the login lockout of users.
+const ScopeUnlockUsers = "users:unlock"
+
+// ScopeSuspendUsers lets a client suspend users and lift suspensions.
+const ScopeSuspendUsers = "users:suspend"
+
+// AllowedSigningAlgorithms is the alg allow-list enforced when verifying tokens.
+var AllowedSigningAlgorithms = keyring.SupportedAlgorithms
+
 var CompareHashAndPassword = bcrypt.CompareHashAndPassword
-var GenerateFromPassword = bcrypt.GenerateFromPassword
 var ParseWithClaims = jwt.ParseWithClaims
@@ -0,0 +1,102 @@
+package keyring
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// SupportedAlgorithms lists the JWS algorithms a key ring can sign with. It
+// doubles as the allow-list verifiers should enforce.
+var SupportedAlgorithms = []string{
+	jwt.SigningMethodRS256.Alg(),
+	jwt.SigningMethodES256.Alg(),
+	jwt.SigningMethodES384.Alg(),
+	jwt.SigningMethodEdDSA.Alg(),
+}
+
+var ErrUnsupportedKey = errors.New("unsupported key type")
+
+// Algorithm picks the JWS algorithm for a key from its type and curve.
+func Algorithm(pub crypto.PublicKey) (string, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256.Alg(), nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return jwt.SigningMethodES256.Alg(), nil
+		case elliptic.P384():
+			return jwt.SigningMethodES384.Alg(), nil
+		}
+		return "", fmt.Errorf("%w: curve %s", ErrUnsupportedKey, pub.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA.Alg(), nil
+	}
+
+	return "", fmt.Errorf("%w: %T", ErrUnsupportedKey, pub)
+}
+
+// JWK returns the public JWK members of a key, as defined by RFC 7517/8037.
+// Only the key specific members are set, kid/use/alg are up to the caller.
+func JWK(pub crypto.PublicKey) (map[string]string, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{
+			"kty": "RSA",
+			"n":   encode(pub.N.Bytes()),
+			"e":   encode(big.NewInt(int64(pub.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return map[string]string{
+			"kty": "EC",
+			"crv": pub.Curve.Params().Name,
+			"x":   encode(pub.X.FillBytes(make([]byte, size))),
+			"y":   encode(pub.Y.FillBytes(make([]byte, size))),
+		}, nil
+	case ed25519.PublicKey:
+		return map[string]string{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"x":   encode(pub),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, pub)
+}
+
+// KeyID returns the RFC 7638 JWK thumbprint of the public key.
+func KeyID(pub crypto.PublicKey) (string, error) {
+	jwk, err := JWK(pub)
+	if err != nil {
+		return "", err
+	}
+
+	// required members only, in lexicographic order without whitespace
+	var thumbprintInput string
+	switch jwk["kty"] {
+	case "RSA":
+		thumbprintInput = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, jwk["e"], jwk["n"])
+	case "EC":
+		thumbprintInput = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`, jwk["crv"], jwk["x"], jwk["y"])
+	case "OKP":
+		thumbprintInput = fmt.Sprintf(`{"crv":"%s","kty":"OKP","x":"%s"}`, jwk["crv"], jwk["x"])
+	}
+
+	sum := sha256.Sum256([]byte(thumbprintInput))
+	return encode(sum[:]), nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
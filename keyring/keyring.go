@@ -0,0 +1,192 @@
+// This file contains the key ring used to sign and verify tokens.
+// A key ring holds one active signing key plus keys that were retired
+// recently and are still needed to verify tokens signed before rotation.
+package keyring
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrNoSigningKey = errors.New("key ring has no active signing key")
+	ErrKeyNotFound  = errors.New("key is not found in key ring")
+)
+
+// Key is a single entry of the key ring.
+type Key struct {
+	ID string
+	// Algorithm is the JWS alg derived from the key type, e.g. RS256.
+	Algorithm string
+	// PrivateKey is nil for keys that only verify tokens, e.g. those of
+	// another instance.
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+	// ActivateAt is the moment the key becomes the signing key. Keys with an
+	// ActivateAt in the future are already published for verification.
+	ActivateAt time.Time
+}
+
+type KeyRing struct {
+	mu               sync.RWMutex
+	keys             []*Key
+	maxTokenLifetime time.Duration
+	now              func() time.Time
+}
+
+type NewKeyRingOptions struct {
+	// MaxTokenLifetime is how long a retired key keeps verifying tokens.
+	MaxTokenLifetime time.Duration
+	// Now is used for testing, defaults to time.Now.
+	Now func() time.Time
+}
+
+func NewKeyRing(opts NewKeyRingOptions) *KeyRing {
+	now := opts.Now
+	if now == nil {
+		now = time.Now
+	}
+
+	return &KeyRing{
+		maxTokenLifetime: opts.MaxTokenLifetime,
+		now:              now,
+	}
+}
+
+// Add puts a key into the ring. It becomes the signing key once activateAt
+// has passed and no key with a later activation is active.
+func (k *KeyRing) Add(privateKey crypto.Signer, activateAt time.Time) (*Key, error) {
+	return k.add(privateKey, privateKey.Public(), activateAt)
+}
+
+// AddPublic puts a key that only verifies tokens into the ring. It is never
+// the signing key and is published for as long as it is in the ring.
+func (k *KeyRing) AddPublic(publicKey crypto.PublicKey, activateAt time.Time) (*Key, error) {
+	return k.add(nil, publicKey, activateAt)
+}
+
+func (k *KeyRing) add(privateKey crypto.Signer, publicKey crypto.PublicKey, activateAt time.Time) (*Key, error) {
+	algorithm, err := Algorithm(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	kid, err := KeyID(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{
+		ID:         kid,
+		Algorithm:  algorithm,
+		PrivateKey: privateKey,
+		PublicKey:  publicKey,
+		ActivateAt: activateAt,
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for _, existing := range k.keys {
+		if existing.ID == key.ID {
+			// the private part of a key loaded as public key may come later
+			if existing.PrivateKey == nil && privateKey != nil {
+				existing.PrivateKey = privateKey
+			}
+			return existing, nil
+		}
+	}
+
+	k.keys = append(k.keys, key)
+	// stable so that keys with the same activation keep insertion order
+	sort.SliceStable(k.keys, func(i, j int) bool {
+		return k.keys[i].ActivateAt.Before(k.keys[j].ActivateAt)
+	})
+
+	return key, nil
+}
+
+// SigningMethod returns the jwt signing method matching the key algorithm.
+func (k *Key) SigningMethod() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// SigningKey returns the key new tokens must be signed with, keys that only
+// verify tokens are skipped.
+func (k *KeyRing) SigningKey() (*Key, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	idx := k.activeIndex(k.now())
+	if idx < 0 {
+		return nil, ErrNoSigningKey
+	}
+
+	return k.keys[idx], nil
+}
+
+// VerificationKey returns the key with the given id as long as it is active,
+// scheduled, or retired for less than the max token lifetime.
+func (k *KeyRing) VerificationKey(kid string) (*Key, error) {
+	for _, key := range k.VerificationKeys() {
+		if key.ID == kid {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: kid %q", ErrKeyNotFound, kid)
+}
+
+// VerificationKeys lists every key that may still verify a token, which is
+// what the JWKS endpoint publishes.
+func (k *KeyRing) VerificationKeys() []*Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	now := k.now()
+	active := k.activeIndex(now)
+
+	var keys []*Key
+	for i, key := range k.keys {
+		if key.PrivateKey != nil && i < active && k.retiredAt(i).Add(k.maxTokenLifetime).Before(now) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// activeIndex returns the index of the latest activated key that can sign,
+// or -1.
+func (k *KeyRing) activeIndex(now time.Time) int {
+	active := -1
+	for i, key := range k.keys {
+		if key.ActivateAt.After(now) {
+			break
+		}
+		if key.PrivateKey != nil {
+			active = i
+		}
+	}
+
+	return active
+}
+
+// retiredAt is the moment the signing key at index i was replaced by the
+// next key that can sign.
+func (k *KeyRing) retiredAt(i int) time.Time {
+	for _, key := range k.keys[i+1:] {
+		if key.PrivateKey != nil {
+			return key.ActivateAt
+		}
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,224 @@
+package keyring
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func generateKey(t *testing.T) crypto.Signer {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privateKey
+}
+
+func TestKeyRing(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ring := NewKeyRing(NewKeyRingOptions{
+		MaxTokenLifetime: 5 * time.Minute,
+		Now:              func() time.Time { return now },
+	})
+
+	t.Run("empty ring", func(t *testing.T) {
+		_, err := ring.SigningKey()
+		assert.ErrorIs(t, err, ErrNoSigningKey)
+	})
+
+	oldKey, _ := ring.Add(generateKey(t), now.Add(-time.Hour))
+	newKey, _ := ring.Add(generateKey(t), now.Add(time.Hour))
+
+	t.Run("scheduled key is published but not used for signing", func(t *testing.T) {
+		key, err := ring.SigningKey()
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, oldKey.ID, key.ID)
+		assert.Len(t, ring.VerificationKeys(), 2)
+	})
+
+	t.Run("scheduled key is promoted", func(t *testing.T) {
+		now = now.Add(time.Hour)
+
+		key, err := ring.SigningKey()
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, newKey.ID, key.ID)
+
+		_, err = ring.VerificationKey(oldKey.ID)
+		assert.Nil(t, err, "retired key should still verify")
+	})
+
+	t.Run("retired key is dropped after max token lifetime", func(t *testing.T) {
+		now = now.Add(6 * time.Minute)
+
+		_, err := ring.VerificationKey(oldKey.ID)
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+		assert.Len(t, ring.VerificationKeys(), 1)
+	})
+
+	t.Run("adding the same key twice is a no-op", func(t *testing.T) {
+		_, err := ring.Add(newKey.PrivateKey, now)
+		assert.Nil(t, err, "error should be nil")
+		assert.Len(t, ring.VerificationKeys(), 1)
+	})
+}
+
+func TestPublicKey(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ring := NewKeyRing(NewKeyRingOptions{
+		MaxTokenLifetime: 5 * time.Minute,
+		Now:              func() time.Time { return now },
+	})
+
+	signingKey, _ := ring.Add(generateKey(t), now.Add(-time.Hour))
+	publicKey, err := ring.AddPublic(generateKey(t).Public(), now.Add(-time.Minute))
+	assert.Nil(t, err, "error should be nil")
+	assert.Nil(t, publicKey.PrivateKey)
+
+	t.Run("public key is never the signing key", func(t *testing.T) {
+		key, err := ring.SigningKey()
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, signingKey.ID, key.ID)
+	})
+
+	t.Run("public key does not retire the signing key", func(t *testing.T) {
+		now = now.Add(time.Hour)
+
+		_, err := ring.VerificationKey(signingKey.ID)
+		assert.Nil(t, err, "error should be nil")
+		_, err = ring.VerificationKey(publicKey.ID)
+		assert.Nil(t, err, "error should be nil")
+	})
+
+	t.Run("ring of public keys has no signing key", func(t *testing.T) {
+		publicRing := NewKeyRing(NewKeyRingOptions{})
+		_, _ = publicRing.AddPublic(generateKey(t).Public(), time.Time{})
+
+		_, err := publicRing.SigningKey()
+		assert.ErrorIs(t, err, ErrNoSigningKey)
+		assert.Len(t, publicRing.VerificationKeys(), 1)
+	})
+
+	t.Run("private part added later", func(t *testing.T) {
+		privateKey := generateKey(t)
+		publicRing := NewKeyRing(NewKeyRingOptions{})
+		_, _ = publicRing.AddPublic(privateKey.Public(), time.Time{})
+		_, _ = publicRing.Add(privateKey, time.Time{})
+
+		key, err := publicRing.SigningKey()
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, privateKey, key.PrivateKey)
+	})
+}
+
+func TestLoadPEM(t *testing.T) {
+	rsaKey := generateKey(t).(*rsa.PrivateKey)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	publicDER, _ := x509.MarshalPKIXPublicKey(generateKey(t).Public())
+	ecDER, _ := x509.MarshalECPrivateKey(ecKey)
+
+	tests := []struct {
+		name    string
+		block   *pem.Block
+		canSign bool
+		wantErr bool
+	}{
+		{name: "pkcs1", block: &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}, canSign: true},
+		{name: "sec1", block: &pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}, canSign: true},
+		{name: "public key", block: &pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}},
+		{name: "malformed public key", block: &pem.Block{Type: "PUBLIC KEY", Bytes: []byte("invalid")}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ring := NewKeyRing(NewKeyRingOptions{})
+			err := ring.LoadPEM(pem.EncodeToMemory(tt.block))
+			if tt.wantErr {
+				assert.NotNil(t, err, "error should not be nil")
+				return
+			}
+
+			assert.Nil(t, err, "error should be nil")
+			assert.Len(t, ring.VerificationKeys(), 1)
+
+			_, err = ring.SigningKey()
+			assert.Equal(t, tt.canSign, err == nil)
+		})
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+
+	writeKey := func(name string, headers map[string]string) crypto.Signer {
+		privateKey := generateKey(t)
+		der, _ := x509.MarshalPKCS8PrivateKey(privateKey)
+		data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Headers: headers, Bytes: der})
+		_ = os.WriteFile(filepath.Join(dir, name), data, 0600)
+		return privateKey
+	}
+
+	current := writeKey("1.pem", nil)
+	currentID, _ := KeyID(current.Public())
+	next := writeKey("2.pem", map[string]string{ActivateAtHeader: "2999-01-01T00:00:00Z"})
+
+	ring := NewKeyRing(NewKeyRingOptions{MaxTokenLifetime: time.Minute})
+	err := ring.LoadDir(dir)
+	assert.Nil(t, err, "error should be nil")
+
+	key, err := ring.SigningKey()
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, currentID, key.ID)
+
+	nextID, _ := KeyID(next.Public())
+	_, err = ring.VerificationKey(nextID)
+	assert.Nil(t, err, "scheduled key should be published")
+
+	t.Run("invalid activation header", func(t *testing.T) {
+		writeKey("3.pem", map[string]string{ActivateAtHeader: "tomorrow"})
+		err := NewKeyRing(NewKeyRingOptions{}).LoadDir(dir)
+		assert.NotNil(t, err, "error should not be nil")
+	})
+}
+
+func TestAlgorithm(t *testing.T) {
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	p521, _ := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	_, ed, _ := ed25519.GenerateKey(rand.Reader)
+
+	ring := NewKeyRing(NewKeyRingOptions{})
+
+	t.Run("algorithm follows key type", func(t *testing.T) {
+		tests := []struct {
+			signer crypto.Signer
+			alg    string
+		}{
+			{generateKey(t), "RS256"},
+			{p256, "ES256"},
+			{p384, "ES384"},
+			{ed, "EdDSA"},
+		}
+		for _, tt := range tests {
+			key, err := ring.Add(tt.signer, time.Time{})
+			assert.Nil(t, err, "error should be nil")
+			assert.Equal(t, tt.alg, key.Algorithm)
+			assert.Equal(t, tt.alg, key.SigningMethod().Alg())
+		}
+	})
+
+	t.Run("unsupported curve", func(t *testing.T) {
+		_, err := ring.Add(p521, time.Time{})
+		assert.ErrorIs(t, err, ErrUnsupportedKey)
+	})
+}
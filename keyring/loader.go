@@ -0,0 +1,116 @@
+package keyring
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ActivateAtHeader is the optional PEM header holding the RFC 3339 time a key
+// becomes the signing key. Keys without it are active immediately.
+const ActivateAtHeader = "Activate-At"
+
+// LoadPEM adds every PEM encoded key found in data: PKCS#8, PKCS#1 and SEC 1
+// private keys, and PKIX public keys, which only verify tokens. RSA, ECDSA
+// P-256/P-384 and Ed25519 keys are supported.
+func (k *KeyRing) LoadPEM(data []byte) error {
+	var found bool
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		found = true
+
+		var activateAt time.Time
+		if value, ok := block.Headers[ActivateAtHeader]; ok {
+			var err error
+			activateAt, err = time.Parse(time.RFC3339, value)
+			if err != nil {
+				return fmt.Errorf("invalid %s header: %w", ActivateAtHeader, err)
+			}
+		}
+
+		if block.Type == "PUBLIC KEY" {
+			publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return err
+			}
+
+			_, err = k.AddPublic(publicKey, activateAt)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		privateKey, err := parsePrivateKey(block)
+		if err != nil {
+			return err
+		}
+
+		_, err = k.Add(privateKey, activateAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !found {
+		return errors.New("no PEM block found")
+	}
+
+	return nil
+}
+
+// LoadDir adds the keys of every *.pem file in dir, in file name order.
+func (k *KeyRing) LoadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		err = k.LoadPEM(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	return nil
+}
+
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	var parseResult interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parseResult, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parseResult, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		parseResult, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := parseResult.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, parseResult)
+	}
+
+	return key, nil
+}
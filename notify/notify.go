@@ -0,0 +1,69 @@
+// This file contains the notifiers telling users about activity on their
+// account.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/sms"
+)
+
+// UnfamiliarLogin describes a successful login whose device or network
+// differs from the recent logins of the user. Reasons tells which.
+type UnfamiliarLogin struct {
+	UserID      string
+	PhoneNumber string
+	DeviceLabel string
+	IPAddress   string
+	Time        time.Time
+	Reasons     []string
+}
+
+// Notifier tells users about logins they may not have made themselves.
+type Notifier interface {
+	NotifyUnfamiliarLogin(ctx context.Context, login *UnfamiliarLogin) error
+}
+
+// LogNotifier writes notifications to w instead of delivering them, one line
+// per notification. It is meant for local development and tests.
+type LogNotifier struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewLogNotifier(w io.Writer) *LogNotifier {
+	return &LogNotifier{
+		w: w,
+	}
+}
+
+func (n *LogNotifier) NotifyUnfamiliarLogin(ctx context.Context, login *UnfamiliarLogin) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	_, err := fmt.Fprintf(n.w, "%s unfamiliar_login user=%s device=%q ip=%s reasons=%s\n", time.Now().UTC().Format(time.RFC3339),
+		login.UserID, login.DeviceLabel, login.IPAddress, strings.Join(login.Reasons, ","))
+	return err
+}
+
+// SMSNotifier texts notifications to the phone number of the user.
+type SMSNotifier struct {
+	sender sms.SMSSender
+}
+
+func NewSMSNotifier(sender sms.SMSSender) *SMSNotifier {
+	return &SMSNotifier{
+		sender: sender,
+	}
+}
+
+func (n *SMSNotifier) NotifyUnfamiliarLogin(ctx context.Context, login *UnfamiliarLogin) error {
+	message := fmt.Sprintf("New login to your account from %s (%s) at %s. If this was not you, change your password now.",
+		login.DeviceLabel, login.IPAddress, login.Time.UTC().Format("2006-01-02 15:04 MST"))
+	return n.sender.Send(ctx, login.PhoneNumber, message)
+}
@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/sms"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogNotifier(t *testing.T) {
+	var buf bytes.Buffer
+	notifier := NewLogNotifier(&buf)
+
+	err := notifier.NotifyUnfamiliarLogin(context.Background(), &UnfamiliarLogin{
+		UserID:      "user-id",
+		DeviceLabel: "Chrome on Android",
+		IPAddress:   "203.0.113.7",
+		Reasons:     []string{"new_network", "new_device"},
+	})
+	assert.Nil(t, err, "error should be nil")
+	assert.Regexp(t, `^\S+ unfamiliar_login user=user-id device="Chrome on Android" ip=203.0.113.7 reasons=new_network,new_device\n$`, buf.String())
+}
+
+func TestSMSNotifier(t *testing.T) {
+	var buf bytes.Buffer
+	notifier := NewSMSNotifier(sms.NewLogSender(&buf))
+
+	err := notifier.NotifyUnfamiliarLogin(context.Background(), &UnfamiliarLogin{
+		UserID:      "user-id",
+		PhoneNumber: "+622342342322",
+		DeviceLabel: "Chrome on Android",
+		IPAddress:   "203.0.113.7",
+		Time:        time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	})
+	assert.Nil(t, err, "error should be nil")
+	assert.Contains(t, buf.String(), "to=+622342342322")
+	assert.Contains(t, buf.String(), "from Chrome on Android (203.0.113.7) at 2024-01-02 03:04 UTC")
+}
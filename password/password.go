@@ -0,0 +1,106 @@
+// This file contains the password hasher used for user passwords.
+// A hasher creates new hashes with its current scheme and still verifies
+// hashes of older schemes, so stored hashes can be upgraded on login.
+package password
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	ErrMismatchedHashAndPassword = errors.New("hashed password is not the hash of the given password")
+	ErrUnknownHash               = errors.New("hashed password format is not supported")
+)
+
+// Scheme is a single hashing algorithm producing PHC formatted strings,
+// e.g. $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>.
+type Scheme interface {
+	Hash(password []byte) (string, error)
+	Compare(hash string, password []byte) error
+	// Recognizes reports whether hash was produced by this scheme.
+	Recognizes(hash string) bool
+	// NeedsRehash reports whether hash was made with outdated parameters.
+	NeedsRehash(hash string) bool
+}
+
+type Hasher struct {
+	current Scheme
+	schemes []Scheme
+
+	dummyOnce   sync.Once
+	dummyHashes []string
+}
+
+// NewHasher returns a hasher hashing with current and verifying hashes of
+// current and of the legacy schemes.
+func NewHasher(current Scheme, legacy ...Scheme) *Hasher {
+	return &Hasher{
+		current: current,
+		schemes: append([]Scheme{current}, legacy...),
+	}
+}
+
+func (h *Hasher) Hash(password []byte) (string, error) {
+	return h.current.Hash(password)
+}
+
+// Compare checks password against hash with the scheme that produced it.
+// It also compares against a dummy hash of every other scheme, so the time
+// it takes does not tell which scheme the hash uses.
+func (h *Hasher) Compare(hash string, password []byte) error {
+	i, err := h.scheme(hash)
+	if err != nil {
+		return err
+	}
+
+	err = h.schemes[i].Compare(hash, password)
+	h.compareDummies(i, password)
+	return err
+}
+
+// NeedsRehash reports whether hash should be replaced by a hash of the
+// current scheme, either because it uses another scheme or outdated
+// parameters.
+func (h *Hasher) NeedsRehash(hash string) bool {
+	if !h.current.Recognizes(hash) {
+		return true
+	}
+
+	return h.current.NeedsRehash(hash)
+}
+
+// CompareDummy takes as long as a Compare. Call it when there is no hash to
+// compare with, e.g. for an unknown user, so the response time does not
+// tell the difference.
+func (h *Hasher) CompareDummy(password []byte) {
+	h.compareDummies(-1, password)
+}
+
+// compareDummies compares password against a dummy hash of every scheme but
+// the one at index skip.
+func (h *Hasher) compareDummies(skip int, password []byte) {
+	h.dummyOnce.Do(func() {
+		h.dummyHashes = make([]string, len(h.schemes))
+		for i, scheme := range h.schemes {
+			h.dummyHashes[i], _ = scheme.Hash([]byte("dummy password"))
+		}
+	})
+
+	for i, scheme := range h.schemes {
+		if i != skip {
+			_ = scheme.Compare(h.dummyHashes[i], password)
+		}
+	}
+}
+
+// scheme returns the index of the scheme that produced hash.
+func (h *Hasher) scheme(hash string) (int, error) {
+	for i, scheme := range h.schemes {
+		if scheme.Recognizes(hash) {
+			return i, nil
+		}
+	}
+
+	return -1, ErrUnknownHash
+}
@@ -0,0 +1,120 @@
+package password
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestArgon2id(t *testing.T) {
+	scheme := DefaultArgon2id
+
+	hash, err := scheme.Hash([]byte("AAAAAAAAA1a^1"))
+	assert.Nil(t, err, "error should be nil")
+	assert.Regexp(t, `^\$argon2id\$v=19\$m=19456,t=2,p=1\$[A-Za-z0-9+/]{22}\$[A-Za-z0-9+/]{43}$`, hash)
+
+	t.Run("compare", func(t *testing.T) {
+		assert.Nil(t, scheme.Compare(hash, []byte("AAAAAAAAA1a^1")))
+		assert.ErrorIs(t, scheme.Compare(hash, []byte("AAAAAAAAA1a^2")), ErrMismatchedHashAndPassword)
+	})
+
+	t.Run("compare with other parameters", func(t *testing.T) {
+		weaker := Argon2id{Memory: 8 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+		weakHash, _ := weaker.Hash([]byte("AAAAAAAAA1a^1"))
+
+		assert.Nil(t, scheme.Compare(weakHash, []byte("AAAAAAAAA1a^1")))
+		assert.True(t, scheme.NeedsRehash(weakHash))
+		assert.False(t, scheme.NeedsRehash(hash))
+	})
+
+	t.Run("malformed hash", func(t *testing.T) {
+		assert.ErrorIs(t, scheme.Compare("$argon2id$v=19$m=19456$abc", []byte("AAAAAAAAA1a^1")), ErrUnknownHash)
+		assert.ErrorIs(t, scheme.Compare("$argon2id$v=16$m=19456,t=2,p=1$c2FsdA$a2V5", []byte("AAAAAAAAA1a^1")), ErrUnknownHash)
+	})
+
+	t.Run("parameters out of range", func(t *testing.T) {
+		hashes := []string{
+			"$argon2id$v=19$m=19456,t=2,p=0$c2FsdA$a2V5",
+			"$argon2id$v=19$m=19456,t=0,p=1$c2FsdA$a2V5",
+			"$argon2id$v=19$m=7,t=2,p=1$c2FsdA$a2V5",
+			"$argon2id$v=19$m=15,t=2,p=2$c2FsdA$a2V5",
+			"$argon2id$v=19$m=19456,t=2,p=1$$a2V5",
+			"$argon2id$v=19$m=19456,t=2,p=1$c2FsdA$",
+		}
+
+		for _, hash := range hashes {
+			assert.ErrorIs(t, scheme.Compare(hash, []byte("AAAAAAAAA1a^1")), ErrUnknownHash, hash)
+			assert.True(t, scheme.NeedsRehash(hash), hash)
+		}
+	})
+}
+
+func TestBcrypt(t *testing.T) {
+	scheme := Bcrypt{Cost: bcrypt.MinCost + 1}
+
+	hash, err := scheme.Hash([]byte("AAAAAAAAA1a^1"))
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, scheme.Recognizes(hash))
+
+	assert.Nil(t, scheme.Compare(hash, []byte("AAAAAAAAA1a^1")))
+	assert.ErrorIs(t, scheme.Compare(hash, []byte("AAAAAAAAA1a^2")), ErrMismatchedHashAndPassword)
+
+	minCostHash, _ := bcrypt.GenerateFromPassword([]byte("AAAAAAAAA1a^1"), bcrypt.MinCost)
+	assert.True(t, scheme.NeedsRehash(string(minCostHash)))
+	assert.False(t, scheme.NeedsRehash(hash))
+}
+
+func TestHasher(t *testing.T) {
+	hasher := NewHasher(DefaultArgon2id, Bcrypt{Cost: bcrypt.MinCost})
+
+	legacyHash, _ := bcrypt.GenerateFromPassword([]byte("AAAAAAAAA1a^1"), bcrypt.MinCost)
+	hash, err := hasher.Hash([]byte("AAAAAAAAA1a^1"))
+	assert.Nil(t, err, "error should be nil")
+
+	t.Run("hashes with current scheme", func(t *testing.T) {
+		assert.True(t, DefaultArgon2id.Recognizes(hash))
+		assert.False(t, hasher.NeedsRehash(hash))
+	})
+
+	t.Run("verifies legacy scheme", func(t *testing.T) {
+		assert.Nil(t, hasher.Compare(string(legacyHash), []byte("AAAAAAAAA1a^1")))
+		assert.True(t, hasher.NeedsRehash(string(legacyHash)))
+	})
+
+	t.Run("compare dummy", func(t *testing.T) {
+		hasher.CompareDummy([]byte("AAAAAAAAA1a^1"))
+		assert.True(t, DefaultArgon2id.Recognizes(hasher.dummyHashes[0]))
+		assert.True(t, Bcrypt{}.Recognizes(hasher.dummyHashes[1]))
+	})
+
+	t.Run("compares with every scheme", func(t *testing.T) {
+		current := &countingScheme{Scheme: DefaultArgon2id}
+		legacy := &countingScheme{Scheme: Bcrypt{Cost: bcrypt.MinCost}}
+		hasher := NewHasher(current, legacy)
+
+		// whether there is a hash and which scheme made it, the same
+		// comparisons are run
+		_ = hasher.Compare(hash, []byte("AAAAAAAAA1a^2"))
+		_ = hasher.Compare(string(legacyHash), []byte("AAAAAAAAA1a^2"))
+		hasher.CompareDummy([]byte("AAAAAAAAA1a^2"))
+
+		assert.Equal(t, 3, current.compared)
+		assert.Equal(t, 3, legacy.compared)
+	})
+
+	t.Run("unknown scheme", func(t *testing.T) {
+		assert.ErrorIs(t, hasher.Compare("$scrypt$ln=16,r=8,p=1$abc$def", []byte("AAAAAAAAA1a^1")), ErrUnknownHash)
+		assert.ErrorIs(t, NewHasher(DefaultArgon2id).Compare(string(legacyHash), []byte("AAAAAAAAA1a^1")), ErrUnknownHash)
+	})
+}
+
+type countingScheme struct {
+	Scheme
+	compared int
+}
+
+func (s *countingScheme) Compare(hash string, password []byte) error {
+	s.compared++
+	return s.Scheme.Compare(hash, password)
+}
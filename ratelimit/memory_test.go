@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryStore(NewMemoryStoreOptions{
+		Now: func() time.Time { return now },
+	})
+	limit := Limit{Burst: 3, Period: time.Minute}
+	ctx := context.Background()
+
+	t.Run("burst", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			result, err := store.Take(ctx, "ip:10.0.0.1", limit)
+			assert.Nil(t, err, "error should be nil")
+			assert.True(t, result.Allowed)
+		}
+
+		result, _ := store.Take(ctx, "ip:10.0.0.1", limit)
+		assert.False(t, result.Allowed)
+		assert.Equal(t, 20*time.Second, result.RetryAfter)
+	})
+
+	t.Run("keys are independent", func(t *testing.T) {
+		result, _ := store.Take(ctx, "ip:10.0.0.2", limit)
+		assert.True(t, result.Allowed)
+	})
+
+	t.Run("refill", func(t *testing.T) {
+		now = now.Add(15 * time.Second)
+		result, _ := store.Take(ctx, "ip:10.0.0.1", limit)
+		assert.False(t, result.Allowed)
+		assert.Equal(t, 5*time.Second, result.RetryAfter)
+
+		now = now.Add(5 * time.Second)
+		result, _ = store.Take(ctx, "ip:10.0.0.1", limit)
+		assert.True(t, result.Allowed)
+	})
+
+	t.Run("sweep full buckets", func(t *testing.T) {
+		now = now.Add(time.Hour)
+		store.sweep(now)
+		assert.Empty(t, store.buckets)
+	})
+}
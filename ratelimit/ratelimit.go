@@ -0,0 +1,32 @@
+// This file contains the rate limiter of the API. Limits are token buckets
+// kept in a Store, in memory for a single instance or in a shared store
+// when the service runs on several instances.
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limit allows Burst requests at once, refilled evenly over Period.
+type Limit struct {
+	Burst  int
+	Period time.Duration
+}
+
+// rate is the number of tokens refilled per second.
+func (l Limit) rate() float64 {
+	return float64(l.Burst) / l.Period.Seconds()
+}
+
+type Result struct {
+	Allowed bool
+	// RetryAfter is how long until the next request is allowed, zero
+	// when the request is allowed.
+	RetryAfter time.Duration
+}
+
+// Store takes one token from the bucket of key.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
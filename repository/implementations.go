@@ -2,9 +2,14 @@ package repository
 
 import (
 	"context"
+	"crypto/subtle"
+	"database/sql"
 	"errors"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 func (r *Repository) StoreRegistration(ctx context.Context, data *User) error {
@@ -20,57 +25,325 @@ func (r *Repository) StoreRegistration(ctx context.Context, data *User) error {
 	return err
 }
 
+// GetUser returns the user with phoneNumber whatever the status of the
+// account, callers decide what a status that is not active allows.
 func (r *Repository) GetUser(ctx context.Context, phoneNumber string) (*User, error) {
 	user := &User{}
 
 	query := `
 	SELECT
-		id, phone_number, password, full_name
+		id, phone_number, password, full_name, phone_verified_at, status
 	FROM 
 		"user"
 	WHERE
 		phone_number = $1`
 
-	err := r.Db.QueryRow(query, phoneNumber).Scan(&user.ID, &user.PhoneNumber, &user.Password, &user.FullName)
+	err := r.Db.QueryRow(query, phoneNumber).Scan(&user.ID, &user.PhoneNumber, &user.Password, &user.FullName,
+		&user.PhoneVerifiedAt, &user.Status)
 	if err != nil {
 		return nil, err
 	}
 
-	return user, err
+	return user, nil
 }
 
+// GetUserByID returns the user with userID whatever the status of the
+// account, like GetUser.
 func (r *Repository) GetUserByID(ctx context.Context, userID string) (*User, error) {
 	user := &User{}
 
 	query := `
 	SELECT
-		id, phone_number, password, full_name
+		id, phone_number, password, full_name, phone_verified_at, status
 	FROM 
 		"user"
 	WHERE
 		id = $1`
 
-	err := r.Db.QueryRow(query, userID).Scan(&user.ID, &user.PhoneNumber, &user.Password, &user.FullName)
+	err := r.Db.QueryRow(query, userID).Scan(&user.ID, &user.PhoneNumber, &user.Password, &user.FullName,
+		&user.PhoneVerifiedAt, &user.Status)
 	if err != nil {
 		return nil, err
 	}
 
-	return user, err
+	return user, nil
 }
 
-func (r *Repository) UpdateLogin(ctx context.Context, userID string) error {
-	loginID := uuid.New().String()
+// RecordLoginSuccess stores a successful login event, counts it and clears
+// the failed logins of the user.
+func (r *Repository) RecordLoginSuccess(ctx context.Context, data *LoginEvent) error {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertLoginEvent(ctx, tx, data)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO login (id, user_id, success_counter) VALUES ($1, $2, 1)
+	ON CONFLICT (user_id)
+	DO UPDATE SET success_counter = login.success_counter + 1,
+		last_login = now(), failure_counter = 0, locked_until = NULL, updated_at = now();
+	`
+	_, err = tx.ExecContext(ctx, query, uuid.New().String(), data.UserID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetLoginAttempts returns the failed logins of a user, zero if the user
+// never logged in.
+func (r *Repository) GetLoginAttempts(ctx context.Context, userID string) (*LoginAttempts, error) {
+	attempts := &LoginAttempts{}
+	query := `
+	SELECT
+		failure_counter, locked_until
+	FROM
+		login
+	WHERE
+		user_id = $1`
+
+	err := r.Db.QueryRowContext(ctx, query, userID).Scan(&attempts.FailureCounter, &attempts.LockedUntil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return attempts, nil
+		}
+		return nil, err
+	}
+
+	return attempts, nil
+}
+
+// RecordLoginFailure stores a failed login event and counts it towards the
+// lockout of the user. Unless backoff is nil, logins are refused for as long
+// as it returns for the new number of consecutive failures. The row stays
+// locked until the transaction ends, so concurrent failures each see the
+// count of the ones before.
+func (r *Repository) RecordLoginFailure(ctx context.Context, data *LoginEvent, backoff func(failures int) time.Duration) error {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertLoginEvent(ctx, tx, data)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO login (id, user_id, success_counter, failure_counter, last_failure)
+	VALUES ($1, $2, 0, 1, now())
+	ON CONFLICT (user_id)
+	DO UPDATE SET failure_counter = login.failure_counter + 1, last_failure = now(), updated_at = now()
+	RETURNING failure_counter;
+	`
+	var failures int
+	err = tx.QueryRowContext(ctx, query, uuid.New().String(), data.UserID).Scan(&failures)
+	if err != nil {
+		return err
+	}
+
+	if backoff != nil {
+		query = `
+		UPDATE login SET locked_until = $2 WHERE user_id = $1;
+		`
+		_, err = tx.ExecContext(ctx, query, data.UserID, time.Now().Add(backoff(failures)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// StoreLoginEvent stores a login attempt that does not count towards the
+// lockout, e.g. one rejected because the user is locked out already.
+func (r *Repository) StoreLoginEvent(ctx context.Context, data *LoginEvent) error {
+	return insertLoginEvent(ctx, r.Db, data)
+}
+
+// GetUnknownLoginAttempts returns the failed logins with a phone number
+// that is not registered, zero if there were none.
+func (r *Repository) GetUnknownLoginAttempts(ctx context.Context, phoneNumber string) (*LoginAttempts, error) {
+	attempts := &LoginAttempts{}
+	query := `
+	SELECT
+		failure_counter, locked_until
+	FROM
+		unknown_login
+	WHERE
+		phone_number = $1`
+
+	err := r.Db.QueryRowContext(ctx, query, phoneNumber).Scan(&attempts.FailureCounter, &attempts.LockedUntil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return attempts, nil
+		}
+		return nil, err
+	}
+
+	return attempts, nil
+}
+
+// RecordUnknownLoginFailure counts a failed login with a phone number that
+// is not registered, the way RecordLoginFailure does for a user.
+func (r *Repository) RecordUnknownLoginFailure(ctx context.Context, phoneNumber string, backoff func(failures int) time.Duration) error {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO unknown_login (phone_number, failure_counter, last_failure)
+	VALUES ($1, 1, now())
+	ON CONFLICT (phone_number)
+	DO UPDATE SET failure_counter = unknown_login.failure_counter + 1, last_failure = now(), updated_at = now()
+	RETURNING failure_counter;
+	`
+	var failures int
+	err = tx.QueryRowContext(ctx, query, phoneNumber).Scan(&failures)
+	if err != nil {
+		return err
+	}
+
+	if backoff != nil {
+		query = `
+		UPDATE unknown_login SET locked_until = $2 WHERE phone_number = $1;
+		`
+		_, err = tx.ExecContext(ctx, query, phoneNumber, time.Now().Add(backoff(failures)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func insertLoginEvent(ctx context.Context, db interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}, data *LoginEvent) error {
 	query := `
-	INSERT INTO login (id, user_id, success_counter) VALUES ($1, $2, 1) 
-	ON CONFLICT (user_id) 
-	DO UPDATE SET success_counter = (SELECT success_counter FROM login WHERE user_id =$2) + 1;
+	INSERT INTO login_event (id, user_id, success, "method", failure_reason, ip_address, user_agent, session_id,
+		ip_prefix, user_agent_family, flagged)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, '')::uuid, $9, $10, $11);
 	`
+	_, err := db.ExecContext(ctx, query, data.ID, data.UserID, data.Success, data.Method, data.FailureReason,
+		data.IPAddress, data.UserAgent, data.SessionID, data.IPPrefix, data.UserAgentFamily, data.Flagged)
+	return err
+}
+
+// ListLoginEvents returns up to limit login events of a user, newest first,
+// starting after the cursor when it is set.
+func (r *Repository) ListLoginEvents(ctx context.Context, userID string, after *LoginEventCursor, limit int) ([]*LoginEvent, error) {
+	query := `
+	SELECT
+		id, user_id, success, "method", failure_reason, ip_address, user_agent,
+		COALESCE(session_id::text, ''), flagged, created_at
+	FROM
+		login_event
+	WHERE
+		user_id = $1`
+	args := []interface{}{userID}
+
+	if after != nil {
+		query += ` AND (created_at, id) < ($2, $3)`
+		args = append(args, after.CreatedAt, after.ID)
+	}
+
+	query += `
+	ORDER BY
+		created_at DESC, id DESC
+	LIMIT ` + strconv.Itoa(limit)
+
+	rows, err := r.Db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*LoginEvent{}
+	for rows.Next() {
+		event := &LoginEvent{}
+		err := rows.Scan(&event.ID, &event.UserID, &event.Success, &event.Method, &event.FailureReason,
+			&event.IPAddress, &event.UserAgent, &event.SessionID, &event.Flagged, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// ListLoginFingerprints returns the fingerprints of the last limit
+// successful logins of a user, newest first.
+func (r *Repository) ListLoginFingerprints(ctx context.Context, userID string, limit int) ([]*LoginFingerprint, error) {
+	query := `
+	SELECT
+		ip_prefix, user_agent_family
+	FROM
+		login_event
+	WHERE
+		user_id = $1 AND success
+	ORDER BY
+		created_at DESC, id DESC
+	LIMIT ` + strconv.Itoa(limit)
+
+	rows, err := r.Db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	_, err := r.Db.Exec(query, loginID, userID)
+	fingerprints := []*LoginFingerprint{}
+	for rows.Next() {
+		fingerprint := &LoginFingerprint{}
+		err := rows.Scan(&fingerprint.IPPrefix, &fingerprint.UserAgentFamily)
+		if err != nil {
+			return nil, err
+		}
+		fingerprints = append(fingerprints, fingerprint)
+	}
+
+	return fingerprints, rows.Err()
+}
+
+// UnlockUser clears the failed logins of a user. It returns sql.ErrNoRows
+// when the user does not exist.
+func (r *Repository) UnlockUser(ctx context.Context, userID, updatedBy string) error {
+	var exists bool
+	query := `
+	SELECT EXISTS (SELECT 1 FROM "user" WHERE id = $1)`
+	err := r.Db.QueryRowContext(ctx, query, userID).Scan(&exists)
 	if err != nil {
 		return err
 	}
 
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	query = `
+	UPDATE
+		login
+	SET
+		failure_counter = 0,
+		locked_until = NULL,
+		updated_at = now(),
+		updated_by = $2
+	WHERE
+		user_id = $1
+	`
+
+	_, err = r.Db.ExecContext(ctx, query, userID, updatedBy)
 	return err
 }
 
@@ -80,9 +353,10 @@ func (r *Repository) UpdateProfile(ctx context.Context, data *User) error {
 		"user"
 	SET
 		full_name = $2,
-		phone_number = $3
+		phone_number = $3,
+		phone_verified_at = CASE WHEN phone_number = $3 THEN phone_verified_at END
 	WHERE
-		id = $1
+		id = $1 AND status = 'active'
 	`
 
 	result, err := r.Db.Exec(query, data.ID, data.FullName, data.PhoneNumber)
@@ -102,3 +376,1093 @@ func (r *Repository) UpdateProfile(ctx context.Context, data *User) error {
 
 	return nil
 }
+
+func (r *Repository) UpdatePassword(ctx context.Context, userID, hashedPassword, updatedBy string) error {
+	query := `
+	UPDATE
+		"user"
+	SET
+		"password" = $2,
+		updated_at = now(),
+		updated_by = $3
+	WHERE
+		id = $1
+	`
+
+	_, err := r.Db.ExecContext(ctx, query, userID, hashedPassword, updatedBy)
+	return err
+}
+
+// DeleteUser soft deletes an active user, whose status becomes
+// pending_deletion. The user is purged with all rows referencing it at
+// purgeAt unless reactivated before.
+func (r *Repository) DeleteUser(ctx context.Context, userID string, purgeAt time.Time) error {
+	query := `
+	UPDATE
+		"user"
+	SET
+		status = 'pending_deletion',
+		deleted_at = now(),
+		purge_at = $2,
+		updated_at = now(),
+		updated_by = $1
+	WHERE
+		id = $1 AND status = 'active'
+	`
+	result, err := r.Db.ExecContext(ctx, query, userID, purgeAt)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected < 1 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// UpdateUserStatus moves a user whose status is one of from to status. It
+// returns sql.ErrNoRows when the user has another status. Leaving
+// pending_deletion cancels the purge.
+func (r *Repository) UpdateUserStatus(ctx context.Context, userID string, from []string, status, updatedBy string) error {
+	query := `
+	UPDATE
+		"user"
+	SET
+		status = $3,
+		deleted_at = NULL,
+		purge_at = NULL,
+		updated_at = now(),
+		updated_by = $4
+	WHERE
+		id = $1 AND status = ANY($2)
+	`
+	result, err := r.Db.ExecContext(ctx, query, userID, pq.Array(from), status, updatedBy)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected < 1 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// userTables are the tables referencing "user". Their foreign keys do not
+// cascade, so purging a user deletes from them first.
+var userTables = []string{
+	"login",
+	"login_event",
+	"refresh_token",
+	"user_session",
+	"one_time_code",
+	"totp_credential",
+	"webauthn_credential",
+	"recovery_code",
+	"audit_event",
+	"authorization_code",
+}
+
+// PurgeDeletedUsers removes the deleted users due at now along with their
+// rows in every table and returns how many were removed.
+func (r *Repository) PurgeDeletedUsers(ctx context.Context, now time.Time) (int, error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// lock the due users so a purge running elsewhere skips them
+	rows, err := tx.QueryContext(ctx, `
+	SELECT
+		id
+	FROM
+		"user"
+	WHERE
+		purge_at <= $1
+	FOR UPDATE SKIP LOCKED`, now)
+	if err != nil {
+		return 0, err
+	}
+
+	userIDs := []string{}
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(userIDs) == 0 {
+		return 0, nil
+	}
+
+	// the failed logins counted for the phone number before it was registered
+	_, err = tx.ExecContext(ctx, `
+	DELETE FROM
+		unknown_login
+	WHERE
+		phone_number IN (SELECT phone_number FROM "user" WHERE id = ANY($1))`, pq.Array(userIDs))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, table := range append(userTables, `"user"`) {
+		column := "user_id"
+		if table == `"user"` {
+			column = "id"
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE `+column+` = ANY($1)`, pq.Array(userIDs))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(userIDs), tx.Commit()
+}
+
+// ExportUser collects everything stored about a user from one consistent
+// snapshot.
+func (r *Repository) ExportUser(ctx context.Context, userID string) (*UserExport, error) {
+	tx, err := r.Db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	export := &UserExport{
+		Profile:            &ProfileExport{},
+		LoginEvents:        []*LoginEvent{},
+		Sessions:           []*Session{},
+		RefreshTokens:      []*RefreshTokenExport{},
+		OneTimeCodes:       []*OneTimeCodeExport{},
+		Passkeys:           []*WebAuthnCredential{},
+		RecoveryCodes:      []*RecoveryCodeExport{},
+		AuditEvents:        []*AuditEvent{},
+		AuthorizationCodes: []*AuthorizationCodeExport{},
+	}
+
+	err = tx.QueryRowContext(ctx, `
+	SELECT
+		id, full_name, phone_number, phone_verified_at, status, created_at, updated_at
+	FROM
+		"user"
+	WHERE
+		id = $1`, userID).Scan(&export.Profile.ID, &export.Profile.FullName, &export.Profile.PhoneNumber,
+		&export.Profile.PhoneVerifiedAt, &export.Profile.Status, &export.Profile.CreatedAt, &export.Profile.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	login := &LoginExport{}
+	err = tx.QueryRowContext(ctx, `
+	SELECT
+		success_counter, last_login, failure_counter, last_failure, locked_until
+	FROM
+		login
+	WHERE
+		user_id = $1`, userID).Scan(&login.SuccessCounter, &login.LastLogin, &login.FailureCounter,
+		&login.LastFailure, &login.LockedUntil)
+	if err == nil {
+		export.Login = login
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	unknownLogin := &UnknownLoginExport{}
+	err = tx.QueryRowContext(ctx, `
+	SELECT
+		phone_number, failure_counter, last_failure, locked_until
+	FROM
+		unknown_login
+	WHERE
+		phone_number = $1`, export.Profile.PhoneNumber).Scan(&unknownLogin.PhoneNumber, &unknownLogin.FailureCounter,
+		&unknownLogin.LastFailure, &unknownLogin.LockedUntil)
+	if err == nil {
+		export.UnknownLogin = unknownLogin
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	totpCredential := &TOTPCredentialExport{}
+	err = tx.QueryRowContext(ctx, `
+	SELECT
+		confirmed_at, created_at
+	FROM
+		totp_credential
+	WHERE
+		user_id = $1`, userID).Scan(&totpCredential.ConfirmedAt, &totpCredential.CreatedAt)
+	if err == nil {
+		export.TOTPCredential = totpCredential
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	err = queryUserRows(ctx, tx, `
+	SELECT
+		id, user_id, success, "method", failure_reason, ip_address, user_agent,
+		COALESCE(session_id::text, ''), ip_prefix, user_agent_family, flagged, created_at
+	FROM
+		login_event
+	WHERE
+		user_id = $1
+	ORDER BY
+		created_at, id`, userID, func(rows *sql.Rows) error {
+		event := &LoginEvent{}
+		export.LoginEvents = append(export.LoginEvents, event)
+		return rows.Scan(&event.ID, &event.UserID, &event.Success, &event.Method, &event.FailureReason,
+			&event.IPAddress, &event.UserAgent, &event.SessionID, &event.IPPrefix, &event.UserAgentFamily,
+			&event.Flagged, &event.CreatedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = queryUserRows(ctx, tx, `
+	SELECT
+		`+sessionColumns+`
+	FROM
+		user_session s
+	WHERE
+		s.user_id = $1
+	ORDER BY
+		s.created_at`, userID, func(rows *sql.Rows) error {
+		session, err := scanSession(rows)
+		if err != nil {
+			return err
+		}
+		export.Sessions = append(export.Sessions, session)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = queryUserRows(ctx, tx, `
+	SELECT
+		id, family_id, scope, expires_at, rotated_at, revoked_at, created_at
+	FROM
+		refresh_token
+	WHERE
+		user_id = $1
+	ORDER BY
+		created_at`, userID, func(rows *sql.Rows) error {
+		token := &RefreshTokenExport{}
+		export.RefreshTokens = append(export.RefreshTokens, token)
+		return rows.Scan(&token.ID, &token.FamilyID, &token.Scope, &token.ExpiresAt, &token.RotatedAt,
+			&token.RevokedAt, &token.CreatedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = queryUserRows(ctx, tx, `
+	SELECT
+		id, purpose, attempts, expires_at, consumed_at, created_at
+	FROM
+		one_time_code
+	WHERE
+		user_id = $1
+	ORDER BY
+		created_at`, userID, func(rows *sql.Rows) error {
+		code := &OneTimeCodeExport{}
+		export.OneTimeCodes = append(export.OneTimeCodes, code)
+		return rows.Scan(&code.ID, &code.Purpose, &code.Attempts, &code.ExpiresAt, &code.ConsumedAt, &code.CreatedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = queryUserRows(ctx, tx, `
+	SELECT
+		`+webAuthnCredentialColumns+`
+	FROM
+		webauthn_credential
+	WHERE
+		user_id = $1
+	ORDER BY
+		created_at`, userID, func(rows *sql.Rows) error {
+		credential, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return err
+		}
+		export.Passkeys = append(export.Passkeys, credential)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = queryUserRows(ctx, tx, `
+	SELECT
+		id, used_at, created_at
+	FROM
+		recovery_code
+	WHERE
+		user_id = $1
+	ORDER BY
+		created_at, id`, userID, func(rows *sql.Rows) error {
+		code := &RecoveryCodeExport{}
+		export.RecoveryCodes = append(export.RecoveryCodes, code)
+		return rows.Scan(&code.ID, &code.UsedAt, &code.CreatedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = queryUserRows(ctx, tx, `
+	SELECT
+		id, user_id, "action", detail, ip_address, user_agent, created_at
+	FROM
+		audit_event
+	WHERE
+		user_id = $1
+	ORDER BY
+		created_at`, userID, func(rows *sql.Rows) error {
+		event := &AuditEvent{}
+		export.AuditEvents = append(export.AuditEvents, event)
+		return rows.Scan(&event.ID, &event.UserID, &event.Action, &event.Detail, &event.IPAddress,
+			&event.UserAgent, &event.CreatedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = queryUserRows(ctx, tx, `
+	SELECT
+		client_id, redirect_uri, scope, auth_time, expires_at, consumed_at
+	FROM
+		authorization_code
+	WHERE
+		user_id = $1
+	ORDER BY
+		created_at`, userID, func(rows *sql.Rows) error {
+		code := &AuthorizationCodeExport{}
+		export.AuthorizationCodes = append(export.AuthorizationCodes, code)
+		return rows.Scan(&code.ClientID, &code.RedirectURI, &code.Scope, &code.AuthTime, &code.ExpiresAt,
+			&code.ConsumedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+// queryUserRows runs query with userID and calls scan for every row.
+func queryUserRows(ctx context.Context, tx *sql.Tx, query, userID string, scan func(rows *sql.Rows) error) error {
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (r *Repository) VerifyPhoneNumber(ctx context.Context, userID string) error {
+	query := `
+	UPDATE
+		"user"
+	SET
+		phone_verified_at = now(),
+		updated_at = now(),
+		updated_by = $1
+	WHERE
+		id = $1 AND phone_verified_at IS NULL
+	`
+
+	_, err := r.Db.ExecContext(ctx, query, userID)
+	return err
+}
+
+func (r *Repository) StoreRefreshToken(ctx context.Context, data *RefreshToken) error {
+	query := `
+	INSERT INTO refresh_token (id, user_id, family_id, token_hash, scope, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6);
+`
+	_, err := r.Db.ExecContext(ctx, query, data.ID, data.UserID, data.FamilyID, data.TokenHash, data.Scope, data.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return err
+}
+
+func (r *Repository) GetRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	token := &RefreshToken{}
+	query := `
+	SELECT
+		id, user_id, family_id, token_hash, scope, expires_at, rotated_at, revoked_at
+	FROM
+		refresh_token
+	WHERE
+		token_hash = $1`
+
+	err := r.Db.QueryRowContext(ctx, query, tokenHash).Scan(&token.ID, &token.UserID, &token.FamilyID,
+		&token.TokenHash, &token.Scope, &token.ExpiresAt, &token.RotatedAt, &token.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, err
+}
+
+// RotateRefreshToken marks the old token as rotated and stores its successor
+// in a single transaction. It returns ErrRefreshTokenRotated when the old
+// token was rotated or revoked concurrently.
+func (r *Repository) RotateRefreshToken(ctx context.Context, oldID string, data *RefreshToken) error {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE
+		refresh_token
+	SET
+		rotated_at = now(),
+		updated_at = now()
+	WHERE
+		id = $1 AND rotated_at IS NULL AND revoked_at IS NULL
+	`
+	result, err := tx.ExecContext(ctx, query, oldID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected < 1 {
+		return ErrRefreshTokenRotated
+	}
+
+	query = `
+	INSERT INTO refresh_token (id, user_id, family_id, token_hash, scope, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6);
+`
+	_, err = tx.ExecContext(ctx, query, data.ID, data.UserID, data.FamilyID, data.TokenHash, data.Scope, data.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repository) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	query := `
+	UPDATE
+		refresh_token
+	SET
+		revoked_at = now(),
+		updated_at = now()
+	WHERE
+		family_id = $1 AND revoked_at IS NULL
+	`
+	_, err := r.Db.ExecContext(ctx, query, familyID)
+	if err != nil {
+		return err
+	}
+
+	return err
+}
+
+// RevokeOtherRefreshTokenFamilies revokes every refresh token family of a
+// user except keepFamilyID and returns the ids of the revoked families.
+func (r *Repository) RevokeOtherRefreshTokenFamilies(ctx context.Context, userID, keepFamilyID string) ([]string, error) {
+	query := `
+	UPDATE
+		refresh_token
+	SET
+		revoked_at = now(),
+		updated_at = now()
+	WHERE
+		user_id = $1 AND family_id::text <> $2 AND revoked_at IS NULL
+	RETURNING
+		family_id
+	`
+	rows, err := r.Db.QueryContext(ctx, query, userID, keepFamilyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	familyIDs := []string{}
+	seen := map[string]bool{}
+	for rows.Next() {
+		var familyID string
+		if err := rows.Scan(&familyID); err != nil {
+			return nil, err
+		}
+
+		if !seen[familyID] {
+			seen[familyID] = true
+			familyIDs = append(familyIDs, familyID)
+		}
+	}
+
+	return familyIDs, rows.Err()
+}
+
+func (r *Repository) StoreSession(ctx context.Context, data *Session) error {
+	query := `
+	INSERT INTO user_session (id, user_id, device_label, user_agent, ip_address, auth_time)
+	VALUES ($1, $2, $3, $4, $5, $6);
+	`
+	_, err := r.Db.ExecContext(ctx, query, data.ID, data.UserID, data.DeviceLabel, data.UserAgent, data.IPAddress, data.AuthTime)
+	return err
+}
+
+// sessionLive holds for sessions that still have a usable refresh token, a
+// session signed out, revoked or expired has none.
+const sessionLive = `EXISTS (
+			SELECT 1 FROM refresh_token rt
+			WHERE rt.family_id = s.id AND rt.rotated_at IS NULL AND rt.revoked_at IS NULL AND rt.expires_at > now()
+		)`
+
+const sessionColumns = `s.id, s.user_id, s.device_label, s.user_agent, s.ip_address, s.auth_time, s.created_at, s.last_seen_at,
+		NOT ` + sessionLive
+
+func scanSession(row interface{ Scan(...interface{}) error }) (*Session, error) {
+	session := &Session{}
+	err := row.Scan(&session.ID, &session.UserID, &session.DeviceLabel, &session.UserAgent,
+		&session.IPAddress, &session.AuthTime, &session.CreatedAt, &session.LastSeenAt, &session.SignedOut)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (r *Repository) GetSession(ctx context.Context, id string) (*Session, error) {
+	query := `
+	SELECT
+		` + sessionColumns + `
+	FROM
+		user_session s
+	WHERE
+		s.id = $1`
+
+	return scanSession(r.Db.QueryRowContext(ctx, query, id))
+}
+
+// ListSessions returns the sessions of a user that still hold a usable
+// refresh token, most recently seen first. Sessions signed out or expired
+// are left out.
+func (r *Repository) ListSessions(ctx context.Context, userID string) ([]*Session, error) {
+	query := `
+	SELECT
+		` + sessionColumns + `
+	FROM
+		user_session s
+	WHERE
+		s.user_id = $1
+		AND ` + sessionLive + `
+	ORDER BY
+		s.last_seen_at DESC`
+
+	rows, err := r.Db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// TouchSession records that the session was used just now.
+func (r *Repository) TouchSession(ctx context.Context, id string) error {
+	query := `
+	UPDATE
+		user_session
+	SET
+		last_seen_at = now(),
+		updated_at = now()
+	WHERE
+		id = $1
+	`
+
+	_, err := r.Db.ExecContext(ctx, query, id)
+	return err
+}
+
+func (r *Repository) GetClient(ctx context.Context, clientID string) (*Client, error) {
+	client := &Client{}
+	query := `
+	SELECT
+		id, name, secret_hash, redirect_uris, scopes
+	FROM
+		client
+	WHERE
+		id = $1`
+
+	err := r.Db.QueryRowContext(ctx, query, clientID).Scan(&client.ID, &client.Name, &client.SecretHash,
+		pq.Array(&client.RedirectURIs), pq.Array(&client.Scopes))
+	if err != nil {
+		return nil, err
+	}
+
+	return client, err
+}
+
+func (r *Repository) StoreAuthorizationCode(ctx context.Context, data *AuthorizationCode) error {
+	query := `
+	INSERT INTO authorization_code (code_hash, client_id, user_id, redirect_uri, scope, nonce,
+		code_challenge, code_challenge_method, auth_time, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);
+`
+	_, err := r.Db.ExecContext(ctx, query, data.CodeHash, data.ClientID, data.UserID, data.RedirectURI, data.Scope,
+		data.Nonce, data.CodeChallenge, data.CodeChallengeMethod, data.AuthTime, data.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return err
+}
+
+// ConsumeAuthorizationCode marks the code as used and returns it. A code can
+// only be consumed once, later calls get sql.ErrNoRows.
+func (r *Repository) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*AuthorizationCode, error) {
+	code := &AuthorizationCode{}
+	query := `
+	UPDATE
+		authorization_code
+	SET
+		consumed_at = now(),
+		updated_at = now()
+	WHERE
+		code_hash = $1 AND consumed_at IS NULL
+	RETURNING
+		code_hash, client_id, user_id, redirect_uri, scope, nonce,
+		code_challenge, code_challenge_method, auth_time, expires_at`
+
+	err := r.Db.QueryRowContext(ctx, query, codeHash).Scan(&code.CodeHash, &code.ClientID, &code.UserID,
+		&code.RedirectURI, &code.Scope, &code.Nonce, &code.CodeChallenge, &code.CodeChallengeMethod,
+		&code.AuthTime, &code.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return code, err
+}
+
+// StoreOneTimeCode stores a new code, replacing the pending codes of the
+// same user and purpose so only the latest code sent can be used. The new
+// code starts with no attempts, guessing is held back by the rate limits of
+// the requests sending and confirming codes instead, so wrong guesses by
+// someone else can't keep the user from getting a code that works.
+func (r *Repository) StoreOneTimeCode(ctx context.Context, data *OneTimeCode) error {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	DELETE FROM one_time_code WHERE user_id = $1 AND purpose = $2 AND consumed_at IS NULL;
+	`
+	_, err = tx.ExecContext(ctx, query, data.UserID, data.Purpose)
+	if err != nil {
+		return err
+	}
+
+	query = `
+	INSERT INTO one_time_code (id, user_id, purpose, code_hash, expires_at)
+	VALUES ($1, $2, $3, $4, $5);
+	`
+	_, err = tx.ExecContext(ctx, query, data.ID, data.UserID, data.Purpose, data.CodeHash, data.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConsumeOneTimeCode marks the pending code of a user and purpose as used if
+// codeHash matches. A mismatch counts as an attempt, the code can no longer
+// be used after maxAttempts. It returns sql.ErrNoRows when no code is pending
+// and ErrOneTimeCodeInvalid for any other failure.
+func (r *Repository) ConsumeOneTimeCode(ctx context.Context, userID, purpose, codeHash string, maxAttempts int) (*OneTimeCode, error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	code := &OneTimeCode{}
+	query := `
+	SELECT
+		id, user_id, purpose, code_hash, attempts, expires_at
+	FROM
+		one_time_code
+	WHERE
+		user_id = $1 AND purpose = $2 AND consumed_at IS NULL
+	ORDER BY
+		created_at DESC
+	LIMIT 1
+	FOR UPDATE`
+
+	err = tx.QueryRowContext(ctx, query, userID, purpose).Scan(&code.ID, &code.UserID, &code.Purpose,
+		&code.CodeHash, &code.Attempts, &code.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if code.Attempts >= maxAttempts || time.Now().After(code.ExpiresAt) {
+		return nil, ErrOneTimeCodeInvalid
+	}
+
+	if subtle.ConstantTimeCompare([]byte(code.CodeHash), []byte(codeHash)) != 1 {
+		query = `
+		UPDATE one_time_code SET attempts = attempts + 1, updated_at = now() WHERE id = $1;
+		`
+		_, err = tx.ExecContext(ctx, query, code.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, ErrOneTimeCodeInvalid
+	}
+
+	now := time.Now()
+	query = `
+	UPDATE one_time_code SET consumed_at = $2, updated_at = now() WHERE id = $1;
+	`
+	_, err = tx.ExecContext(ctx, query, code.ID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	code.ConsumedAt = &now
+	return code, tx.Commit()
+}
+
+// StoreTOTPCredential enrolls a new secret for the user, replacing an
+// unconfirmed one. A confirmed credential is never replaced.
+func (r *Repository) StoreTOTPCredential(ctx context.Context, data *TOTPCredential) error {
+	query := `
+	INSERT INTO totp_credential (user_id, secret_encrypted, created_by, updated_by)
+	VALUES ($1, $2, $1, $1)
+	ON CONFLICT (user_id) DO UPDATE SET
+		secret_encrypted = EXCLUDED.secret_encrypted,
+		last_used_step = 0,
+		updated_at = now(),
+		updated_by = EXCLUDED.updated_by
+	WHERE
+		totp_credential.confirmed_at IS NULL;
+	`
+	result, err := r.Db.ExecContext(ctx, query, data.UserID, data.SecretEncrypted)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected < 1 {
+		return ErrTOTPAlreadyConfirmed
+	}
+
+	return nil
+}
+
+func (r *Repository) GetTOTPCredential(ctx context.Context, userID string) (*TOTPCredential, error) {
+	credential := &TOTPCredential{}
+	query := `
+	SELECT
+		user_id, secret_encrypted, confirmed_at, last_used_step
+	FROM
+		totp_credential
+	WHERE
+		user_id = $1`
+
+	err := r.Db.QueryRowContext(ctx, query, userID).Scan(&credential.UserID, &credential.SecretEncrypted,
+		&credential.ConfirmedAt, &credential.LastUsedStep)
+	if err != nil {
+		return nil, err
+	}
+
+	return credential, nil
+}
+
+// ConfirmTOTPCredential activates the pending credential of the user with
+// the step of its first valid code. It reports false when there is nothing
+// to confirm.
+func (r *Repository) ConfirmTOTPCredential(ctx context.Context, userID string, step int64) (bool, error) {
+	query := `
+	UPDATE
+		totp_credential
+	SET
+		confirmed_at = now(),
+		last_used_step = $2,
+		updated_at = now(),
+		updated_by = $1
+	WHERE
+		user_id = $1 AND confirmed_at IS NULL
+	`
+
+	result, err := r.Db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// UseTOTPStep records step as used. It reports false when a code of the
+// same or a later step was accepted already, so every code works once.
+func (r *Repository) UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error) {
+	query := `
+	UPDATE
+		totp_credential
+	SET
+		last_used_step = $2,
+		updated_at = now()
+	WHERE
+		user_id = $1 AND confirmed_at IS NOT NULL AND last_used_step < $2
+	`
+
+	result, err := r.Db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+func (r *Repository) StoreWebAuthnCredential(ctx context.Context, data *WebAuthnCredential) error {
+	query := `
+	INSERT INTO webauthn_credential (id, user_id, "name", public_key, sign_count, aaguid, attestation_format,
+		created_by, updated_by)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $2, $2);
+	`
+	_, err := r.Db.ExecContext(ctx, query, data.ID, data.UserID, data.Name, data.PublicKey, data.SignCount,
+		data.AAGUID, data.AttestationFormat)
+	return err
+}
+
+const webAuthnCredentialColumns = `id, user_id, "name", public_key, sign_count, aaguid, attestation_format, last_used_at`
+
+func scanWebAuthnCredential(row interface{ Scan(...interface{}) error }) (*WebAuthnCredential, error) {
+	credential := &WebAuthnCredential{}
+	err := row.Scan(&credential.ID, &credential.UserID, &credential.Name, &credential.PublicKey,
+		&credential.SignCount, &credential.AAGUID, &credential.AttestationFormat, &credential.LastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return credential, nil
+}
+
+func (r *Repository) GetWebAuthnCredential(ctx context.Context, id string) (*WebAuthnCredential, error) {
+	query := `
+	SELECT
+		` + webAuthnCredentialColumns + `
+	FROM
+		webauthn_credential
+	WHERE
+		id = $1`
+
+	return scanWebAuthnCredential(r.Db.QueryRowContext(ctx, query, id))
+}
+
+func (r *Repository) ListWebAuthnCredentials(ctx context.Context, userID string) ([]*WebAuthnCredential, error) {
+	query := `
+	SELECT
+		` + webAuthnCredentialColumns + `
+	FROM
+		webauthn_credential
+	WHERE
+		user_id = $1
+	ORDER BY
+		created_at`
+
+	rows, err := r.Db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credentials := []*WebAuthnCredential{}
+	for rows.Next() {
+		credential, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, credential)
+	}
+
+	return credentials, rows.Err()
+}
+
+func (r *Repository) UpdateWebAuthnSignCount(ctx context.Context, id string, signCount uint32) error {
+	query := `
+	UPDATE
+		webauthn_credential
+	SET
+		sign_count = $2,
+		last_used_at = now(),
+		updated_at = now()
+	WHERE
+		id = $1
+	`
+
+	_, err := r.Db.ExecContext(ctx, query, id, signCount)
+	return err
+}
+
+// ReplaceRecoveryCodes stores a new set of recovery codes for the user, the
+// previous codes stop working whether they were used or not.
+func (r *Repository) ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	DELETE FROM recovery_code WHERE user_id = $1;
+	`
+	_, err = tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	query = `
+	INSERT INTO recovery_code (id, user_id, code_hash, created_by, updated_by)
+	VALUES ($1, $2, $3, $2, $2);
+	`
+	for _, codeHash := range codeHashes {
+		_, err = tx.ExecContext(ctx, query, uuid.New().String(), userID, codeHash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks the matching unused recovery code of the user as
+// used. It reports false when there is none.
+func (r *Repository) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	query := `
+	UPDATE
+		recovery_code
+	SET
+		used_at = now(),
+		updated_at = now()
+	WHERE
+		user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+
+	result, err := r.Db.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+func (r *Repository) StoreAuditEvent(ctx context.Context, data *AuditEvent) error {
+	query := `
+	INSERT INTO audit_event (id, user_id, "action", detail, ip_address, user_agent)
+	VALUES ($1, $2, $3, $4, $5, $6);
+	`
+	_, err := r.Db.ExecContext(ctx, query, data.ID, data.UserID, data.Action, data.Detail,
+		data.IPAddress, data.UserAgent)
+	return err
+}
+
+func (r *Repository) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	query := `
+	INSERT INTO revoked_token (id, expires_at) VALUES ($1, $2)
+	ON CONFLICT (id) DO NOTHING;
+	`
+	_, err := r.Db.ExecContext(ctx, query, tokenID, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	// expired tokens are rejected anyway, no need to remember them
+	query = `DELETE FROM revoked_token WHERE expires_at < now();`
+	_, err = r.Db.ExecContext(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return err
+}
+
+func (r *Repository) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	var revoked bool
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM revoked_token WHERE id = $1
+	)`
+
+	err := r.Db.QueryRowContext(ctx, query, tokenID).Scan(&revoked)
+	if err != nil {
+		return false, err
+	}
+
+	return revoked, err
+}
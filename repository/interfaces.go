@@ -6,12 +6,59 @@ package repository
 
 import (
 	"context"
+	"time"
 )
 
 type RepositoryInterface interface {
 	StoreRegistration(ctx context.Context, data *User) error
 	GetUser(ctx context.Context, phoneNumber string) (*User, error)
 	GetUserByID(ctx context.Context, userID string) (*User, error)
-	UpdateLogin(ctx context.Context, userID string) error
+	RecordLoginSuccess(ctx context.Context, data *LoginEvent) error
+	GetLoginAttempts(ctx context.Context, userID string) (*LoginAttempts, error)
+	RecordLoginFailure(ctx context.Context, data *LoginEvent, backoff func(failures int) time.Duration) error
+	StoreLoginEvent(ctx context.Context, data *LoginEvent) error
+	GetUnknownLoginAttempts(ctx context.Context, phoneNumber string) (*LoginAttempts, error)
+	RecordUnknownLoginFailure(ctx context.Context, phoneNumber string, backoff func(failures int) time.Duration) error
+	ListLoginEvents(ctx context.Context, userID string, after *LoginEventCursor, limit int) ([]*LoginEvent, error)
+	ListLoginFingerprints(ctx context.Context, userID string, limit int) ([]*LoginFingerprint, error)
+	UnlockUser(ctx context.Context, userID, updatedBy string) error
 	UpdateProfile(ctx context.Context, data *User) error
+	UpdatePassword(ctx context.Context, userID, hashedPassword, updatedBy string) error
+	DeleteUser(ctx context.Context, userID string, purgeAt time.Time) error
+	UpdateUserStatus(ctx context.Context, userID string, from []string, status, updatedBy string) error
+	PurgeDeletedUsers(ctx context.Context, now time.Time) (int, error)
+	ExportUser(ctx context.Context, userID string) (*UserExport, error)
+	VerifyPhoneNumber(ctx context.Context, userID string) error
+	StoreRefreshToken(ctx context.Context, data *RefreshToken) error
+	GetRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, oldID string, data *RefreshToken) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+	RevokeOtherRefreshTokenFamilies(ctx context.Context, userID, keepFamilyID string) ([]string, error)
+	StoreSession(ctx context.Context, data *Session) error
+	GetSession(ctx context.Context, id string) (*Session, error)
+	ListSessions(ctx context.Context, userID string) ([]*Session, error)
+	TouchSession(ctx context.Context, id string) error
+	GetClient(ctx context.Context, clientID string) (*Client, error)
+	StoreAuthorizationCode(ctx context.Context, data *AuthorizationCode) error
+	ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*AuthorizationCode, error)
+	StoreOneTimeCode(ctx context.Context, data *OneTimeCode) error
+	ConsumeOneTimeCode(ctx context.Context, userID, purpose, codeHash string, maxAttempts int) (*OneTimeCode, error)
+	StoreTOTPCredential(ctx context.Context, data *TOTPCredential) error
+	GetTOTPCredential(ctx context.Context, userID string) (*TOTPCredential, error)
+	ConfirmTOTPCredential(ctx context.Context, userID string, step int64) (bool, error)
+	UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error)
+	StoreWebAuthnCredential(ctx context.Context, data *WebAuthnCredential) error
+	GetWebAuthnCredential(ctx context.Context, id string) (*WebAuthnCredential, error)
+	ListWebAuthnCredentials(ctx context.Context, userID string) ([]*WebAuthnCredential, error)
+	UpdateWebAuthnSignCount(ctx context.Context, id string, signCount uint32) error
+	ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error)
+	StoreAuditEvent(ctx context.Context, data *AuditEvent) error
+}
+
+// TokenRevocationInterface keeps the ids (jti) of access tokens that were
+// revoked before they expired.
+type TokenRevocationInterface interface {
+	RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, tokenID string) (bool, error)
 }
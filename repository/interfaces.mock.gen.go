@@ -7,6 +7,7 @@ package repository
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -34,6 +35,170 @@ func (m *MockRepositoryInterface) EXPECT() *MockRepositoryInterfaceMockRecorder
 	return m.recorder
 }
 
+// ConfirmTOTPCredential mocks base method.
+func (m *MockRepositoryInterface) ConfirmTOTPCredential(ctx context.Context, userID string, step int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConfirmTOTPCredential", ctx, userID, step)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConfirmTOTPCredential indicates an expected call of ConfirmTOTPCredential.
+func (mr *MockRepositoryInterfaceMockRecorder) ConfirmTOTPCredential(ctx, userID, step interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmTOTPCredential", reflect.TypeOf((*MockRepositoryInterface)(nil).ConfirmTOTPCredential), ctx, userID, step)
+}
+
+// ConsumeAuthorizationCode mocks base method.
+func (m *MockRepositoryInterface) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*AuthorizationCode, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeAuthorizationCode", ctx, codeHash)
+	ret0, _ := ret[0].(*AuthorizationCode)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConsumeAuthorizationCode indicates an expected call of ConsumeAuthorizationCode.
+func (mr *MockRepositoryInterfaceMockRecorder) ConsumeAuthorizationCode(ctx, codeHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeAuthorizationCode", reflect.TypeOf((*MockRepositoryInterface)(nil).ConsumeAuthorizationCode), ctx, codeHash)
+}
+
+// ConsumeOneTimeCode mocks base method.
+func (m *MockRepositoryInterface) ConsumeOneTimeCode(ctx context.Context, userID, purpose, codeHash string, maxAttempts int) (*OneTimeCode, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeOneTimeCode", ctx, userID, purpose, codeHash, maxAttempts)
+	ret0, _ := ret[0].(*OneTimeCode)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConsumeOneTimeCode indicates an expected call of ConsumeOneTimeCode.
+func (mr *MockRepositoryInterfaceMockRecorder) ConsumeOneTimeCode(ctx, userID, purpose, codeHash, maxAttempts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeOneTimeCode", reflect.TypeOf((*MockRepositoryInterface)(nil).ConsumeOneTimeCode), ctx, userID, purpose, codeHash, maxAttempts)
+}
+
+// DeleteUser mocks base method.
+func (m *MockRepositoryInterface) DeleteUser(ctx context.Context, userID string, purgeAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUser", ctx, userID, purgeAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUser indicates an expected call of DeleteUser.
+func (mr *MockRepositoryInterfaceMockRecorder) DeleteUser(ctx, userID, purgeAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockRepositoryInterface)(nil).DeleteUser), ctx, userID, purgeAt)
+}
+
+// ExportUser mocks base method.
+func (m *MockRepositoryInterface) ExportUser(ctx context.Context, userID string) (*UserExport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportUser", ctx, userID)
+	ret0, _ := ret[0].(*UserExport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExportUser indicates an expected call of ExportUser.
+func (mr *MockRepositoryInterfaceMockRecorder) ExportUser(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportUser", reflect.TypeOf((*MockRepositoryInterface)(nil).ExportUser), ctx, userID)
+}
+
+// GetClient mocks base method.
+func (m *MockRepositoryInterface) GetClient(ctx context.Context, clientID string) (*Client, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetClient", ctx, clientID)
+	ret0, _ := ret[0].(*Client)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetClient indicates an expected call of GetClient.
+func (mr *MockRepositoryInterfaceMockRecorder) GetClient(ctx, clientID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetClient", reflect.TypeOf((*MockRepositoryInterface)(nil).GetClient), ctx, clientID)
+}
+
+// GetLoginAttempts mocks base method.
+func (m *MockRepositoryInterface) GetLoginAttempts(ctx context.Context, userID string) (*LoginAttempts, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLoginAttempts", ctx, userID)
+	ret0, _ := ret[0].(*LoginAttempts)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLoginAttempts indicates an expected call of GetLoginAttempts.
+func (mr *MockRepositoryInterfaceMockRecorder) GetLoginAttempts(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLoginAttempts", reflect.TypeOf((*MockRepositoryInterface)(nil).GetLoginAttempts), ctx, userID)
+}
+
+// GetRefreshToken mocks base method.
+func (m *MockRepositoryInterface) GetRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRefreshToken", ctx, tokenHash)
+	ret0, _ := ret[0].(*RefreshToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRefreshToken indicates an expected call of GetRefreshToken.
+func (mr *MockRepositoryInterfaceMockRecorder) GetRefreshToken(ctx, tokenHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRefreshToken", reflect.TypeOf((*MockRepositoryInterface)(nil).GetRefreshToken), ctx, tokenHash)
+}
+
+// GetSession mocks base method.
+func (m *MockRepositoryInterface) GetSession(ctx context.Context, id string) (*Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSession", ctx, id)
+	ret0, _ := ret[0].(*Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSession indicates an expected call of GetSession.
+func (mr *MockRepositoryInterfaceMockRecorder) GetSession(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSession", reflect.TypeOf((*MockRepositoryInterface)(nil).GetSession), ctx, id)
+}
+
+// GetTOTPCredential mocks base method.
+func (m *MockRepositoryInterface) GetTOTPCredential(ctx context.Context, userID string) (*TOTPCredential, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTOTPCredential", ctx, userID)
+	ret0, _ := ret[0].(*TOTPCredential)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTOTPCredential indicates an expected call of GetTOTPCredential.
+func (mr *MockRepositoryInterfaceMockRecorder) GetTOTPCredential(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTOTPCredential", reflect.TypeOf((*MockRepositoryInterface)(nil).GetTOTPCredential), ctx, userID)
+}
+
+// GetUnknownLoginAttempts mocks base method.
+func (m *MockRepositoryInterface) GetUnknownLoginAttempts(ctx context.Context, phoneNumber string) (*LoginAttempts, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUnknownLoginAttempts", ctx, phoneNumber)
+	ret0, _ := ret[0].(*LoginAttempts)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUnknownLoginAttempts indicates an expected call of GetUnknownLoginAttempts.
+func (mr *MockRepositoryInterfaceMockRecorder) GetUnknownLoginAttempts(ctx, phoneNumber interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUnknownLoginAttempts", reflect.TypeOf((*MockRepositoryInterface)(nil).GetUnknownLoginAttempts), ctx, phoneNumber)
+}
+
 // GetUser mocks base method.
 func (m *MockRepositoryInterface) GetUser(ctx context.Context, phoneNumber string) (*User, error) {
 	m.ctrl.T.Helper()
@@ -64,6 +229,265 @@ func (mr *MockRepositoryInterfaceMockRecorder) GetUserByID(ctx, userID interface
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByID", reflect.TypeOf((*MockRepositoryInterface)(nil).GetUserByID), ctx, userID)
 }
 
+// GetWebAuthnCredential mocks base method.
+func (m *MockRepositoryInterface) GetWebAuthnCredential(ctx context.Context, id string) (*WebAuthnCredential, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWebAuthnCredential", ctx, id)
+	ret0, _ := ret[0].(*WebAuthnCredential)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWebAuthnCredential indicates an expected call of GetWebAuthnCredential.
+func (mr *MockRepositoryInterfaceMockRecorder) GetWebAuthnCredential(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWebAuthnCredential", reflect.TypeOf((*MockRepositoryInterface)(nil).GetWebAuthnCredential), ctx, id)
+}
+
+// ListLoginEvents mocks base method.
+func (m *MockRepositoryInterface) ListLoginEvents(ctx context.Context, userID string, after *LoginEventCursor, limit int) ([]*LoginEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListLoginEvents", ctx, userID, after, limit)
+	ret0, _ := ret[0].([]*LoginEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListLoginEvents indicates an expected call of ListLoginEvents.
+func (mr *MockRepositoryInterfaceMockRecorder) ListLoginEvents(ctx, userID, after, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListLoginEvents", reflect.TypeOf((*MockRepositoryInterface)(nil).ListLoginEvents), ctx, userID, after, limit)
+}
+
+// ListLoginFingerprints mocks base method.
+func (m *MockRepositoryInterface) ListLoginFingerprints(ctx context.Context, userID string, limit int) ([]*LoginFingerprint, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListLoginFingerprints", ctx, userID, limit)
+	ret0, _ := ret[0].([]*LoginFingerprint)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListLoginFingerprints indicates an expected call of ListLoginFingerprints.
+func (mr *MockRepositoryInterfaceMockRecorder) ListLoginFingerprints(ctx, userID, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListLoginFingerprints", reflect.TypeOf((*MockRepositoryInterface)(nil).ListLoginFingerprints), ctx, userID, limit)
+}
+
+// ListSessions mocks base method.
+func (m *MockRepositoryInterface) ListSessions(ctx context.Context, userID string) ([]*Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListSessions", ctx, userID)
+	ret0, _ := ret[0].([]*Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListSessions indicates an expected call of ListSessions.
+func (mr *MockRepositoryInterfaceMockRecorder) ListSessions(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListSessions", reflect.TypeOf((*MockRepositoryInterface)(nil).ListSessions), ctx, userID)
+}
+
+// ListWebAuthnCredentials mocks base method.
+func (m *MockRepositoryInterface) ListWebAuthnCredentials(ctx context.Context, userID string) ([]*WebAuthnCredential, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListWebAuthnCredentials", ctx, userID)
+	ret0, _ := ret[0].([]*WebAuthnCredential)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListWebAuthnCredentials indicates an expected call of ListWebAuthnCredentials.
+func (mr *MockRepositoryInterfaceMockRecorder) ListWebAuthnCredentials(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListWebAuthnCredentials", reflect.TypeOf((*MockRepositoryInterface)(nil).ListWebAuthnCredentials), ctx, userID)
+}
+
+// PurgeDeletedUsers mocks base method.
+func (m *MockRepositoryInterface) PurgeDeletedUsers(ctx context.Context, now time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeDeletedUsers", ctx, now)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeDeletedUsers indicates an expected call of PurgeDeletedUsers.
+func (mr *MockRepositoryInterfaceMockRecorder) PurgeDeletedUsers(ctx, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeDeletedUsers", reflect.TypeOf((*MockRepositoryInterface)(nil).PurgeDeletedUsers), ctx, now)
+}
+
+// RecordLoginFailure mocks base method.
+func (m *MockRepositoryInterface) RecordLoginFailure(ctx context.Context, data *LoginEvent, backoff func(int) time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordLoginFailure", ctx, data, backoff)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RecordLoginFailure indicates an expected call of RecordLoginFailure.
+func (mr *MockRepositoryInterfaceMockRecorder) RecordLoginFailure(ctx, data, backoff interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordLoginFailure", reflect.TypeOf((*MockRepositoryInterface)(nil).RecordLoginFailure), ctx, data, backoff)
+}
+
+// RecordLoginSuccess mocks base method.
+func (m *MockRepositoryInterface) RecordLoginSuccess(ctx context.Context, data *LoginEvent) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordLoginSuccess", ctx, data)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RecordLoginSuccess indicates an expected call of RecordLoginSuccess.
+func (mr *MockRepositoryInterfaceMockRecorder) RecordLoginSuccess(ctx, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordLoginSuccess", reflect.TypeOf((*MockRepositoryInterface)(nil).RecordLoginSuccess), ctx, data)
+}
+
+// RecordUnknownLoginFailure mocks base method.
+func (m *MockRepositoryInterface) RecordUnknownLoginFailure(ctx context.Context, phoneNumber string, backoff func(int) time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordUnknownLoginFailure", ctx, phoneNumber, backoff)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RecordUnknownLoginFailure indicates an expected call of RecordUnknownLoginFailure.
+func (mr *MockRepositoryInterfaceMockRecorder) RecordUnknownLoginFailure(ctx, phoneNumber, backoff interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordUnknownLoginFailure", reflect.TypeOf((*MockRepositoryInterface)(nil).RecordUnknownLoginFailure), ctx, phoneNumber, backoff)
+}
+
+// ReplaceRecoveryCodes mocks base method.
+func (m *MockRepositoryInterface) ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplaceRecoveryCodes", ctx, userID, codeHashes)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplaceRecoveryCodes indicates an expected call of ReplaceRecoveryCodes.
+func (mr *MockRepositoryInterfaceMockRecorder) ReplaceRecoveryCodes(ctx, userID, codeHashes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplaceRecoveryCodes", reflect.TypeOf((*MockRepositoryInterface)(nil).ReplaceRecoveryCodes), ctx, userID, codeHashes)
+}
+
+// RevokeOtherRefreshTokenFamilies mocks base method.
+func (m *MockRepositoryInterface) RevokeOtherRefreshTokenFamilies(ctx context.Context, userID, keepFamilyID string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeOtherRefreshTokenFamilies", ctx, userID, keepFamilyID)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RevokeOtherRefreshTokenFamilies indicates an expected call of RevokeOtherRefreshTokenFamilies.
+func (mr *MockRepositoryInterfaceMockRecorder) RevokeOtherRefreshTokenFamilies(ctx, userID, keepFamilyID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeOtherRefreshTokenFamilies", reflect.TypeOf((*MockRepositoryInterface)(nil).RevokeOtherRefreshTokenFamilies), ctx, userID, keepFamilyID)
+}
+
+// RevokeRefreshTokenFamily mocks base method.
+func (m *MockRepositoryInterface) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeRefreshTokenFamily", ctx, familyID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeRefreshTokenFamily indicates an expected call of RevokeRefreshTokenFamily.
+func (mr *MockRepositoryInterfaceMockRecorder) RevokeRefreshTokenFamily(ctx, familyID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeRefreshTokenFamily", reflect.TypeOf((*MockRepositoryInterface)(nil).RevokeRefreshTokenFamily), ctx, familyID)
+}
+
+// RotateRefreshToken mocks base method.
+func (m *MockRepositoryInterface) RotateRefreshToken(ctx context.Context, oldID string, data *RefreshToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateRefreshToken", ctx, oldID, data)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RotateRefreshToken indicates an expected call of RotateRefreshToken.
+func (mr *MockRepositoryInterfaceMockRecorder) RotateRefreshToken(ctx, oldID, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateRefreshToken", reflect.TypeOf((*MockRepositoryInterface)(nil).RotateRefreshToken), ctx, oldID, data)
+}
+
+// StoreAuditEvent mocks base method.
+func (m *MockRepositoryInterface) StoreAuditEvent(ctx context.Context, data *AuditEvent) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StoreAuditEvent", ctx, data)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StoreAuditEvent indicates an expected call of StoreAuditEvent.
+func (mr *MockRepositoryInterfaceMockRecorder) StoreAuditEvent(ctx, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StoreAuditEvent", reflect.TypeOf((*MockRepositoryInterface)(nil).StoreAuditEvent), ctx, data)
+}
+
+// StoreAuthorizationCode mocks base method.
+func (m *MockRepositoryInterface) StoreAuthorizationCode(ctx context.Context, data *AuthorizationCode) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StoreAuthorizationCode", ctx, data)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StoreAuthorizationCode indicates an expected call of StoreAuthorizationCode.
+func (mr *MockRepositoryInterfaceMockRecorder) StoreAuthorizationCode(ctx, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StoreAuthorizationCode", reflect.TypeOf((*MockRepositoryInterface)(nil).StoreAuthorizationCode), ctx, data)
+}
+
+// StoreLoginEvent mocks base method.
+func (m *MockRepositoryInterface) StoreLoginEvent(ctx context.Context, data *LoginEvent) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StoreLoginEvent", ctx, data)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StoreLoginEvent indicates an expected call of StoreLoginEvent.
+func (mr *MockRepositoryInterfaceMockRecorder) StoreLoginEvent(ctx, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StoreLoginEvent", reflect.TypeOf((*MockRepositoryInterface)(nil).StoreLoginEvent), ctx, data)
+}
+
+// StoreOneTimeCode mocks base method.
+func (m *MockRepositoryInterface) StoreOneTimeCode(ctx context.Context, data *OneTimeCode) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StoreOneTimeCode", ctx, data)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StoreOneTimeCode indicates an expected call of StoreOneTimeCode.
+func (mr *MockRepositoryInterfaceMockRecorder) StoreOneTimeCode(ctx, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StoreOneTimeCode", reflect.TypeOf((*MockRepositoryInterface)(nil).StoreOneTimeCode), ctx, data)
+}
+
+// StoreRefreshToken mocks base method.
+func (m *MockRepositoryInterface) StoreRefreshToken(ctx context.Context, data *RefreshToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StoreRefreshToken", ctx, data)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StoreRefreshToken indicates an expected call of StoreRefreshToken.
+func (mr *MockRepositoryInterfaceMockRecorder) StoreRefreshToken(ctx, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StoreRefreshToken", reflect.TypeOf((*MockRepositoryInterface)(nil).StoreRefreshToken), ctx, data)
+}
+
 // StoreRegistration mocks base method.
 func (m *MockRepositoryInterface) StoreRegistration(ctx context.Context, data *User) error {
 	m.ctrl.T.Helper()
@@ -78,18 +502,88 @@ func (mr *MockRepositoryInterfaceMockRecorder) StoreRegistration(ctx, data inter
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StoreRegistration", reflect.TypeOf((*MockRepositoryInterface)(nil).StoreRegistration), ctx, data)
 }
 
-// UpdateLogin mocks base method.
-func (m *MockRepositoryInterface) UpdateLogin(ctx context.Context, userID string) error {
+// StoreSession mocks base method.
+func (m *MockRepositoryInterface) StoreSession(ctx context.Context, data *Session) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StoreSession", ctx, data)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StoreSession indicates an expected call of StoreSession.
+func (mr *MockRepositoryInterfaceMockRecorder) StoreSession(ctx, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StoreSession", reflect.TypeOf((*MockRepositoryInterface)(nil).StoreSession), ctx, data)
+}
+
+// StoreTOTPCredential mocks base method.
+func (m *MockRepositoryInterface) StoreTOTPCredential(ctx context.Context, data *TOTPCredential) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StoreTOTPCredential", ctx, data)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StoreTOTPCredential indicates an expected call of StoreTOTPCredential.
+func (mr *MockRepositoryInterfaceMockRecorder) StoreTOTPCredential(ctx, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StoreTOTPCredential", reflect.TypeOf((*MockRepositoryInterface)(nil).StoreTOTPCredential), ctx, data)
+}
+
+// StoreWebAuthnCredential mocks base method.
+func (m *MockRepositoryInterface) StoreWebAuthnCredential(ctx context.Context, data *WebAuthnCredential) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StoreWebAuthnCredential", ctx, data)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StoreWebAuthnCredential indicates an expected call of StoreWebAuthnCredential.
+func (mr *MockRepositoryInterfaceMockRecorder) StoreWebAuthnCredential(ctx, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StoreWebAuthnCredential", reflect.TypeOf((*MockRepositoryInterface)(nil).StoreWebAuthnCredential), ctx, data)
+}
+
+// TouchSession mocks base method.
+func (m *MockRepositoryInterface) TouchSession(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchSession", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TouchSession indicates an expected call of TouchSession.
+func (mr *MockRepositoryInterfaceMockRecorder) TouchSession(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchSession", reflect.TypeOf((*MockRepositoryInterface)(nil).TouchSession), ctx, id)
+}
+
+// UnlockUser mocks base method.
+func (m *MockRepositoryInterface) UnlockUser(ctx context.Context, userID, updatedBy string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UnlockUser", ctx, userID, updatedBy)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UnlockUser indicates an expected call of UnlockUser.
+func (mr *MockRepositoryInterfaceMockRecorder) UnlockUser(ctx, userID, updatedBy interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnlockUser", reflect.TypeOf((*MockRepositoryInterface)(nil).UnlockUser), ctx, userID, updatedBy)
+}
+
+// UpdatePassword mocks base method.
+func (m *MockRepositoryInterface) UpdatePassword(ctx context.Context, userID, hashedPassword, updatedBy string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateLogin", ctx, userID)
+	ret := m.ctrl.Call(m, "UpdatePassword", ctx, userID, hashedPassword, updatedBy)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// UpdateLogin indicates an expected call of UpdateLogin.
-func (mr *MockRepositoryInterfaceMockRecorder) UpdateLogin(ctx, userID interface{}) *gomock.Call {
+// UpdatePassword indicates an expected call of UpdatePassword.
+func (mr *MockRepositoryInterfaceMockRecorder) UpdatePassword(ctx, userID, hashedPassword, updatedBy interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateLogin", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdateLogin), ctx, userID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePassword", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdatePassword), ctx, userID, hashedPassword, updatedBy)
 }
 
 // UpdateProfile mocks base method.
@@ -105,3 +599,127 @@ func (mr *MockRepositoryInterfaceMockRecorder) UpdateProfile(ctx, data interface
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProfile", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdateProfile), ctx, data)
 }
+
+// UpdateUserStatus mocks base method.
+func (m *MockRepositoryInterface) UpdateUserStatus(ctx context.Context, userID string, from []string, status, updatedBy string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUserStatus", ctx, userID, from, status, updatedBy)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateUserStatus indicates an expected call of UpdateUserStatus.
+func (mr *MockRepositoryInterfaceMockRecorder) UpdateUserStatus(ctx, userID, from, status, updatedBy interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserStatus", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdateUserStatus), ctx, userID, from, status, updatedBy)
+}
+
+// UpdateWebAuthnSignCount mocks base method.
+func (m *MockRepositoryInterface) UpdateWebAuthnSignCount(ctx context.Context, id string, signCount uint32) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateWebAuthnSignCount", ctx, id, signCount)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateWebAuthnSignCount indicates an expected call of UpdateWebAuthnSignCount.
+func (mr *MockRepositoryInterfaceMockRecorder) UpdateWebAuthnSignCount(ctx, id, signCount interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateWebAuthnSignCount", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdateWebAuthnSignCount), ctx, id, signCount)
+}
+
+// UseRecoveryCode mocks base method.
+func (m *MockRepositoryInterface) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", ctx, userID, codeHash)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode.
+func (mr *MockRepositoryInterfaceMockRecorder) UseRecoveryCode(ctx, userID, codeHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockRepositoryInterface)(nil).UseRecoveryCode), ctx, userID, codeHash)
+}
+
+// UseTOTPStep mocks base method.
+func (m *MockRepositoryInterface) UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseTOTPStep", ctx, userID, step)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseTOTPStep indicates an expected call of UseTOTPStep.
+func (mr *MockRepositoryInterfaceMockRecorder) UseTOTPStep(ctx, userID, step interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseTOTPStep", reflect.TypeOf((*MockRepositoryInterface)(nil).UseTOTPStep), ctx, userID, step)
+}
+
+// VerifyPhoneNumber mocks base method.
+func (m *MockRepositoryInterface) VerifyPhoneNumber(ctx context.Context, userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyPhoneNumber", ctx, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// VerifyPhoneNumber indicates an expected call of VerifyPhoneNumber.
+func (mr *MockRepositoryInterfaceMockRecorder) VerifyPhoneNumber(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyPhoneNumber", reflect.TypeOf((*MockRepositoryInterface)(nil).VerifyPhoneNumber), ctx, userID)
+}
+
+// MockTokenRevocationInterface is a mock of TokenRevocationInterface interface.
+type MockTokenRevocationInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockTokenRevocationInterfaceMockRecorder
+}
+
+// MockTokenRevocationInterfaceMockRecorder is the mock recorder for MockTokenRevocationInterface.
+type MockTokenRevocationInterfaceMockRecorder struct {
+	mock *MockTokenRevocationInterface
+}
+
+// NewMockTokenRevocationInterface creates a new mock instance.
+func NewMockTokenRevocationInterface(ctrl *gomock.Controller) *MockTokenRevocationInterface {
+	mock := &MockTokenRevocationInterface{ctrl: ctrl}
+	mock.recorder = &MockTokenRevocationInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTokenRevocationInterface) EXPECT() *MockTokenRevocationInterfaceMockRecorder {
+	return m.recorder
+}
+
+// IsTokenRevoked mocks base method.
+func (m *MockTokenRevocationInterface) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsTokenRevoked", ctx, tokenID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsTokenRevoked indicates an expected call of IsTokenRevoked.
+func (mr *MockTokenRevocationInterfaceMockRecorder) IsTokenRevoked(ctx, tokenID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsTokenRevoked", reflect.TypeOf((*MockTokenRevocationInterface)(nil).IsTokenRevoked), ctx, tokenID)
+}
+
+// RevokeToken mocks base method.
+func (m *MockTokenRevocationInterface) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeToken", ctx, tokenID, expiresAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeToken indicates an expected call of RevokeToken.
+func (mr *MockTokenRevocationInterfaceMockRecorder) RevokeToken(ctx, tokenID, expiresAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeToken", reflect.TypeOf((*MockTokenRevocationInterface)(nil).RevokeToken), ctx, tokenID, expiresAt)
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryTokenRevocation is an in-memory TokenRevocationInterface, meant for
+// tests and single instance deployments.
+type MemoryTokenRevocation struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+	now     func() time.Time
+}
+
+func NewMemoryTokenRevocation() *MemoryTokenRevocation {
+	return &MemoryTokenRevocation{
+		revoked: map[string]time.Time{},
+		now:     time.Now,
+	}
+}
+
+func (m *MemoryTokenRevocation) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// expired tokens are rejected anyway, no need to remember them
+	now := m.now()
+	for id, exp := range m.revoked {
+		if exp.Before(now) {
+			delete(m.revoked, id)
+		}
+	}
+
+	m.revoked[tokenID] = expiresAt
+	return nil
+}
+
+func (m *MemoryTokenRevocation) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, revoked := m.revoked[tokenID]
+	return revoked, nil
+}
@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryTokenRevocation(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryTokenRevocation()
+
+	_ = store.RevokeToken(ctx, "expired", time.Now().Add(-time.Minute))
+	_ = store.RevokeToken(ctx, "active", time.Now().Add(time.Minute))
+
+	revoked, _ := store.IsTokenRevoked(ctx, "active")
+	assert.True(t, revoked)
+
+	// expired entries are purged on the next revocation
+	revoked, _ = store.IsTokenRevoked(ctx, "expired")
+	assert.False(t, revoked)
+
+	revoked, _ = store.IsTokenRevoked(ctx, "unknown")
+	assert.False(t, revoked)
+}
@@ -1,9 +1,264 @@
 package repository
 
-// User model
+import (
+	"errors"
+	"time"
+)
+
+// ErrRefreshTokenRotated is returned when a refresh token can no longer be
+// rotated because it was already rotated or revoked.
+var ErrRefreshTokenRotated = errors.New("refresh token is already rotated")
+
+// ErrOneTimeCodeInvalid is returned when a one-time code does not match, has
+// expired or has been guessed wrong too many times.
+var ErrOneTimeCodeInvalid = errors.New("one-time code is not valid")
+
+// Statuses of a user account. Only active users may log in. Deactivated
+// users and users pending deletion can reactivate their account themselves,
+// suspended ones only through support.
+const (
+	UserStatusActive          = "active"
+	UserStatusDeactivated     = "deactivated"
+	UserStatusSuspended       = "suspended"
+	UserStatusPendingDeletion = "pending_deletion"
+)
+
+// ErrTOTPAlreadyConfirmed is returned when enrolling an authenticator app
+// while one is already confirmed.
+var ErrTOTPAlreadyConfirmed = errors.New("two-factor authentication is already enabled")
+
+// User model. PhoneVerifiedAt is nil until the user proves owning the
+// phone number with a one-time code.
 type User struct {
-	ID          string `json:"id"`
-	FullName    string `json:"full_name"`
-	PhoneNumber string `json:"phone_number"`
-	Password    string `json:"password"`
+	ID              string     `json:"id"`
+	FullName        string     `json:"full_name"`
+	PhoneNumber     string     `json:"phone_number"`
+	Password        string     `json:"password"`
+	PhoneVerifiedAt *time.Time `json:"phone_verified_at"`
+	Status          string     `json:"status"`
+}
+
+// LoginAttempts of a user. LockedUntil is set after a failed login, no
+// attempt is accepted before it.
+type LoginAttempts struct {
+	FailureCounter int        `json:"failure_counter"`
+	LockedUntil    *time.Time `json:"locked_until"`
+}
+
+// LoginEvent model of one login attempt. SessionID and the fingerprint are
+// set on successful logins, FailureReason on failed ones. Flagged marks a
+// login from an unfamiliar fingerprint.
+type LoginEvent struct {
+	ID            string `json:"id"`
+	UserID        string `json:"user_id"`
+	Success       bool   `json:"success"`
+	Method        string `json:"method"`
+	FailureReason string `json:"failure_reason"`
+	IPAddress     string `json:"ip_address"`
+	UserAgent     string `json:"user_agent"`
+	SessionID     string `json:"session_id"`
+	LoginFingerprint
+	Flagged   bool      `json:"flagged"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LoginFingerprint identifies the network and the kind of device of a login
+// coarsely enough to recognize a returning user.
+type LoginFingerprint struct {
+	IPPrefix        string `json:"ip_prefix"`
+	UserAgentFamily string `json:"user_agent_family"`
+}
+
+// LoginEventCursor points at the last event of a page of login history, the
+// next page starts after it.
+type LoginEventCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// RefreshToken model. Tokens issued from the same login share a FamilyID
+// so the whole chain can be revoked when reuse is detected.
+type RefreshToken struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	FamilyID  string     `json:"family_id"`
+	TokenHash string     `json:"token_hash"`
+	Scope     string     `json:"scope"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RotatedAt *time.Time `json:"rotated_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// Session model of a login on one device. Its ID is the FamilyID of the
+// refresh tokens issued for it, SignedOut is set once none of them is usable
+// any more, because the session was signed out, revoked or expired.
+type Session struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	DeviceLabel string    `json:"device_label"`
+	UserAgent   string    `json:"user_agent"`
+	IPAddress   string    `json:"ip_address"`
+	AuthTime    time.Time `json:"auth_time"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+	SignedOut   bool      `json:"signed_out"`
+}
+
+// Client model of a registered OAuth client. The secret is only kept hashed,
+// Scopes are the ones it may be granted with the client credentials grant.
+type Client struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	SecretHash   string   `json:"secret_hash"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+}
+
+// AuthorizationCode model of the OpenID Connect authorization code flow.
+type AuthorizationCode struct {
+	CodeHash            string    `json:"code_hash"`
+	ClientID            string    `json:"client_id"`
+	UserID              string    `json:"user_id"`
+	RedirectURI         string    `json:"redirect_uri"`
+	Scope               string    `json:"scope"`
+	Nonce               string    `json:"nonce"`
+	CodeChallenge       string    `json:"code_challenge"`
+	CodeChallengeMethod string    `json:"code_challenge_method"`
+	AuthTime            time.Time `json:"auth_time"`
+	ExpiresAt           time.Time `json:"expires_at"`
+}
+
+// OneTimeCode model of a short-lived code sent to the user's phone. Purpose
+// scopes a code to the flow it was issued for, e.g. password_reset.
+type OneTimeCode struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Purpose    string     `json:"purpose"`
+	CodeHash   string     `json:"code_hash"`
+	Attempts   int        `json:"attempts"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	ConsumedAt *time.Time `json:"consumed_at"`
+}
+
+// TOTPCredential model of an authenticator app enrolled by a user. The secret
+// is only kept encrypted, the credential is not used for logins until
+// ConfirmedAt is set. LastUsedStep prevents replaying an accepted code.
+type TOTPCredential struct {
+	UserID          string     `json:"user_id"`
+	SecretEncrypted string     `json:"secret_encrypted"`
+	ConfirmedAt     *time.Time `json:"confirmed_at"`
+	LastUsedStep    int64      `json:"last_used_step"`
+}
+
+// WebAuthnCredential model of a passkey. ID is the base64url credential id,
+// PublicKey its COSE_Key. SignCount is the last counter the authenticator
+// reported, it must grow to detect cloned authenticators.
+type WebAuthnCredential struct {
+	ID                string     `json:"id"`
+	UserID            string     `json:"user_id"`
+	Name              string     `json:"name"`
+	PublicKey         []byte     `json:"public_key"`
+	SignCount         uint32     `json:"sign_count"`
+	AAGUID            string     `json:"aaguid"`
+	AttestationFormat string     `json:"attestation_format"`
+	LastUsedAt        *time.Time `json:"last_used_at"`
+}
+
+// AuditEvent records a security relevant action on an account, e.g. the
+// use of a recovery code. Detail tells apart flows of the same action.
+type AuditEvent struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Action    string    `json:"action"`
+	Detail    string    `json:"detail"`
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserExport is everything stored about a user, the answer to a data access
+// request. Password, code and token hashes and the authenticator app secret
+// are left out, the records holding them are not.
+type UserExport struct {
+	ExportedAt         time.Time                  `json:"exported_at"`
+	Profile            *ProfileExport             `json:"profile"`
+	Login              *LoginExport               `json:"login"`
+	UnknownLogin       *UnknownLoginExport        `json:"unknown_login"`
+	LoginEvents        []*LoginEvent              `json:"login_events"`
+	Sessions           []*Session                 `json:"sessions"`
+	RefreshTokens      []*RefreshTokenExport      `json:"refresh_tokens"`
+	OneTimeCodes       []*OneTimeCodeExport       `json:"one_time_codes"`
+	TOTPCredential     *TOTPCredentialExport      `json:"totp_credential"`
+	Passkeys           []*WebAuthnCredential      `json:"passkeys"`
+	RecoveryCodes      []*RecoveryCodeExport      `json:"recovery_codes"`
+	AuditEvents        []*AuditEvent              `json:"audit_events"`
+	AuthorizationCodes []*AuthorizationCodeExport `json:"authorization_codes"`
+}
+
+type ProfileExport struct {
+	ID              string     `json:"id"`
+	FullName        string     `json:"full_name"`
+	PhoneNumber     string     `json:"phone_number"`
+	PhoneVerifiedAt *time.Time `json:"phone_verified_at"`
+	Status          string     `json:"status"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// LoginExport holds the login counters, nil for users that never logged in.
+type LoginExport struct {
+	SuccessCounter int        `json:"success_counter"`
+	LastLogin      time.Time  `json:"last_login"`
+	FailureCounter int        `json:"failure_counter"`
+	LastFailure    *time.Time `json:"last_failure"`
+	LockedUntil    *time.Time `json:"locked_until"`
+}
+
+// UnknownLoginExport holds the failed logins counted for the phone number of
+// the user while it was not registered, nil if there were none.
+type UnknownLoginExport struct {
+	PhoneNumber    string     `json:"phone_number"`
+	FailureCounter int        `json:"failure_counter"`
+	LastFailure    *time.Time `json:"last_failure"`
+	LockedUntil    *time.Time `json:"locked_until"`
+}
+
+type RefreshTokenExport struct {
+	ID        string     `json:"id"`
+	FamilyID  string     `json:"family_id"`
+	Scope     string     `json:"scope"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RotatedAt *time.Time `json:"rotated_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type OneTimeCodeExport struct {
+	ID         string     `json:"id"`
+	Purpose    string     `json:"purpose"`
+	Attempts   int        `json:"attempts"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	ConsumedAt *time.Time `json:"consumed_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TOTPCredentialExport is nil for users without an authenticator app.
+type TOTPCredentialExport struct {
+	ConfirmedAt *time.Time `json:"confirmed_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type RecoveryCodeExport struct {
+	ID        string     `json:"id"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type AuthorizationCodeExport struct {
+	ClientID    string     `json:"client_id"`
+	RedirectURI string     `json:"redirect_uri"`
+	Scope       string     `json:"scope"`
+	AuthTime    time.Time  `json:"auth_time"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	ConsumedAt  *time.Time `json:"consumed_at"`
 }
@@ -0,0 +1,36 @@
+// This file contains the senders of text messages to users' phones.
+package sms
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// SMSSender delivers a text message to a phone number.
+type SMSSender interface {
+	Send(ctx context.Context, phoneNumber, message string) error
+}
+
+// LogSender writes messages to w instead of delivering them, one line per
+// message. It is meant for local development and tests.
+type LogSender struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewLogSender(w io.Writer) *LogSender {
+	return &LogSender{
+		w: w,
+	}
+}
+
+func (s *LogSender) Send(ctx context.Context, phoneNumber, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := fmt.Fprintf(s.w, "%s sms to=%s message=%q\n", time.Now().UTC().Format(time.RFC3339), phoneNumber, message)
+	return err
+}
@@ -0,0 +1,18 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogSender(t *testing.T) {
+	var buf bytes.Buffer
+	sender := NewLogSender(&buf)
+
+	err := sender.Send(context.Background(), "+622342342322", "Your code is 123456")
+	assert.Nil(t, err, "error should be nil")
+	assert.Regexp(t, `^\S+ sms to=\+622342342322 message="Your code is 123456"\n$`, buf.String())
+}
@@ -0,0 +1,150 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+)
+
+// Attestation statement formats (WebAuthn section 8) that are verified.
+const (
+	AttestationFormatNone   = "none"
+	AttestationFormatPacked = "packed"
+)
+
+var ErrAttestationInvalid = errors.New("webauthn: attestation is not valid")
+
+// oidFIDOGenCeAAGUID is the attestation certificate extension holding the
+// AAGUID of the authenticator model.
+var oidFIDOGenCeAAGUID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+// attestationObject is the CBOR map returned by a registration.
+type attestationObject struct {
+	Format      string
+	Statement   map[interface{}]interface{}
+	AuthData    *AuthenticatorData
+	RawAuthData []byte
+}
+
+func parseAttestationObject(data []byte) (*attestationObject, error) {
+	value, rest, err := decodeCBOR(data)
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := value.(map[interface{}]interface{})
+	if !ok || len(rest) > 0 {
+		return nil, fmt.Errorf("%w: malformed attestation object", ErrAttestationInvalid)
+	}
+
+	format, _ := m["fmt"].(string)
+	statement, _ := m["attStmt"].(map[interface{}]interface{})
+	rawAuthData, _ := m["authData"].([]byte)
+	if format == "" || statement == nil || rawAuthData == nil {
+		return nil, fmt.Errorf("%w: malformed attestation object", ErrAttestationInvalid)
+	}
+
+	authData, err := ParseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &attestationObject{
+		Format:      format,
+		Statement:   statement,
+		AuthData:    authData,
+		RawAuthData: rawAuthData,
+	}, nil
+}
+
+// verify checks the attestation statement over the authenticator data and
+// the client data hash. Packed attestation certificates are checked for
+// their form only, they are not chained to a trusted root since the
+// service accepts any authenticator model.
+func (a *attestationObject) verify(clientDataHash []byte, credentialKey *PublicKey) error {
+	switch a.Format {
+	case AttestationFormatNone:
+		if len(a.Statement) != 0 {
+			return fmt.Errorf("%w: none attestation with a statement", ErrAttestationInvalid)
+		}
+		return nil
+	case AttestationFormatPacked:
+		return a.verifyPacked(clientDataHash, credentialKey)
+	}
+
+	return fmt.Errorf("%w: unsupported format %q", ErrAttestationInvalid, a.Format)
+}
+
+func (a *attestationObject) verifyPacked(clientDataHash []byte, credentialKey *PublicKey) error {
+	alg, _ := a.Statement["alg"].(int64)
+	sig, _ := a.Statement["sig"].([]byte)
+	if sig == nil {
+		return fmt.Errorf("%w: packed attestation without signature", ErrAttestationInvalid)
+	}
+
+	signed := append(append([]byte(nil), a.RawAuthData...), clientDataHash...)
+
+	x5c, hasX5C := a.Statement["x5c"].([]interface{})
+	if !hasX5C {
+		// self attestation, signed by the credential itself
+		if alg != credentialKey.Algorithm {
+			return fmt.Errorf("%w: self attestation algorithm mismatch", ErrAttestationInvalid)
+		}
+		if err := credentialKey.Verify(signed, sig); err != nil {
+			return fmt.Errorf("%w: %v", ErrAttestationInvalid, err)
+		}
+		return nil
+	}
+
+	if len(x5c) < 1 {
+		return fmt.Errorf("%w: empty x5c", ErrAttestationInvalid)
+	}
+
+	certDER, _ := x5c[0].([]byte)
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrAttestationInvalid, err)
+	}
+
+	if err := verifySignature(alg, cert.PublicKey, signed, sig); err != nil {
+		return fmt.Errorf("%w: %v", ErrAttestationInvalid, err)
+	}
+
+	return verifyPackedCertificate(cert, a.AuthData.Credential.AAGUID)
+}
+
+// verifyPackedCertificate checks the attestation certificate requirements
+// of WebAuthn section 8.2.1.
+func verifyPackedCertificate(cert *x509.Certificate, aaguid []byte) error {
+	subject := cert.Subject
+	switch {
+	case cert.Version != 3:
+		return fmt.Errorf("%w: attestation certificate is not version 3", ErrAttestationInvalid)
+	case len(subject.Country) == 0 || len(subject.Organization) == 0 || subject.CommonName == "":
+		return fmt.Errorf("%w: attestation certificate subject is incomplete", ErrAttestationInvalid)
+	case len(subject.OrganizationalUnit) != 1 || subject.OrganizationalUnit[0] != "Authenticator Attestation":
+		return fmt.Errorf("%w: attestation certificate subject is incomplete", ErrAttestationInvalid)
+	case !cert.BasicConstraintsValid || cert.IsCA:
+		return fmt.Errorf("%w: attestation certificate is a CA", ErrAttestationInvalid)
+	}
+
+	for _, extension := range cert.Extensions {
+		if !extension.Id.Equal(oidFIDOGenCeAAGUID) {
+			continue
+		}
+
+		if extension.Critical {
+			return fmt.Errorf("%w: critical AAGUID extension", ErrAttestationInvalid)
+		}
+
+		var certAAGUID []byte
+		_, err := asn1.Unmarshal(extension.Value, &certAAGUID)
+		if err != nil || !bytes.Equal(certAAGUID, aaguid) {
+			return fmt.Errorf("%w: AAGUID mismatch", ErrAttestationInvalid)
+		}
+	}
+
+	return nil
+}
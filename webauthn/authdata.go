@@ -0,0 +1,97 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Authenticator data flags (WebAuthn section 6.1).
+const (
+	FlagUserPresent            byte = 0x01
+	FlagUserVerified           byte = 0x04
+	FlagAttestedCredentialData byte = 0x40
+	FlagExtensionData          byte = 0x80
+)
+
+var ErrAuthenticatorDataMalformed = errors.New("webauthn: malformed authenticator data")
+
+// AuthenticatorData is the data an authenticator signs in both ceremonies.
+// Credential is only set on registration.
+type AuthenticatorData struct {
+	RPIDHash   []byte
+	Flags      byte
+	SignCount  uint32
+	Credential *AttestedCredential
+}
+
+// AttestedCredential is the credential created by a registration.
+type AttestedCredential struct {
+	AAGUID    []byte
+	ID        []byte
+	PublicKey []byte
+}
+
+// ParseAuthenticatorData decodes raw authenticator data.
+func ParseAuthenticatorData(data []byte) (*AuthenticatorData, error) {
+	if len(data) < 37 {
+		return nil, ErrAuthenticatorDataMalformed
+	}
+
+	authData := &AuthenticatorData{
+		RPIDHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+
+	if authData.Flags&FlagAttestedCredentialData != 0 {
+		if len(rest) < 18 {
+			return nil, ErrAuthenticatorDataMalformed
+		}
+
+		aaguid, idLength := rest[:16], int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength > 1023 || len(rest) < idLength {
+			return nil, ErrAuthenticatorDataMalformed
+		}
+
+		id := rest[:idLength]
+		rest = rest[idLength:]
+
+		// the key is a CBOR item of unknown length, its end is found by
+		// decoding it
+		_, afterKey, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, ErrAuthenticatorDataMalformed
+		}
+
+		authData.Credential = &AttestedCredential{
+			AAGUID:    aaguid,
+			ID:        id,
+			PublicKey: rest[:len(rest)-len(afterKey)],
+		}
+		rest = afterKey
+	}
+
+	if authData.Flags&FlagExtensionData != 0 {
+		var err error
+		_, rest, err = decodeCBOR(rest)
+		if err != nil {
+			return nil, ErrAuthenticatorDataMalformed
+		}
+	}
+
+	if len(rest) > 0 {
+		return nil, ErrAuthenticatorDataMalformed
+	}
+
+	return authData, nil
+}
+
+func (d *AuthenticatorData) UserPresent() bool {
+	return d.Flags&FlagUserPresent != 0
+}
+
+func (d *AuthenticatorData) UserVerified() bool {
+	return d.Flags&FlagUserVerified != 0
+}
@@ -0,0 +1,60 @@
+package webauthn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// vectors of RFC 8949 appendix A
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want interface{}
+	}{
+		{name: "small integer", data: []byte{0x0a}, want: int64(10)},
+		{name: "uint8", data: []byte{0x18, 0x64}, want: int64(100)},
+		{name: "uint32", data: []byte{0x1a, 0x00, 0x0f, 0x42, 0x40}, want: int64(1000000)},
+		{name: "negative", data: []byte{0x38, 0x63}, want: int64(-100)},
+		{name: "bytes", data: []byte{0x44, 0x01, 0x02, 0x03, 0x04}, want: []byte{1, 2, 3, 4}},
+		{name: "text", data: []byte{0x64, 0x49, 0x45, 0x54, 0x46}, want: "IETF"},
+		{name: "array", data: []byte{0x83, 0x01, 0x82, 0x02, 0x03, 0x82, 0x04, 0x05},
+			want: []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}},
+		{name: "map", data: []byte{0xa2, 0x61, 0x61, 0x01, 0x20, 0x61, 0x62},
+			want: map[interface{}]interface{}{"a": int64(1), int64(-1): "b"}},
+		{name: "true", data: []byte{0xf5}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rest, err := decodeCBOR(append(tt.data, 0xff))
+			assert.Nil(t, err, "error should be nil")
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, []byte{0xff}, rest)
+		})
+	}
+}
+
+func TestDecodeCBORMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: []byte{}},
+		{name: "truncated argument", data: []byte{0x19, 0x01}},
+		{name: "truncated bytes", data: []byte{0x44, 0x01}},
+		{name: "array count beyond data", data: []byte{0x9a, 0xff, 0xff, 0xff, 0xff}},
+		{name: "indefinite length", data: []byte{0x5f, 0x41, 0x01, 0xff}},
+		{name: "duplicate key", data: []byte{0xa2, 0x01, 0x01, 0x01, 0x02}},
+		{name: "array key", data: []byte{0xa1, 0x80, 0x01}},
+		{name: "float", data: []byte{0xf9, 0x3c, 0x00}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := decodeCBOR(tt.data)
+			assert.ErrorIs(t, err, errCBORMalformed)
+		})
+	}
+}
@@ -0,0 +1,209 @@
+// This file contains the relying party side of the WebAuthn registration
+// and authentication ceremonies (https://www.w3.org/TR/webauthn-2/), enough
+// to accept passkeys: ES256 and RS256 credentials, "none" and "packed"
+// attestation.
+package webauthn
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	ChallengeSize = 32
+
+	ceremonyCreate = "webauthn.create"
+	ceremonyGet    = "webauthn.get"
+)
+
+var (
+	ErrClientDataInvalid = errors.New("webauthn: client data is not valid")
+	ErrRPIDMismatch      = errors.New("webauthn: credential is scoped to another relying party")
+	ErrUserNotPresent    = errors.New("webauthn: user presence is required")
+	ErrUserNotVerified   = errors.New("webauthn: user verification is required")
+	ErrSignatureInvalid  = errors.New("webauthn: signature is not valid")
+	// ErrSignCountInvalid hints at a cloned authenticator, the counter of a
+	// credential must grow with every assertion once it is used.
+	ErrSignCountInvalid = errors.New("webauthn: sign count did not increase")
+)
+
+// Encoding is the base64url encoding WebAuthn uses for binary values in
+// JSON, e.g. challenges and credential ids.
+var Encoding = base64.RawURLEncoding
+
+// RelyingParty is the website credentials are scoped to. ID is its domain,
+// Origins the exact origins ceremonies may run from.
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+	// RequireUserVerification refuses credentials used without PIN or
+	// biometrics, as needed when they replace the password.
+	RequireUserVerification bool
+}
+
+// Credential is the outcome of a registration, to be stored for the user.
+type Credential struct {
+	ID                []byte
+	PublicKey         []byte
+	SignCount         uint32
+	AAGUID            []byte
+	AttestationFormat string
+}
+
+// clientData is the JSON the browser built and the authenticator signed
+// the hash of.
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// NewChallenge returns a random challenge for a ceremony.
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, ChallengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// VerifyRegistration checks the response of navigator.credentials.create
+// to the challenge and returns the new credential (WebAuthn section 7.1).
+func (rp *RelyingParty) VerifyRegistration(challenge, clientDataJSON, attestationObjectData []byte) (*Credential, error) {
+	err := rp.verifyClientData(clientDataJSON, ceremonyCreate, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	attestation, err := parseAttestationObject(attestationObjectData)
+	if err != nil {
+		return nil, err
+	}
+
+	authData := attestation.AuthData
+	err = rp.verifyAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+
+	if authData.Credential == nil {
+		return nil, fmt.Errorf("%w: no attested credential", ErrAttestationInvalid)
+	}
+
+	credentialKey, err := ParsePublicKey(authData.Credential.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	err = attestation.verify(clientDataHash[:], credentialKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:                authData.Credential.ID,
+		PublicKey:         authData.Credential.PublicKey,
+		SignCount:         authData.SignCount,
+		AAGUID:            authData.Credential.AAGUID,
+		AttestationFormat: attestation.Format,
+	}, nil
+}
+
+// VerifyAssertion checks the response of navigator.credentials.get to the
+// challenge, signed with a stored credential (WebAuthn section 7.2). It
+// returns the new sign count of the credential.
+func (rp *RelyingParty) VerifyAssertion(challenge []byte, publicKey []byte, signCount uint32,
+	clientDataJSON, authenticatorData, signature []byte) (uint32, error) {
+	err := rp.verifyClientData(clientDataJSON, ceremonyGet, challenge)
+	if err != nil {
+		return 0, err
+	}
+
+	authData, err := ParseAuthenticatorData(authenticatorData)
+	if err != nil {
+		return 0, err
+	}
+
+	err = rp.verifyAuthenticatorData(authData)
+	if err != nil {
+		return 0, err
+	}
+
+	credentialKey, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return 0, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), authenticatorData...), clientDataHash[:]...)
+	err = credentialKey.Verify(signed, signature)
+	if err != nil {
+		return 0, err
+	}
+
+	// authenticators without a counter always report 0
+	if (authData.SignCount != 0 || signCount != 0) && authData.SignCount <= signCount {
+		return 0, ErrSignCountInvalid
+	}
+
+	return authData.SignCount, nil
+}
+
+func (rp *RelyingParty) verifyClientData(clientDataJSON []byte, ceremony string, challenge []byte) error {
+	data := clientData{}
+	err := json.Unmarshal(clientDataJSON, &data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrClientDataInvalid, err)
+	}
+
+	if data.Type != ceremony {
+		return fmt.Errorf("%w: type %q", ErrClientDataInvalid, data.Type)
+	}
+
+	received, err := Encoding.DecodeString(data.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(received, challenge) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrClientDataInvalid)
+	}
+
+	if data.CrossOrigin || !rp.allowedOrigin(data.Origin) {
+		return fmt.Errorf("%w: origin %q", ErrClientDataInvalid, data.Origin)
+	}
+
+	return nil
+}
+
+func (rp *RelyingParty) verifyAuthenticatorData(authData *AuthenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(authData.RPIDHash, rpIDHash[:]) != 1 {
+		return ErrRPIDMismatch
+	}
+
+	if !authData.UserPresent() {
+		return ErrUserNotPresent
+	}
+
+	if rp.RequireUserVerification && !authData.UserVerified() {
+		return ErrUserNotVerified
+	}
+
+	return nil
+}
+
+func (rp *RelyingParty) allowedOrigin(origin string) bool {
+	for _, allowed := range rp.Origins {
+		if origin == allowed {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,181 @@
+package webauthn_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/SawitProRecruitment/UserService/webauthn"
+	"github.com/SawitProRecruitment/UserService/webauthn/webauthntest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRelyingParty() *webauthn.RelyingParty {
+	return &webauthn.RelyingParty{
+		ID:                      "localhost",
+		Name:                    "UserService",
+		Origins:                 []string{"http://localhost:8080"},
+		RequireUserVerification: true,
+	}
+}
+
+func TestVerifyRegistration(t *testing.T) {
+	rp := newTestRelyingParty()
+	challenge, _ := webauthn.NewChallenge()
+
+	t.Run("none attestation", func(t *testing.T) {
+		authenticator := webauthntest.NewAuthenticator()
+		resp, err := authenticator.Create("localhost", "http://localhost:8080", challenge, []byte("user-id"))
+		assert.Nil(t, err, "error should be nil")
+
+		credential, err := rp.VerifyRegistration(challenge, resp.ClientDataJSON, resp.AttestationObject)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, resp.CredentialID, credential.ID)
+		assert.Equal(t, webauthn.AttestationFormatNone, credential.AttestationFormat)
+
+		key, err := webauthn.ParsePublicKey(credential.PublicKey)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, webauthn.AlgES256, key.Algorithm)
+	})
+
+	t.Run("packed self attestation", func(t *testing.T) {
+		authenticator := webauthntest.NewAuthenticator()
+		authenticator.Format = webauthntest.FormatPacked
+		resp, _ := authenticator.Create("localhost", "http://localhost:8080", challenge, []byte("user-id"))
+
+		credential, err := rp.VerifyRegistration(challenge, resp.ClientDataJSON, resp.AttestationObject)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, webauthn.AttestationFormatPacked, credential.AttestationFormat)
+	})
+
+	t.Run("packed attestation certificate", func(t *testing.T) {
+		authenticator := webauthntest.NewAuthenticator()
+		authenticator.AAGUID = bytes.Repeat([]byte{7}, 16)
+		authenticator.Format = webauthntest.FormatPacked
+		authenticator.AttestationCertificate, authenticator.AttestationKey, _ = webauthntest.NewAttestationCertificate(authenticator.AAGUID)
+		resp, _ := authenticator.Create("localhost", "http://localhost:8080", challenge, []byte("user-id"))
+
+		credential, err := rp.VerifyRegistration(challenge, resp.ClientDataJSON, resp.AttestationObject)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, authenticator.AAGUID, credential.AAGUID)
+	})
+
+	t.Run("packed attestation certificate of another model", func(t *testing.T) {
+		authenticator := webauthntest.NewAuthenticator()
+		authenticator.Format = webauthntest.FormatPacked
+		authenticator.AttestationCertificate, authenticator.AttestationKey, _ = webauthntest.NewAttestationCertificate(bytes.Repeat([]byte{7}, 16))
+		resp, _ := authenticator.Create("localhost", "http://localhost:8080", challenge, []byte("user-id"))
+
+		_, err := rp.VerifyRegistration(challenge, resp.ClientDataJSON, resp.AttestationObject)
+		assert.ErrorIs(t, err, webauthn.ErrAttestationInvalid)
+	})
+
+	t.Run("packed signature by another key", func(t *testing.T) {
+		authenticator := webauthntest.NewAuthenticator()
+		authenticator.Format = webauthntest.FormatPacked
+		authenticator.AttestationCertificate, _, _ = webauthntest.NewAttestationCertificate(authenticator.AAGUID)
+		_, authenticator.AttestationKey, _ = webauthntest.NewAttestationCertificate(authenticator.AAGUID)
+		resp, _ := authenticator.Create("localhost", "http://localhost:8080", challenge, []byte("user-id"))
+
+		_, err := rp.VerifyRegistration(challenge, resp.ClientDataJSON, resp.AttestationObject)
+		assert.ErrorIs(t, err, webauthn.ErrAttestationInvalid)
+	})
+
+	t.Run("other challenge", func(t *testing.T) {
+		other, _ := webauthn.NewChallenge()
+		resp, _ := webauthntest.NewAuthenticator().Create("localhost", "http://localhost:8080", other, []byte("user-id"))
+
+		_, err := rp.VerifyRegistration(challenge, resp.ClientDataJSON, resp.AttestationObject)
+		assert.ErrorIs(t, err, webauthn.ErrClientDataInvalid)
+	})
+
+	t.Run("other origin", func(t *testing.T) {
+		resp, _ := webauthntest.NewAuthenticator().Create("localhost", "http://evil.example", challenge, []byte("user-id"))
+
+		_, err := rp.VerifyRegistration(challenge, resp.ClientDataJSON, resp.AttestationObject)
+		assert.ErrorIs(t, err, webauthn.ErrClientDataInvalid)
+	})
+
+	t.Run("other relying party", func(t *testing.T) {
+		resp, _ := webauthntest.NewAuthenticator().Create("evil.example", "http://localhost:8080", challenge, []byte("user-id"))
+
+		_, err := rp.VerifyRegistration(challenge, resp.ClientDataJSON, resp.AttestationObject)
+		assert.ErrorIs(t, err, webauthn.ErrRPIDMismatch)
+	})
+
+	t.Run("user not verified", func(t *testing.T) {
+		authenticator := webauthntest.NewAuthenticator()
+		authenticator.UserVerified = false
+		resp, _ := authenticator.Create("localhost", "http://localhost:8080", challenge, []byte("user-id"))
+
+		_, err := rp.VerifyRegistration(challenge, resp.ClientDataJSON, resp.AttestationObject)
+		assert.ErrorIs(t, err, webauthn.ErrUserNotVerified)
+	})
+
+	t.Run("assertion is not a registration", func(t *testing.T) {
+		authenticator := webauthntest.NewAuthenticator()
+		_, _ = authenticator.Create("localhost", "http://localhost:8080", challenge, []byte("user-id"))
+		assertion, _ := authenticator.Get("localhost", "http://localhost:8080", challenge)
+
+		_, err := rp.VerifyRegistration(challenge, assertion.ClientDataJSON, assertion.AuthenticatorData)
+		assert.ErrorIs(t, err, webauthn.ErrClientDataInvalid)
+	})
+}
+
+func TestVerifyAssertion(t *testing.T) {
+	rp := newTestRelyingParty()
+	authenticator := webauthntest.NewAuthenticator()
+
+	challenge, _ := webauthn.NewChallenge()
+	resp, _ := authenticator.Create("localhost", "http://localhost:8080", challenge, []byte("user-id"))
+	credential, err := rp.VerifyRegistration(challenge, resp.ClientDataJSON, resp.AttestationObject)
+	assert.Nil(t, err, "error should be nil")
+
+	t.Run("positive", func(t *testing.T) {
+		challenge, _ := webauthn.NewChallenge()
+		assertion, err := authenticator.Get("localhost", "http://localhost:8080", challenge)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, []byte("user-id"), assertion.UserHandle)
+
+		signCount, err := rp.VerifyAssertion(challenge, credential.PublicKey, credential.SignCount,
+			assertion.ClientDataJSON, assertion.AuthenticatorData, assertion.Signature)
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, uint32(1), signCount)
+
+		t.Run("replayed", func(t *testing.T) {
+			_, err := rp.VerifyAssertion(challenge, credential.PublicKey, signCount,
+				assertion.ClientDataJSON, assertion.AuthenticatorData, assertion.Signature)
+			assert.ErrorIs(t, err, webauthn.ErrSignCountInvalid)
+		})
+	})
+
+	t.Run("tampered signature", func(t *testing.T) {
+		challenge, _ := webauthn.NewChallenge()
+		assertion, _ := authenticator.Get("localhost", "http://localhost:8080", challenge)
+		assertion.Signature[len(assertion.Signature)-1] ^= 0xff
+
+		_, err := rp.VerifyAssertion(challenge, credential.PublicKey, 0,
+			assertion.ClientDataJSON, assertion.AuthenticatorData, assertion.Signature)
+		assert.ErrorIs(t, err, webauthn.ErrSignatureInvalid)
+	})
+
+	t.Run("signed by another credential", func(t *testing.T) {
+		other := webauthntest.NewAuthenticator()
+		_, _ = other.Create("localhost", "http://localhost:8080", challenge, []byte("user-id"))
+
+		challenge, _ := webauthn.NewChallenge()
+		assertion, _ := other.Get("localhost", "http://localhost:8080", challenge)
+
+		_, err := rp.VerifyAssertion(challenge, credential.PublicKey, 0,
+			assertion.ClientDataJSON, assertion.AuthenticatorData, assertion.Signature)
+		assert.ErrorIs(t, err, webauthn.ErrSignatureInvalid)
+	})
+
+	t.Run("other challenge", func(t *testing.T) {
+		other, _ := webauthn.NewChallenge()
+		assertion, _ := authenticator.Get("localhost", "http://localhost:8080", other)
+
+		_, err := rp.VerifyAssertion(challenge, credential.PublicKey, 0,
+			assertion.ClientDataJSON, assertion.AuthenticatorData, assertion.Signature)
+		assert.ErrorIs(t, err, webauthn.ErrClientDataInvalid)
+	})
+}
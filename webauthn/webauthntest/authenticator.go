@@ -0,0 +1,264 @@
+// This file contains a software authenticator running the client side of
+// the WebAuthn ceremonies, for tests of relying parties.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"time"
+)
+
+const (
+	FormatNone   = "none"
+	FormatPacked = "packed"
+
+	algES256 = -7
+)
+
+var ErrNoCredential = errors.New("webauthntest: no credential for the relying party")
+
+// Authenticator holds ES256 credentials in memory. Credentials are
+// discoverable, Get picks the one registered for the relying party.
+type Authenticator struct {
+	AAGUID []byte
+	// Format of the attestation made by Create, FormatNone by default.
+	// FormatPacked uses AttestationKey and AttestationCertificate when set,
+	// self attestation otherwise.
+	Format                 string
+	AttestationKey         *ecdsa.PrivateKey
+	AttestationCertificate []byte
+	// UserVerified is reported in the flags of both ceremonies.
+	UserVerified bool
+
+	credentials []*credential
+}
+
+type credential struct {
+	id         []byte
+	key        *ecdsa.PrivateKey
+	rpID       string
+	userHandle []byte
+	signCount  uint32
+}
+
+// AttestationResponse is what navigator.credentials.create resolves with.
+type AttestationResponse struct {
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AttestationObject []byte
+}
+
+// AssertionResponse is what navigator.credentials.get resolves with.
+type AssertionResponse struct {
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+	UserHandle        []byte
+}
+
+func NewAuthenticator() *Authenticator {
+	return &Authenticator{
+		AAGUID:       make([]byte, 16),
+		Format:       FormatNone,
+		UserVerified: true,
+	}
+}
+
+// Create registers a new credential for the user of a relying party.
+func (a *Authenticator) Create(rpID, origin string, challenge, userHandle []byte) (*AttestationResponse, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	cred := &credential{
+		id:         make([]byte, 32),
+		key:        key,
+		rpID:       rpID,
+		userHandle: userHandle,
+	}
+	if _, err := rand.Read(cred.id); err != nil {
+		return nil, err
+	}
+
+	clientDataJSON, err := clientData("webauthn.create", origin, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	// attested credential data: aaguid, id length, id, COSE key
+	attested := append([]byte(nil), a.AAGUID...)
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(cred.id)))
+	attested = append(attested, cred.id...)
+	attested = append(attested, encodeCOSEKey(&key.PublicKey)...)
+
+	authData := a.authenticatorData(rpID, 0x40, cred.signCount, attested)
+
+	statement, err := a.attestationStatement(authData, clientDataJSON, key)
+	if err != nil {
+		return nil, err
+	}
+
+	format := a.Format
+	if format == "" {
+		format = FormatNone
+	}
+
+	a.credentials = append(a.credentials, cred)
+	return &AttestationResponse{
+		CredentialID:   cred.id,
+		ClientDataJSON: clientDataJSON,
+		AttestationObject: encodeCBOR(cborMap{
+			{"fmt", format},
+			{"attStmt", statement},
+			{"authData", authData},
+		}),
+	}, nil
+}
+
+// Get signs the challenge with the credential registered for rpID.
+func (a *Authenticator) Get(rpID, origin string, challenge []byte) (*AssertionResponse, error) {
+	var cred *credential
+	for _, c := range a.credentials {
+		if c.rpID == rpID {
+			cred = c
+		}
+	}
+
+	if cred == nil {
+		return nil, ErrNoCredential
+	}
+
+	clientDataJSON, err := clientData("webauthn.get", origin, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	cred.signCount++
+	authData := a.authenticatorData(rpID, 0, cred.signCount, nil)
+
+	signature, err := sign(cred.key, authData, clientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AssertionResponse{
+		CredentialID:      cred.id,
+		ClientDataJSON:    clientDataJSON,
+		AuthenticatorData: authData,
+		Signature:         signature,
+		UserHandle:        cred.userHandle,
+	}, nil
+}
+
+func (a *Authenticator) authenticatorData(rpID string, flags byte, signCount uint32, attested []byte) []byte {
+	flags |= 0x01
+	if a.UserVerified {
+		flags |= 0x04
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, signCount)
+	return append(data, attested...)
+}
+
+func (a *Authenticator) attestationStatement(authData, clientDataJSON []byte, credentialKey *ecdsa.PrivateKey) (cborMap, error) {
+	if a.Format != FormatPacked {
+		return cborMap{}, nil
+	}
+
+	key := credentialKey
+	if a.AttestationKey != nil {
+		key = a.AttestationKey
+	}
+
+	signature, err := sign(key, authData, clientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	statement := cborMap{{"alg", algES256}, {"sig", signature}}
+	if a.AttestationCertificate != nil {
+		statement = append(statement, cborMapEntry{"x5c", []interface{}{a.AttestationCertificate}})
+	}
+
+	return statement, nil
+}
+
+// NewAttestationCertificate issues a self-signed packed attestation
+// certificate for the authenticator model aaguid.
+func NewAttestationCertificate(aaguid []byte) ([]byte, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	aaguidExtension, err := asn1.Marshal(aaguid)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			Country:            []string{"ID"},
+			Organization:       []string{"Software Authenticator"},
+			OrganizationalUnit: []string{"Authenticator Attestation"},
+			CommonName:         "webauthntest",
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}, Value: aaguidExtension},
+		},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return der, key, nil
+}
+
+func clientData(ceremony, origin string, challenge []byte) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"type":        ceremony,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":      origin,
+		"crossOrigin": false,
+	})
+}
+
+func sign(key *ecdsa.PrivateKey, authData, clientDataJSON []byte) ([]byte, error) {
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	return ecdsa.SignASN1(rand.Reader, key, digest[:])
+}
+
+func encodeCOSEKey(key *ecdsa.PublicKey) []byte {
+	x, y := make([]byte, 32), make([]byte, 32)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+
+	return encodeCBOR(cborMap{
+		{1, 2},
+		{3, algES256},
+		{-1, 1},
+		{-2, x},
+		{-3, y},
+	})
+}
@@ -0,0 +1,62 @@
+package webauthntest
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// cborMap keeps entries in the order they are encoded, callers list them in
+// CTAP2 canonical order.
+type cborMap []cborMapEntry
+
+type cborMapEntry struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// encodeCBOR encodes the values authenticators emit: integers, byte and
+// text strings, arrays and maps.
+func encodeCBOR(value interface{}) []byte {
+	switch v := value.(type) {
+	case int:
+		if v < 0 {
+			return cborHead(1, uint64(-1-v))
+		}
+		return cborHead(0, uint64(v))
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case []interface{}:
+		data := cborHead(4, uint64(len(v)))
+		for _, item := range v {
+			data = append(data, encodeCBOR(item)...)
+		}
+		return data
+	case cborMap:
+		data := cborHead(5, uint64(len(v)))
+		for _, entry := range v {
+			data = append(data, encodeCBOR(entry.Key)...)
+			data = append(data, encodeCBOR(entry.Value)...)
+		}
+		return data
+	}
+
+	panic(fmt.Sprintf("webauthntest: cannot encode %T", value))
+}
+
+func cborHead(major byte, argument uint64) []byte {
+	major <<= 5
+	switch {
+	case argument < 24:
+		return []byte{major | byte(argument)}
+	case argument <= 0xff:
+		return []byte{major | 24, byte(argument)}
+	case argument <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major | 25}, uint16(argument))
+	case argument <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major | 26}, uint32(argument))
+	}
+
+	return binary.BigEndian.AppendUint64([]byte{major | 27}, argument)
+}